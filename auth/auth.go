@@ -0,0 +1,156 @@
+// auth.go
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jonipwi/go-chat-client/config"
+	"github.com/jonipwi/go-chat-client/utils"
+)
+
+// ErrRejected is returned when the server or the login endpoint refuses the credentials
+var ErrRejected = errors.New("authentication rejected")
+
+// Token is a bearer token and, if known, when it expires
+type Token struct {
+	Value     string
+	ExpiresAt time.Time
+}
+
+// expiresWithin reports whether the token expires within d of now
+func (t Token) expiresWithin(now time.Time, d time.Duration) bool {
+	return !t.ExpiresAt.IsZero() && !now.Before(t.ExpiresAt.Add(-d))
+}
+
+// Provider obtains tokens to authenticate the Socket.IO handshake with
+type Provider interface {
+	Token() (Token, error)
+}
+
+// Source caches the token of a provider and renews it before it expires
+type Source struct {
+	provider      Provider
+	sendAs        string
+	refreshBefore time.Duration
+	now           func() time.Time
+	sleep         func(context.Context, time.Duration) bool
+
+	mu    sync.Mutex
+	token Token
+}
+
+// NewSource creates a token source that sends tokens as configured in sendAs
+// and renews them refreshBefore their expiry
+func NewSource(provider Provider, sendAs string, refreshBefore time.Duration) *Source {
+	return &Source{
+		provider:      provider,
+		sendAs:        sendAs,
+		refreshBefore: refreshBefore,
+		now:           time.Now,
+		sleep:         utils.Sleep,
+	}
+}
+
+// FromConfig creates the token source for the configured auth method.
+// It returns nil if authentication is disabled. client makes the login
+// requests, so they use the server's TLS settings, and may be nil.
+func FromConfig(cfg config.Config, client *http.Client) (*Source, error) {
+	provider, err := NewProvider(cfg.Auth, cfg.Username, client)
+	if err != nil || provider == nil {
+		return nil, err
+	}
+	return NewSource(provider, cfg.Auth.SendAs, cfg.Auth.RefreshBefore.Duration), nil
+}
+
+// Token returns the cached token, fetching a new one if there is none or it is about to expire
+func (s *Source) Token() (Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token.Value != "" && !s.token.expiresWithin(s.now(), s.refreshBefore) {
+		return s.token, nil
+	}
+	token, err := s.provider.Token()
+	if err != nil {
+		return Token{}, err
+	}
+	s.token = token
+	return token, nil
+}
+
+// Invalidate drops the cached token, so the next connection fetches a new one.
+// It is called when the server rejects the token.
+func (s *Source) Invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = Token{}
+}
+
+// Apply adds the token to the handshake header and query
+func (s *Source) Apply(header http.Header, query map[string]string) error {
+	token, err := s.Token()
+	if err != nil {
+		return fmt.Errorf("error getting auth token: %w", err)
+	}
+	if s.sendAs == config.SendAsHeader || s.sendAs == config.SendAsBoth {
+		header.Set("Authorization", "Bearer "+token.Value)
+	}
+	if s.sendAs == config.SendAsQuery || s.sendAs == config.SendAsBoth {
+		query["token"] = token.Value
+	}
+	return nil
+}
+
+// logger logs token refreshes
+var logger = utils.Log(utils.ComponentAuth)
+
+// refreshRetryDelay is how long Run waits after a failed refresh
+const refreshRetryDelay = 10 * time.Second
+
+// Run renews tokens with a known expiry before they expire, so reconnects
+// never have to wait for a login. Tokens without an expiry are only renewed
+// when they are rejected. It returns when ctx is done.
+func (s *Source) Run(ctx context.Context) {
+	logger.Info("Starting token refresher")
+	defer logger.Info("Stopped token refresher")
+	for {
+		s.mu.Lock()
+		token := s.token
+		s.mu.Unlock()
+
+		if token.ExpiresAt.IsZero() {
+			if !s.sleep(ctx, time.Minute) {
+				return
+			}
+			continue
+		}
+		if wait := token.ExpiresAt.Add(-s.refreshBefore).Sub(s.now()); wait > 0 {
+			if !s.sleep(ctx, wait) {
+				return
+			}
+		}
+
+		token, err := s.Token()
+		if err != nil {
+			logger.Error("Failed to refresh token", "error", err)
+			if !s.sleep(ctx, refreshRetryDelay) {
+				return
+			}
+			continue
+		}
+		if token.expiresWithin(s.now(), s.refreshBefore) {
+			// The provider handed out the same or an almost expired token again
+			logger.Warn("Refreshed token is about to expire", "expires_at", token.ExpiresAt.Format(time.RFC3339))
+			if !s.sleep(ctx, refreshRetryDelay) {
+				return
+			}
+			continue
+		}
+		logger.Info("Token refreshed", "expires_at", token.ExpiresAt.Format(time.RFC3339))
+	}
+}
@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jonipwi/go-chat-client/config"
+)
+
+// countingProvider hands out numbered tokens that expire after ttl
+type countingProvider struct {
+	calls int
+	now   func() time.Time
+	ttl   time.Duration
+}
+
+func (p *countingProvider) Token() (Token, error) {
+	p.calls++
+	return Token{Value: fmt.Sprintf("token-%d", p.calls), ExpiresAt: p.now().Add(p.ttl)}, nil
+}
+
+func TestSourceCachesAndRefreshes(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	provider := &countingProvider{now: clock, ttl: 10 * time.Minute}
+	source := NewSource(provider, config.SendAsHeader, time.Minute)
+	source.now = clock
+
+	first, _ := source.Token()
+	now = now.Add(8 * time.Minute)
+	second, _ := source.Token()
+	if first != second || provider.calls != 1 {
+		t.Errorf("Expected the token to be cached, got %v then %v after %d calls", first, second, provider.calls)
+	}
+
+	// Within a minute of expiry the token is renewed
+	now = now.Add(90 * time.Second)
+	third, _ := source.Token()
+	if third.Value != "token-2" {
+		t.Errorf("Expected a refreshed token, got %v", third)
+	}
+
+	source.Invalidate()
+	if fourth, _ := source.Token(); fourth.Value != "token-3" {
+		t.Errorf("Expected Invalidate to force a new token, got %v", fourth)
+	}
+}
+
+func TestSourceApply(t *testing.T) {
+	tests := []struct {
+		sendAs     string
+		wantHeader bool
+		wantQuery  bool
+	}{
+		{config.SendAsHeader, true, false},
+		{config.SendAsQuery, false, true},
+		{config.SendAsBoth, true, true},
+	}
+
+	for _, test := range tests {
+		header, query := http.Header{}, map[string]string{}
+		source := NewSource(StaticToken("secret"), test.sendAs, time.Minute)
+		if err := source.Apply(header, query); err != nil {
+			t.Fatalf("Apply returned %v", err)
+		}
+		if got := header.Get("Authorization") == "Bearer secret"; got != test.wantHeader {
+			t.Errorf("send_as %s: Authorization header = %q", test.sendAs, header.Get("Authorization"))
+		}
+		if got := query["token"] == "secret"; got != test.wantQuery {
+			t.Errorf("send_as %s: token query = %q", test.sendAs, query["token"])
+		}
+	}
+}
+
+func TestTokenProviders(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Truncate(time.Second)
+	claims, _ := json.Marshal(map[string]int64{"exp": exp.Unix()})
+	jwt := "eyJhbGciOiJIUzI1NiJ9." + base64.RawURLEncoding.EncodeToString(claims) + ".signature"
+
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte(jwt+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	token, err := FileToken(path).Token()
+	if err != nil || token.Value != jwt {
+		t.Fatalf("FileToken = %v, %v", token, err)
+	}
+	if !token.ExpiresAt.Equal(exp) {
+		t.Errorf("Expected the JWT expiry %v, got %v", exp, token.ExpiresAt)
+	}
+
+	t.Setenv("CHAT_TEST_TOKEN", "opaque")
+	token, err = EnvToken("CHAT_TEST_TOKEN").Token()
+	if err != nil || token.Value != "opaque" || !token.ExpiresAt.IsZero() {
+		t.Errorf("EnvToken = %v, %v", token, err)
+	}
+
+	if _, err := EnvToken("CHAT_TEST_UNSET_TOKEN").Token(); err == nil {
+		t.Error("Expected an unset variable to be an error")
+	}
+}
+
+func TestLogin(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var creds struct{ Username, Password string }
+		json.NewDecoder(r.Body).Decode(&creds)
+		if creds.Username != "alice" || creds.Password != "hunter2" {
+			http.Error(w, "bad credentials", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "issued", "expires_in": 300})
+	}))
+	defer srv.Close()
+
+	token, err := (&Login{URL: srv.URL, Username: "alice", Password: "hunter2"}).Token()
+	if err != nil || token.Value != "issued" {
+		t.Fatalf("Login = %v, %v", token, err)
+	}
+	if remaining := time.Until(token.ExpiresAt); remaining < 4*time.Minute || remaining > 5*time.Minute {
+		t.Errorf("Expected the token to expire in about 5 minutes, got %v", remaining)
+	}
+
+	_, err = (&Login{URL: srv.URL, Username: "alice", Password: "wrong"}).Token()
+	if !errors.Is(err, ErrRejected) {
+		t.Errorf("Expected a rejected login to wrap ErrRejected, got %v", err)
+	}
+}
+
+func TestLoginUsesClient(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"token": "issued"})
+	}))
+	defer srv.Close()
+	cfg := config.AuthConfig{Method: config.AuthLogin, LoginURL: srv.URL, Password: "hunter2"}
+
+	// The default client does not trust the test server's certificate
+	provider, err := NewProvider(cfg, "alice", nil)
+	if err != nil {
+		t.Fatalf("NewProvider() error: %v", err)
+	}
+	if _, err := provider.Token(); err == nil {
+		t.Error("Expected the login to fail without the server's TLS settings")
+	}
+
+	provider, err = NewProvider(cfg, "alice", srv.Client())
+	if err != nil {
+		t.Fatalf("NewProvider() error: %v", err)
+	}
+	if token, err := provider.Token(); err != nil || token.Value != "issued" {
+		t.Errorf("Login = %v, %v; expected the given client to be used", token, err)
+	}
+}
+
+func TestDetectRejections(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer good" {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: DetectRejections(nil)}
+	get := func(token string) error {
+		req, _ := http.NewRequest("GET", srv.URL, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	if err := get("good"); err != nil {
+		t.Errorf("Expected an accepted request to succeed, got %v", err)
+	}
+	if err := get("bad"); !errors.Is(err, ErrRejected) {
+		t.Errorf("Expected a 401 to wrap ErrRejected, got %v", err)
+	}
+}
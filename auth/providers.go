@@ -0,0 +1,159 @@
+// providers.go
+package auth
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jonipwi/go-chat-client/config"
+)
+
+// NewProvider creates the provider for the configured auth method, or nil if
+// authentication is disabled. username and client are used for the login
+// exchange; client may be nil.
+func NewProvider(cfg config.AuthConfig, username string, client *http.Client) (Provider, error) {
+	switch cfg.Method {
+	case config.AuthNone:
+		return nil, nil
+	case config.AuthToken:
+		return StaticToken(cfg.Token), nil
+	case config.AuthFile:
+		return FileToken(cfg.TokenFile), nil
+	case config.AuthEnv:
+		return EnvToken(cfg.TokenEnv), nil
+	case config.AuthLogin:
+		return &Login{URL: cfg.LoginURL, Username: username, Password: cfg.Password, Client: client}, nil
+	}
+	return nil, fmt.Errorf("unknown auth method %q", cfg.Method)
+}
+
+// StaticToken is a fixed token
+type StaticToken string
+
+// Token returns the static token
+func (t StaticToken) Token() (Token, error) {
+	return newToken(string(t))
+}
+
+// FileToken reads the token from a file every time one is needed, so tokens
+// rotated by another process are picked up
+type FileToken string
+
+// Token reads the token file
+func (f FileToken) Token() (Token, error) {
+	data, err := os.ReadFile(string(f))
+	if err != nil {
+		return Token{}, fmt.Errorf("error reading token file: %w", err)
+	}
+	return newToken(string(data))
+}
+
+// EnvToken reads the token from the named environment variable
+type EnvToken string
+
+// Token reads the environment variable
+func (e EnvToken) Token() (Token, error) {
+	return newToken(os.Getenv(string(e)))
+}
+
+// newToken trims value and, for JWTs, reads the expiry from the exp claim
+func newToken(value string) (Token, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return Token{}, fmt.Errorf("empty auth token")
+	}
+	return Token{Value: value, ExpiresAt: jwtExpiry(value)}, nil
+}
+
+// jwtExpiry returns the exp claim of a JWT, or the zero time for any other token.
+// The signature is not checked, the expiry is only used to schedule refreshes.
+func jwtExpiry(value string) time.Time {
+	parts := strings.Split(value, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(claims.Exp, 0)
+}
+
+// LoginTimeout bounds a login request
+const LoginTimeout = 15 * time.Second
+
+// Login exchanges a username and password for a token. It posts
+// {"username": ..., "password": ...} to URL and expects a JSON response with
+// "token" (or "access_token") and optionally "expires_in" seconds or an
+// RFC3339 "expires_at".
+type Login struct {
+	URL      string
+	Username string
+	Password string
+	Client   *http.Client // Defaults to a client with LoginTimeout and the default TLS settings
+}
+
+// Token logs in and returns the issued token
+func (l *Login) Token() (Token, error) {
+	body, err := json.Marshal(map[string]string{"username": l.Username, "password": l.Password})
+	if err != nil {
+		return Token{}, err
+	}
+
+	client := l.Client
+	if client == nil {
+		client = &http.Client{Timeout: LoginTimeout}
+	}
+	resp, err := client.Post(l.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return Token{}, fmt.Errorf("login request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return Token{}, fmt.Errorf("%w: login returned %s", ErrRejected, resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Token{}, fmt.Errorf("login returned %s", resp.Status)
+	}
+
+	var result struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+		ExpiresAt   string `json:"expires_at"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&result); err != nil {
+		return Token{}, fmt.Errorf("invalid login response: %w", err)
+	}
+	if result.Token == "" {
+		result.Token = result.AccessToken
+	}
+
+	token, err := newToken(result.Token)
+	if err != nil {
+		return Token{}, fmt.Errorf("invalid login response: %w", err)
+	}
+	switch {
+	case result.ExpiresIn > 0:
+		token.ExpiresAt = time.Now().Add(time.Duration(result.ExpiresIn) * time.Second)
+	case result.ExpiresAt != "":
+		if t, err := time.Parse(time.RFC3339, result.ExpiresAt); err == nil {
+			token.ExpiresAt = t
+		}
+	}
+	return token, nil
+}
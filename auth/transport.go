@@ -0,0 +1,46 @@
+// transport.go
+package auth
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// rejectionTransport turns 401 and 403 responses into ErrRejected errors
+type rejectionTransport struct {
+	next http.RoundTripper
+}
+
+// DetectRejections wraps next so that requests answered with 401 Unauthorized
+// or 403 Forbidden fail with an error wrapping ErrRejected. The socket.io
+// client does not check the status of its handshake, so without this a
+// rejected token shows up as an unreadable handshake payload.
+func DetectRejections(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if _, ok := next.(*rejectionTransport); ok {
+		return next
+	}
+	return &rejectionTransport{next: next}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *rejectionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	if resp.StatusCode != http.StatusUnauthorized && resp.StatusCode != http.StatusForbidden {
+		return resp, nil
+	}
+
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if reason := strings.TrimSpace(string(body)); reason != "" {
+		return nil, fmt.Errorf("%w: server returned %s: %s", ErrRejected, resp.Status, reason)
+	}
+	return nil, fmt.Errorf("%w: server returned %s", ErrRejected, resp.Status)
+}
@@ -0,0 +1,57 @@
+// args.go
+package bot
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+// SplitArgs splits command arguments at spaces. Double or single quotes
+// around an argument keep the spaces in it, as in !remind "stand-up
+// meeting" 10m, and a backslash takes the next character literally. Quotes
+// inside a word, as in "don't", are kept as they are.
+func SplitArgs(s string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+
+	for _, r := range s {
+		switch {
+		case escaped:
+			arg.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped, inArg = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case (r == '"' || r == '\'') && !inArg:
+			quote, inArg = r, true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	if escaped {
+		return nil, errors.New("nothing to escape at the end")
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,438 @@
+// bot.go
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jonipwi/go-chat-client/chatclient"
+	"github.com/jonipwi/go-chat-client/commands"
+	"github.com/jonipwi/go-chat-client/config"
+	"github.com/jonipwi/go-chat-client/events"
+	"github.com/jonipwi/go-chat-client/history"
+	"github.com/jonipwi/go-chat-client/state"
+	"github.com/jonipwi/go-chat-client/utils"
+)
+
+// logger logs the commands bots run and the replies they fail to send
+var logger = utils.Log(utils.ComponentBot)
+
+// messageBuffer is how many incoming messages a bot holds while a handler runs
+const messageBuffer = 64
+
+// maxCooldowns is how many cooldowns are kept before expired ones are dropped
+const maxCooldowns = 256
+
+// Bot answers chat messages on behalf of a client: commands starting with
+// the configured prefix, such as "!roll 2d6", and messages matching a
+// Trigger. Handlers run one at a time on the goroutine calling Run, so they
+// may block, e.g. waiting for a private message to be delivered.
+//
+//	b := bot.New(client)
+//	b.MustRegister(&bot.Command{Name: "ping", Description: "Check the bot is alive", Handler: func(ctx *bot.Context) {
+//		ctx.Reply("pong")
+//	}})
+//	b.Handle(bot.Trigger{Mention: true}, func(ctx *bot.Context) { ctx.Reply("Try !help") })
+//	go b.Run(ctx)
+type Bot struct {
+	client *chatclient.Client
+	cfg    config.BotConfig
+	admins map[string]bool // By user ID
+	now    func() time.Time
+
+	mu        sync.Mutex
+	commands  []*Command
+	byName    map[string]*Command
+	triggers  []trigger
+	cooldowns map[usage]*cooldown
+}
+
+// Command is a bot command, run when a message starts with the prefix
+// followed by its name or an alias
+type Command struct {
+	Name        string
+	Aliases     []string
+	Usage       string // Argument synopsis shown in help, e.g. "<room_id> <text>"
+	Description string
+	Args        commands.ArgSpec
+	Admin       bool          // Only users whose ID is in the configured admin list may run it
+	Cooldown    time.Duration // How long a user waits between two runs; 0 uses the configured cooldown, negative disables it
+	Handler     func(ctx *Context)
+}
+
+// Trigger selects the messages a handler runs for. Every condition that is
+// set must hold; a zero Trigger matches every message.
+type Trigger struct {
+	Pattern *regexp.Regexp // Matched against the message text; submatches are passed in Context.Match
+	Mention bool           // The message mentions the bot's username
+	Rooms   []string       // The message is in one of these rooms: "global", a room ID or "@user" for a private conversation
+}
+
+// trigger is a handler registered with Handle
+type trigger struct {
+	Trigger
+	handler func(ctx *Context)
+}
+
+// usage identifies a user's runs of a command for cooldowns
+type usage struct {
+	user    string // User ID, "" for every sender without one
+	command string
+}
+
+// cooldown is when a user may run a command again, and whether they were told
+type cooldown struct {
+	until  time.Time
+	warned bool
+}
+
+// New creates a bot answering the messages client receives, with the
+// prefix, admins and cooldown of the client's configuration. It has a
+// built-in help command listing the commands the sender may run.
+func New(client *chatclient.Client) *Bot {
+	cfg := client.Config().Bot
+	b := &Bot{
+		client:    client,
+		cfg:       cfg,
+		admins:    make(map[string]bool),
+		now:       time.Now,
+		byName:    make(map[string]*Command),
+		cooldowns: make(map[usage]*cooldown),
+	}
+	for _, admin := range cfg.Admins {
+		b.admins[admin] = true
+	}
+	b.MustRegister(&Command{
+		Name:        "help",
+		Usage:       "[command]",
+		Description: "Show the commands you can run",
+		Args:        commands.ArgSpec{Min: 0, Max: 1},
+		Cooldown:    -1,
+		Handler:     b.handleHelp,
+	})
+	return b
+}
+
+// Client returns the client the bot answers for
+func (b *Bot) Client() *chatclient.Client {
+	return b.client
+}
+
+// Register adds a command; names and aliases must be unique
+func (b *Bot) Register(cmd *Command) error {
+	if cmd.Name == "" || cmd.Handler == nil {
+		return fmt.Errorf("command must have a name and a handler")
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	names := append([]string{cmd.Name}, cmd.Aliases...)
+	for _, name := range names {
+		if _, exists := b.byName[name]; exists {
+			return fmt.Errorf("command %s%s is already registered", b.cfg.Prefix, name)
+		}
+	}
+	for _, name := range names {
+		b.byName[name] = cmd
+	}
+	b.commands = append(b.commands, cmd)
+	return nil
+}
+
+// MustRegister is like Register but panics on error
+func (b *Bot) MustRegister(cmd *Command) {
+	if err := b.Register(cmd); err != nil {
+		panic(err)
+	}
+}
+
+// Handle registers handler to run for every message matching t that is not
+// a command. Handlers run in the order they are registered.
+func (b *Bot) Handle(t Trigger, handler func(ctx *Context)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.triggers = append(b.triggers, trigger{Trigger: t, handler: handler})
+}
+
+// IsAdmin reports whether the user with the given ID is in the configured
+// admin list. Anyone can take a username, so admins are only known by the
+// ID the server authenticated them with, see events.Message.SenderID.
+func (b *Bot) IsAdmin(userID string) bool {
+	return userID != "" && b.admins[userID]
+}
+
+// Run answers messages until ctx is done
+func (b *Bot) Run(ctx context.Context) {
+	messages, stop := b.client.Messages(messageBuffer)
+	defer stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-messages:
+			b.handle(ctx, msg)
+		}
+	}
+}
+
+// handle runs the command a message asks for, or else every trigger it matches
+func (b *Bot) handle(ctx context.Context, msg events.Message) {
+	if msg.Sender == "" || msg.Type == events.TypeSystem || msg.Sender == b.client.State().GetUsername() {
+		return
+	}
+	if text, ok := strings.CutPrefix(msg.Content, b.cfg.Prefix); ok && text != "" {
+		if b.runCommand(ctx, msg, text) {
+			return
+		}
+	}
+
+	b.mu.Lock()
+	triggers := b.triggers
+	b.mu.Unlock()
+	for _, t := range triggers {
+		if match, ok := b.matches(t.Trigger, msg); ok {
+			b.run("trigger", func() { t.handler(&Context{ctx: ctx, bot: b, Message: msg, Match: match}) })
+		}
+	}
+}
+
+// runCommand runs the command named at the start of text and reports
+// whether there is one by that name
+func (b *Bot) runCommand(ctx context.Context, msg events.Message, text string) bool {
+	name, rest, _ := strings.Cut(text, " ")
+	b.mu.Lock()
+	cmd, ok := b.byName[name]
+	b.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	c := &Context{ctx: ctx, bot: b, Message: msg, Command: cmd}
+	if cmd.Admin && !b.IsAdmin(msg.SenderID) {
+		logger.Info("Refused admin command", "command", cmd.Name, "user", msg.Sender, "user_id", msg.SenderID)
+		c.Replyf("⛔ %s%s is for admins only", b.cfg.Prefix, cmd.Name)
+		return true
+	}
+	args, err := SplitArgs(rest)
+	if err != nil {
+		c.Replyf("❌ %v", err)
+		return true
+	}
+	if len(args) < cmd.Args.Min || (cmd.Args.Max >= 0 && len(args) > cmd.Args.Max) {
+		c.Replyf("Usage: %s", b.synopsis(cmd))
+		return true
+	}
+	if wait := b.cooldown(msg.SenderID, cmd); wait > 0 {
+		c.Replyf("⏳ Please wait %s before using %s%s again", (wait + time.Second - 1).Truncate(time.Second), b.cfg.Prefix, cmd.Name)
+		return true
+	} else if wait < 0 {
+		// Already told to wait
+		return true
+	}
+
+	c.Args = args
+	// Arguments are left out, they may hold message text
+	logger.Debug("Running bot command", "command", cmd.Name, "user", msg.Sender, "args", len(args))
+	b.run(cmd.Name, func() { cmd.Handler(c) })
+	return true
+}
+
+// cooldown records that the user with the given ID runs cmd. Senders
+// without an ID could dodge a cooldown by renaming themselves, so they
+// share one. If the user has to wait first, it returns how long the first
+// time they are told, and -1 after that.
+func (b *Bot) cooldown(userID string, cmd *Command) time.Duration {
+	length := cmd.Cooldown
+	if length == 0 {
+		length = b.cfg.Cooldown.Duration
+	}
+	if length <= 0 || b.IsAdmin(userID) {
+		return 0
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	key := usage{user: userID, command: cmd.Name}
+	if c, ok := b.cooldowns[key]; ok && now.Before(c.until) {
+		if c.warned {
+			return -1
+		}
+		c.warned = true
+		return c.until.Sub(now)
+	}
+	if len(b.cooldowns) >= maxCooldowns {
+		for k, c := range b.cooldowns {
+			if !now.Before(c.until) {
+				delete(b.cooldowns, k)
+			}
+		}
+	}
+	b.cooldowns[key] = &cooldown{until: now.Add(length)}
+	return 0
+}
+
+// matches reports whether msg matches t, with the pattern's submatches
+func (b *Bot) matches(t Trigger, msg events.Message) ([]string, bool) {
+	if len(t.Rooms) > 0 && !contains(t.Rooms, history.RoomOf(msg)) {
+		return nil, false
+	}
+	if t.Mention && !state.Mentions(msg.Content, b.client.State().GetUsername()) {
+		return nil, false
+	}
+	if t.Pattern == nil {
+		return nil, true
+	}
+	match := t.Pattern.FindStringSubmatch(msg.Content)
+	return match, match != nil
+}
+
+// run calls a handler, logging rather than crashing the bot if it panics
+func (b *Bot) run(name string, handler func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("Bot handler panicked", "handler", name, "panic", r)
+		}
+	}()
+	handler()
+}
+
+// handleHelp lists the commands the sender may run, or describes one of them
+func (b *Bot) handleHelp(ctx *Context) {
+	admin := b.IsAdmin(ctx.Message.SenderID)
+	b.mu.Lock()
+	cmds := append([]*Command{}, b.commands...)
+	cmd, found := b.byName[strings.TrimPrefix(ctx.Arg(0), b.cfg.Prefix)]
+	b.mu.Unlock()
+
+	if len(ctx.Args) == 1 {
+		if !found || (cmd.Admin && !admin) {
+			ctx.Replyf("Unknown command %s", ctx.Args[0])
+			return
+		}
+		ctx.Replyf("%s - %s", b.synopsis(cmd), cmd.Description)
+		return
+	}
+
+	sort.Slice(cmds, func(i, j int) bool { return cmds[i].Name < cmds[j].Name })
+	lines := []string{"Commands:"}
+	for _, cmd := range cmds {
+		if cmd.Admin && !admin {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s - %s", b.synopsis(cmd), cmd.Description))
+	}
+	ctx.Reply(strings.Join(lines, "\n"))
+}
+
+// synopsis returns the command with its prefix followed by its argument usage
+func (b *Bot) synopsis(cmd *Command) string {
+	if cmd.Usage == "" {
+		return b.cfg.Prefix + cmd.Name
+	}
+	return b.cfg.Prefix + cmd.Name + " " + cmd.Usage
+}
+
+// Reply sends text to where msg came from, with the event matching its type:
+// global_message for global chat, group_message or guild_message for rooms,
+// and private_message to the sender of a private message, which waits for
+// the server to confirm delivery. Replies made while offline are queued.
+func (b *Bot) Reply(ctx context.Context, msg events.Message, text string) error {
+	var err error
+	switch msg.Type {
+	case events.TypeGlobal:
+		_, err = b.client.State().Send("global_message", text)
+	case events.TypeGroup, events.TypeGuild:
+		if msg.Room == "" {
+			return fmt.Errorf("%s message has no room to reply to", msg.Type)
+		}
+		_, err = b.client.State().Send(msg.Type+"_message", msg.Room, text)
+	case events.TypePrivate:
+		_, err = b.client.SendPrivate(ctx, msg.Sender, text)
+	default:
+		return fmt.Errorf("cannot reply to a %s message", msg.Type)
+	}
+	return err
+}
+
+// Context carries the message a handler runs for
+type Context struct {
+	ctx     context.Context
+	bot     *Bot
+	Message events.Message
+	Command *Command // Nil for triggers
+	Args    []string // Arguments of a command, see SplitArgs
+	Match   []string // Submatches of the trigger's pattern
+}
+
+// Context returns the context of Run, done when the bot stops
+func (ctx *Context) Context() context.Context {
+	return ctx.ctx
+}
+
+// Bot returns the bot running the handler
+func (ctx *Context) Bot() *Bot {
+	return ctx.bot
+}
+
+// Arg returns the i-th argument, or "" if there are fewer
+func (ctx *Context) Arg(i int) string {
+	if i < len(ctx.Args) {
+		return ctx.Args[i]
+	}
+	return ""
+}
+
+// Room returns where the message was sent: "global", a room ID or "@user"
+// for a private conversation
+func (ctx *Context) Room() string {
+	return history.RoomOf(ctx.Message)
+}
+
+// IsAdmin reports whether the sender's user ID is in the configured admin list
+func (ctx *Context) IsAdmin() bool {
+	return ctx.bot.IsAdmin(ctx.Message.SenderID)
+}
+
+// Reply answers where the message came from, see Bot.Reply. Failures are
+// logged as well as returned.
+func (ctx *Context) Reply(text string) error {
+	return ctx.reply(ctx.Message, text)
+}
+
+// Replyf answers with formatted text, see Reply
+func (ctx *Context) Replyf(format string, a ...interface{}) error {
+	return ctx.Reply(fmt.Sprintf(format, a...))
+}
+
+// ReplyPrivate answers the sender with a private message wherever the
+// message came from
+func (ctx *Context) ReplyPrivate(text string) error {
+	msg := ctx.Message
+	msg.Type, msg.Room = events.TypePrivate, ""
+	return ctx.reply(msg, text)
+}
+
+// reply answers msg and logs failures
+func (ctx *Context) reply(msg events.Message, text string) error {
+	err := ctx.bot.Reply(ctx.ctx, msg, text)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		logger.Warn("Failed to send bot reply", "type", msg.Type, "room", msg.Room, "error", err)
+	}
+	return err
+}
+
+// contains reports whether list holds s
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
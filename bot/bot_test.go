@@ -0,0 +1,242 @@
+package bot
+
+import (
+	"context"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonipwi/go-chat-client/chatclient"
+	"github.com/jonipwi/go-chat-client/commands"
+	"github.com/jonipwi/go-chat-client/config"
+	"github.com/jonipwi/go-chat-client/socketiotest"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+		err      string
+	}{
+		{"", nil, ""},
+		{"  one two  ", []string{"one", "two"}, ""},
+		{`"stand-up meeting" 10m`, []string{"stand-up meeting", "10m"}, ""},
+		{`it's\ fine 'a "b"' ""`, []string{"it's fine", `a "b"`, ""}, ""},
+		{`don't "stop now"`, []string{"don't", "stop now"}, ""},
+		{`"open`, nil, "unterminated quote"},
+		{`trailing\`, nil, "nothing to escape"},
+	}
+	for _, test := range tests {
+		args, err := SplitArgs(test.input)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("SplitArgs(%q) error = %v; expected %q", test.input, err, test.err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(args, test.expected) {
+			t.Errorf("SplitArgs(%q) = %q, %v; expected %q", test.input, args, err, test.expected)
+		}
+	}
+}
+
+// newBot starts a fake server and a bot called helper connected to it, with
+// the user ID u-alice as admin. setup registers the bot's handlers before it runs.
+func newBot(t *testing.T, setup func(b *Bot)) *socketiotest.Server {
+	t.Helper()
+	srv := socketiotest.NewServer()
+	t.Cleanup(srv.Close)
+
+	cfg := config.Default()
+	srv.Configure(&cfg)
+	cfg.Username = "helper"
+	cfg.ConnectRetries = 1
+	cfg.Bot.Admins = []string{"u-alice"}
+	cfg.Bot.Cooldown = config.Duration{Duration: time.Minute}
+	client, err := chatclient.New(cfg)
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	b := New(client)
+	setup(b)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		b.Run(ctx)
+	}()
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() error: %v", err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		client.Close()
+	})
+	if _, err := srv.WaitConns(1, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	return srv
+}
+
+// from is a chat message object from the user with the given ID
+func from(sender, id, content string) map[string]string {
+	return map[string]string{"sender": sender, "sender_id": id, "content": content}
+}
+
+// step is a message the server sends the bot, and the reply it expects
+type step struct {
+	event string        // Event carrying the message
+	args  []interface{} // Its arguments
+	reply string        // Event the bot should answer with, empty for none
+	want  []string      // Leading arguments of the reply
+}
+
+// replyEvents are the events a bot answers with
+var replyEvents = []string{"global_message", "group_message", "guild_message", "private_message"}
+
+// play sends each step's message and checks the bot's reply. A step expecting
+// no reply is checked by the reply to the next step arriving first.
+func play(t *testing.T, srv *socketiotest.Server, steps []step) {
+	t.Helper()
+	counts := func() map[string]int {
+		n := make(map[string]int)
+		for _, name := range replyEvents {
+			n[name] = len(srv.EventsNamed(name))
+		}
+		return n
+	}
+
+	before := counts()
+	for i, s := range steps {
+		srv.Emit(s.event, s.args...)
+		if s.reply == "" {
+			continue
+		}
+		received, err := srv.WaitEvents(s.reply, before[s.reply]+1, 5*time.Second)
+		if err != nil {
+			t.Fatalf("Step %d %v: %v", i, s.args, err)
+		}
+		after := counts()
+		after[s.reply]--
+		if !reflect.DeepEqual(after, before) {
+			t.Errorf("Step %d %v: expected only a %s reply, sent %v before", i, s.args, s.reply, after)
+		}
+		e := received[before[s.reply]]
+		for j, arg := range s.want {
+			if e.StringArg(j) != arg {
+				t.Errorf("Step %d %v: argument %d of %s = %q; expected %q", i, s.args, j, s.reply, e.StringArg(j), arg)
+			}
+		}
+		before = counts()
+	}
+}
+
+func TestCommands(t *testing.T) {
+	srv := newBot(t, func(b *Bot) {
+		b.MustRegister(&Command{Name: "echo", Aliases: []string{"e"}, Usage: "<text>", Description: "Repeat the text", Args: commands.ArgSpec{Min: 1, Max: -1}, Cooldown: -1, Handler: func(ctx *Context) {
+			ctx.Reply(strings.Join(ctx.Args, "|"))
+		}})
+		b.MustRegister(&Command{Name: "say", Usage: "<text>", Description: "Talk in global chat", Args: commands.ArgSpec{Min: 1, Max: 1}, Admin: true, Handler: func(ctx *Context) {
+			ctx.Bot().Client().SendGlobal(ctx.Args[0])
+		}})
+		b.MustRegister(&Command{Name: "whisper", Description: "Answer privately", Handler: func(ctx *Context) {
+			ctx.ReplyPrivate("psst")
+		}})
+		b.MustRegister(&Command{Name: "panic", Description: "Fail", Cooldown: -1, Handler: func(ctx *Context) {
+			panic("boom")
+		}})
+	})
+
+	play(t, srv, []step{
+		{"chat message", []interface{}{"bob", `!echo "a b" c`}, "global_message", []string{"a b|c"}},
+		{"group message", []interface{}{"room-1", "bob", "!e hi"}, "group_message", []string{"room-1", "hi"}},
+		{"guild message", []interface{}{"guild-1", "bob", "!echo hi"}, "guild_message", []string{"guild-1", "hi"}},
+		{"private message", []interface{}{map[string]string{"sender": "bob", "content": "!echo hi"}}, "private_message", []string{"bob", "hi"}},
+		{"group message", []interface{}{"room-1", "bob", "!whisper"}, "private_message", []string{"bob", "psst"}},
+		{"chat message", []interface{}{"bob", "!echo"}, "global_message", []string{"Usage: !echo <text>"}},
+		{"chat message", []interface{}{"bob", `!echo "open`}, "global_message", []string{"❌ unterminated quote"}},
+		{"chat message", []interface{}{"bob", "!say hi"}, "global_message", []string{"⛔ !say is for admins only"}},
+		{"chat message", []interface{}{from("alice", "u-alice", "!say hi")}, "global_message", []string{"hi"}},
+		// Taking an admin's name is not enough
+		{"chat message", []interface{}{"alice", "!say hi"}, "global_message", []string{"⛔ !say is for admins only"}},
+		{"chat message", []interface{}{from("alice", "u-bob", "!say hi")}, "global_message", []string{"⛔ !say is for admins only"}},
+		// Own messages, unknown commands and panics get no reply
+		{"chat message", []interface{}{"helper", "!echo loop"}, "", nil},
+		{"chat message", []interface{}{"bob", "!nope"}, "", nil},
+		{"chat message", []interface{}{"bob", "!panic"}, "", nil},
+		{"chat message", []interface{}{"bob", "!help echo"}, "global_message", []string{"!echo <text> - Repeat the text"}},
+		{"chat message", []interface{}{"bob", "!help say"}, "global_message", []string{"Unknown command say"}},
+	})
+
+	// Admin commands are only listed for admins
+	play(t, srv, []step{
+		{"chat message", []interface{}{"bob", "!help"}, "global_message", nil},
+	})
+	help := srv.EventsNamed("global_message")
+	if text := help[len(help)-1].StringArg(0); !strings.Contains(text, "!whisper - Answer privately") || strings.Contains(text, "!say") {
+		t.Errorf("!help for bob = %q", text)
+	}
+	play(t, srv, []step{
+		{"chat message", []interface{}{from("alice", "u-alice", "!help")}, "global_message", nil},
+	})
+	help = srv.EventsNamed("global_message")
+	if text := help[len(help)-1].StringArg(0); !strings.Contains(text, "!say <text> - Talk in global chat") {
+		t.Errorf("!help for alice = %q", text)
+	}
+}
+
+func TestCooldown(t *testing.T) {
+	srv := newBot(t, func(b *Bot) {
+		b.MustRegister(&Command{Name: "echo", Args: commands.ArgSpec{Min: 1, Max: 1}, Handler: func(ctx *Context) {
+			ctx.Reply(ctx.Args[0])
+		}})
+		b.MustRegister(&Command{Name: "quick", Args: commands.ArgSpec{Min: 1, Max: 1}, Cooldown: -1, Handler: func(ctx *Context) {
+			ctx.Reply(ctx.Args[0])
+		}})
+	})
+
+	play(t, srv, []step{
+		{"chat message", []interface{}{from("bob", "u-bob", "!echo one")}, "global_message", []string{"one"}},
+		{"chat message", []interface{}{from("bob", "u-bob", "!echo two")}, "global_message", []string{"⏳ Please wait 1m0s before using !echo again"}},
+		{"chat message", []interface{}{from("bob", "u-bob", "!echo three")}, "", nil}, // Told once is enough
+		{"chat message", []interface{}{from("bobby", "u-bob", "!echo renamed")}, "", nil},
+		{"chat message", []interface{}{from("bob", "u-carol", "!echo four")}, "global_message", []string{"four"}},
+		{"chat message", []interface{}{from("bob", "u-bob", "!quick five")}, "global_message", []string{"five"}},
+		{"chat message", []interface{}{from("bob", "u-bob", "!quick six")}, "global_message", []string{"six"}},
+		{"chat message", []interface{}{from("alice", "u-alice", "!echo seven")}, "global_message", []string{"seven"}},
+		{"chat message", []interface{}{from("alice", "u-alice", "!echo eight")}, "global_message", []string{"eight"}},
+		// Senders without an ID share a cooldown, whatever their name
+		{"chat message", []interface{}{"dave", "!echo nine"}, "global_message", []string{"nine"}},
+		{"chat message", []interface{}{"erin", "!echo ten"}, "global_message", []string{"⏳ Please wait 1m0s before using !echo again"}},
+	})
+}
+
+func TestTriggers(t *testing.T) {
+	srv := newBot(t, func(b *Bot) {
+		b.Handle(Trigger{Pattern: regexp.MustCompile(`^deploy (\w+)$`), Rooms: []string{"global", "room-1"}}, func(ctx *Context) {
+			ctx.Replyf("deploying %s from %s", ctx.Match[1], ctx.Room())
+		})
+		b.Handle(Trigger{Mention: true}, func(ctx *Context) {
+			ctx.Reply("you called?")
+		})
+		b.MustRegister(&Command{Name: "ping", Cooldown: -1, Handler: func(ctx *Context) {
+			ctx.Reply("pong helper")
+		}})
+	})
+
+	play(t, srv, []step{
+		{"chat message", []interface{}{"bob", "deploy api"}, "global_message", []string{"deploying api from global"}},
+		{"group message", []interface{}{"room-1", "bob", "deploy web"}, "group_message", []string{"room-1", "deploying web from room-1"}},
+		{"group message", []interface{}{"room-2", "bob", "deploy web"}, "", nil},
+		{"chat message", []interface{}{"bob", "please deploy api"}, "", nil},
+		{"private message", []interface{}{map[string]string{"sender": "bob", "content": "@helper are you there?"}}, "private_message", []string{"bob", "you called?"}},
+		{"chat message", []interface{}{"bob", "helpers"}, "", nil},
+		// Commands do not run triggers, even when they mention the bot
+		{"chat message", []interface{}{"bob", "!ping helper"}, "global_message", []string{"Usage: !ping"}},
+		{"chat message", []interface{}{"bob", "!ping"}, "global_message", []string{"pong helper"}},
+	})
+}
@@ -0,0 +1,97 @@
+// run.go
+package bot
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jonipwi/go-chat-client/chatclient"
+	"github.com/jonipwi/go-chat-client/config"
+	"github.com/jonipwi/go-chat-client/utils"
+)
+
+// shutdownTimeout bounds how long Main waits for the clients and bots to stop
+const shutdownTimeout = 5 * time.Second
+
+// Main runs a bot program. It takes its settings from the flags, the
+// environment and the config file like the interactive client, creates a
+// bot for each configured server and calls setup to register its commands
+// and triggers, then answers messages until SIGINT or SIGTERM.
+//
+//	func main() {
+//		bot.Main(func(b *bot.Bot) {
+//			b.MustRegister(&bot.Command{Name: "ping", Handler: func(ctx *bot.Context) { ctx.Reply("pong") }})
+//		})
+//	}
+func Main(setup func(b *Bot)) {
+	os.Exit(run(os.Args[1:], setup))
+}
+
+// run is Main returning the exit code, so deferred calls run first
+func run(args []string, setup func(b *Bot)) int {
+	cfg, err := config.Load(args, os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		config.Usage(os.Stdout)
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration error: %v\n\n", err)
+		config.Usage(os.Stderr)
+		return 2
+	}
+	if err := utils.ConfigureLogging(cfg.LogOptions()); err != nil {
+		fmt.Fprintf(os.Stderr, "Logging error: %v\n", err)
+		return 1
+	}
+	defer utils.CloseLog()
+
+	servers, err := chatclient.NewServers(cfg)
+	if err != nil {
+		logger.Error("Invalid settings", "error", err)
+		return 1
+	}
+
+	// SIGINT and SIGTERM stop the bots and disconnect
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// The bots subscribe before connecting so they see every message
+	var bots sync.WaitGroup
+	for _, client := range servers.Clients() {
+		b := New(client)
+		setup(b)
+		bots.Add(1)
+		go func() {
+			defer bots.Done()
+			b.Run(ctx)
+		}()
+	}
+
+	code := 0
+	logger.Info("Starting bot", "username", cfg.Username, "servers", len(servers.Clients()))
+	if err := servers.Connect(ctx); err != nil && ctx.Err() == nil {
+		logger.Error("Failed on initial connection to server", "error", err)
+		code = 1
+	} else {
+		<-ctx.Done()
+		logger.Info("Received signal, shutting down")
+	}
+
+	stop()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := servers.Shutdown(shutdownCtx); err != nil {
+		logger.Warn("Client did not shut down cleanly", "error", err)
+	}
+	if err := utils.Wait(shutdownCtx, &bots); err != nil {
+		logger.Warn("Bots did not stop in time", "error", err)
+	}
+	return code
+}
@@ -0,0 +1,472 @@
+// chatclient.go
+package chatclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/jonipwi/go-chat-client/auth"
+	"github.com/jonipwi/go-chat-client/config"
+	"github.com/jonipwi/go-chat-client/events"
+	"github.com/jonipwi/go-chat-client/server_connection"
+	"github.com/jonipwi/go-chat-client/state"
+	"github.com/jonipwi/go-chat-client/utils"
+)
+
+// Room kinds accepted by CreateRoom and ListRooms
+const (
+	RoomGroup = events.TypeGroup
+	RoomGuild = events.TypeGuild
+)
+
+// ErrTimedOut is returned when the server does not answer a request in time
+var ErrTimedOut = errors.New("request timed out")
+
+// RequestError is returned when the server rejects a request
+type RequestError struct {
+	Event  string
+	Reason string
+}
+
+// Error implements error
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("%s rejected: %s", e.Event, e.Reason)
+}
+
+// logger logs the client's lifecycle
+var logger = utils.Log(utils.ComponentClient)
+
+// Client is a chat client that can be embedded in other programs. It keeps
+// the connection alive with heartbeats, reconnects when it drops and queues
+// messages sent while offline. It is safe for concurrent use.
+//
+//	client, err := chatclient.New(cfg)
+//	...
+//	stop := client.OnMessage(func(msg events.Message) { ... })
+//	defer stop()
+//	if err := client.Connect(ctx); err != nil { ... }
+//	defer client.Close()
+//	err = client.JoinRoom(ctx, "room-1")
+type Client struct {
+	cfg    config.Config
+	state  *state.ClientState
+	router *events.Router
+	tokens *auth.Source
+	log    *slog.Logger // Logs with the server name
+
+	mu          sync.Mutex
+	subscribers []subscriber
+	nextID      int
+	started     bool
+	listMu      sync.Mutex // One room list request at a time, the reply carries no request ID
+
+	// Background goroutines run until Shutdown cancels ctx
+	ctx  context.Context
+	stop context.CancelFunc
+	wg   sync.WaitGroup
+}
+
+// DefaultShutdownTimeout is how long Close waits for the client to shut down
+const DefaultShutdownTimeout = 5 * time.Second
+
+// ErrClosed is returned when connecting a client that was shut down
+var ErrClosed = errors.New("client is closed")
+
+// subscriber is a function registered with OnEvent
+type subscriber struct {
+	id int
+	fn func(events.Event)
+}
+
+// New creates a client for cfg. It does not connect until Connect is called.
+func New(cfg config.Config) (*Client, error) {
+	transport, err := server_connection.NewTransport(cfg.TLS)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TLS settings: %w", err)
+	}
+	tokens, err := auth.FromConfig(cfg, transport.HTTPClient(auth.LoginTimeout))
+	if err != nil {
+		return nil, fmt.Errorf("invalid auth settings: %w", err)
+	}
+	clientState := state.NewClientState(cfg.Username)
+	c := &Client{
+		cfg:    cfg,
+		state:  clientState,
+		router: events.NewRouter(clientState),
+		tokens: tokens,
+		log:    logger,
+	}
+	if cfg.Name != "" {
+		c.log = logger.With("server", cfg.Name)
+	}
+	c.ctx, c.stop = context.WithCancel(context.Background())
+	c.router.Subscribe(c.publish)
+	return c, nil
+}
+
+// Name returns the name of the server profile the client connects to
+func (c *Client) Name() string {
+	return c.cfg.Name
+}
+
+// Config returns the settings the client was created with
+func (c *Client) Config() config.Config {
+	return c.cfg
+}
+
+// State returns the client's connection state and counters
+func (c *Client) State() *state.ClientState {
+	return c.state
+}
+
+// Router returns the router decoding the client's incoming events
+func (c *Client) Router() *events.Router {
+	return c.router
+}
+
+// Connect connects to the server, retrying up to cfg.ConnectRetries times,
+// and starts the heartbeat, the token refresher and the reconnection
+// supervisor. Retries stop when ctx is done.
+func (c *Client) Connect(ctx context.Context) error {
+	if c.ctx.Err() != nil {
+		return ErrClosed
+	}
+	if _, err := server_connection.ConnectToServer(ctx, c.cfg, c.state, c.router, c.tokens); err != nil {
+		return err
+	}
+	c.startBackground()
+	c.log.Info("Client ready", "username", c.state.GetUsername())
+	return nil
+}
+
+// startBackground starts the goroutines keeping the connection alive, once
+func (c *Client) startBackground() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.started {
+		return
+	}
+	c.started = true
+
+	if c.tokens != nil {
+		c.goBackground(c.tokens.Run)
+	}
+	c.goBackground(func(ctx context.Context) {
+		server_connection.StartHeartbeat(ctx, c.state, c.cfg.HeartbeatInterval.Duration)
+	})
+	supervisor := server_connection.NewSupervisor(c.cfg, c.state, c.router, c.tokens, server_connection.DefaultReconnectPolicy())
+	c.goBackground(supervisor.Run)
+}
+
+// retryInBackground starts the background goroutines of a client whose
+// first connection failed, so the supervisor keeps trying to connect
+func (c *Client) retryInBackground(reason string) {
+	if c.ctx.Err() != nil {
+		return
+	}
+	c.startBackground()
+	c.state.RequestReconnect(reason)
+}
+
+// goBackground runs fn on a new goroutine that Shutdown stops and waits for
+func (c *Client) goBackground(fn func(ctx context.Context)) {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		fn(c.ctx)
+	}()
+}
+
+// Shutdown disconnects gracefully: it stops the heartbeat and reconnects,
+// sends the messages still waiting in the outbox, leaves the joined rooms,
+// disconnects and waits for the background goroutines to finish. If ctx
+// ends first, Shutdown returns its error; the goroutines still stop shortly after.
+func (c *Client) Shutdown(ctx context.Context) error {
+	c.stop()
+
+	if c.state.IsConnected() {
+		if pending := c.state.Outbox().Len(); pending > 0 {
+			sent, err := c.state.FlushOutbox()
+			if err != nil {
+				c.log.Warn("Failed to flush outbox on shutdown", "sent", sent, "queued", pending, "error", err)
+			} else {
+				c.log.Info("Flushed outbox on shutdown", "sent", sent)
+			}
+		}
+		c.leaveRooms()
+	}
+	c.state.CloseConnection()
+
+	if err := utils.Wait(ctx, &c.wg); err != nil {
+		return fmt.Errorf("waiting for background goroutines: %w", err)
+	}
+	c.log.Info("Client shut down")
+	return nil
+}
+
+// Close shuts the client down, waiting up to DefaultShutdownTimeout
+func (c *Client) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultShutdownTimeout)
+	defer cancel()
+	return c.Shutdown(ctx)
+}
+
+// leaveRooms tells the server the client is leaving each joined room. The
+// memberships are kept, so a client connecting again can rejoin them.
+func (c *Client) leaveRooms() {
+	client := c.state.Client()
+	if client == nil {
+		return
+	}
+	for _, room := range c.state.GetJoinedRooms() {
+		if err := client.Emit("leave_room", room); err != nil {
+			c.state.TrackEmitFailure("leave_room")
+			c.log.Warn("Failed to leave room", "room", room, "error", err)
+		}
+	}
+}
+
+// SendGlobal sends a message to global chat. It reports whether the message
+// was queued because the client is offline; queued messages are sent on reconnect.
+func (c *Client) SendGlobal(text string) (bool, error) {
+	return c.state.Send("global_message", text)
+}
+
+// SendToRoom sends a message to a group or guild, or to global chat when
+// room is empty, using the event that matches the room's type. Rooms the
+// client knows nothing about yet are treated as groups. It reports whether
+// the message was queued.
+func (c *Client) SendToRoom(room, text string) (bool, error) {
+	return c.state.SendToRoom(room, text)
+}
+
+// SendChat sends a message to the room in focus, or to global chat if none is
+func (c *Client) SendChat(text string) (bool, error) {
+	return c.state.SendToRoom(c.state.GetCurrentRoom(), text)
+}
+
+// SendPrivate sends a private message and waits for the server to confirm
+// delivery. It reports whether the message was queued instead, in which case
+// it returns straight away without a confirmation.
+func (c *Client) SendPrivate(ctx context.Context, user, text string) (bool, error) {
+	req, queued, err := c.state.SendRequest("private_message", user, text)
+	if err != nil || req == nil {
+		return queued, err
+	}
+	return false, wait(ctx, req)
+}
+
+// JoinRoom joins a room, makes it the current room and waits for the
+// server's confirmation
+func (c *Client) JoinRoom(ctx context.Context, room string) error {
+	req, err := c.state.JoinRoom(room)
+	if err != nil {
+		return err
+	}
+	return wait(ctx, req)
+}
+
+// CreateRoom creates a room of the given kind, RoomGroup or RoomGuild, and
+// waits for the server's confirmation
+func (c *Client) CreateRoom(ctx context.Context, kind, name string) error {
+	if kind != RoomGroup && kind != RoomGuild {
+		return fmt.Errorf("unknown room kind %q", kind)
+	}
+	req, err := c.state.CreateRoom(kind, name)
+	if err != nil {
+		return err
+	}
+	return wait(ctx, req)
+}
+
+// ListRooms asks the server for the rooms of the given kind and waits for
+// the list. Without a deadline on ctx it gives up after state.DefaultRequestTimeout.
+func (c *Client) ListRooms(ctx context.Context, kind string) ([]events.Room, error) {
+	if kind != RoomGroup && kind != RoomGuild {
+		return nil, fmt.Errorf("unknown room kind %q", kind)
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, state.DefaultRequestTimeout)
+		defer cancel()
+	}
+
+	c.listMu.Lock()
+	defer c.listMu.Unlock()
+
+	lists := make(chan []events.Room, 1)
+	stop := c.OnEvent(func(e events.Event) {
+		if e.Name != "room list" {
+			return
+		}
+		select {
+		case lists <- e.Rooms:
+		default:
+		}
+	})
+	defer stop()
+
+	client := c.state.Client()
+	if !c.state.IsConnected() || client == nil {
+		return nil, fmt.Errorf("not connected")
+	}
+	if err := client.Emit("list_rooms", kind); err != nil {
+		c.state.TrackEmitFailure("list_rooms")
+		return nil, err
+	}
+
+	select {
+	case rooms := <-lists:
+		return rooms, nil
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, ErrTimedOut
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// Rooms returns what the server has told the client about each room: the
+// rooms listed, joined, created or messaged so far
+func (c *Client) Rooms() []events.Room {
+	return c.state.Rooms().List()
+}
+
+// Online returns the users the server reported online in room, or in
+// global chat if room is empty, sorted by name. Rosters are cleared while
+// disconnected.
+func (c *Client) Online(room string) []events.User {
+	return c.state.Presence().Online(room)
+}
+
+// IsOnline reports whether the user with the given ID or username is online
+func (c *Client) IsOnline(user string) bool {
+	return c.state.Presence().IsOnline(user)
+}
+
+// SwitchRoom brings a joined room into focus, or global chat if room is
+// empty or "global", so SendChat sends to it. It returns what was unread in
+// the room, which is now marked read.
+func (c *Client) SwitchRoom(room string) (state.UnreadCount, error) {
+	return c.state.SwitchRoom(room)
+}
+
+// Unread returns how many messages arrived in room while it was not in
+// focus, and how many of them mention the user. Private conversations are
+// given as state.PrivatePrefix followed by the other user.
+func (c *Client) Unread(room string) state.UnreadCount {
+	return c.state.Unread().Get(room)
+}
+
+// StartTyping tells the server the user is composing a message in room, or
+// in global chat if room is empty. Call it on every keystroke: it is
+// debounced, and "stop typing" follows on its own once the keystrokes stop
+// or a message is sent to a room.
+func (c *Client) StartTyping(room string) {
+	c.state.Typing().Keystroke(room)
+}
+
+// StopTyping tells the server the user stopped composing, if they were
+func (c *Client) StopTyping() {
+	c.state.Typing().Stop()
+}
+
+// Typists returns the names of the other users typing in room, or in global
+// chat if room is empty, sorted
+func (c *Client) Typists(room string) []string {
+	return c.state.Typing().Typists(room)
+}
+
+// OnEvent registers fn to be called with every event received from the
+// server, on the goroutine that received it. The returned function removes it.
+func (c *Client) OnEvent(fn func(events.Event)) func() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id := c.nextID
+	c.nextID++
+	c.subscribers = append(c.subscribers, subscriber{id: id, fn: fn})
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for i, sub := range c.subscribers {
+			if sub.id == id {
+				c.subscribers = append(c.subscribers[:i:i], c.subscribers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// OnMessage registers fn to be called with every chat message received.
+// The returned function removes it.
+func (c *Client) OnMessage(fn func(events.Message)) func() {
+	return c.OnEvent(func(e events.Event) {
+		if e.Message != nil {
+			fn(*e.Message)
+		}
+	})
+}
+
+// Messages returns a channel receiving every chat message, holding up to
+// buffer messages the reader has not taken yet. Messages arriving while the
+// buffer is full are dropped rather than holding up the connection. The
+// returned function unsubscribes and closes the channel.
+func (c *Client) Messages(buffer int) (<-chan events.Message, func()) {
+	ch := make(chan events.Message, buffer)
+	var mu sync.Mutex
+	closed := false
+
+	stop := c.OnMessage(func(msg events.Message) {
+		mu.Lock()
+		defer mu.Unlock()
+		if closed {
+			return
+		}
+		select {
+		case ch <- msg:
+		default:
+			c.log.Warn("Message channel full, dropping message", "type", msg.Type, "room", msg.Room)
+		}
+	})
+	return ch, func() {
+		stop()
+		mu.Lock()
+		defer mu.Unlock()
+		if !closed {
+			closed = true
+			close(ch)
+		}
+	}
+}
+
+// publish passes an event from the router on to the subscribers
+func (c *Client) publish(e events.Event) {
+	c.mu.Lock()
+	subscribers := c.subscribers
+	c.mu.Unlock()
+
+	for _, sub := range subscribers {
+		sub.fn(e)
+	}
+}
+
+// wait blocks until req is answered or ctx ends, and turns the answer into an error
+func wait(ctx context.Context, req *state.Request) error {
+	select {
+	case <-req.Done():
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	result := req.Wait()
+	switch result.Status {
+	case state.RequestRejected:
+		return &RequestError{Event: req.Event, Reason: result.Error}
+	case state.RequestTimedOut:
+		return ErrTimedOut
+	}
+	return nil
+}
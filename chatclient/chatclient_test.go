@@ -0,0 +1,451 @@
+package chatclient
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/jonipwi/go-chat-client/config"
+	"github.com/jonipwi/go-chat-client/events"
+	"github.com/jonipwi/go-chat-client/socketiotest"
+	"github.com/jonipwi/go-chat-client/state"
+)
+
+func newTestClient(t *testing.T) *Client {
+	t.Helper()
+	c, err := New(config.Default())
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	return c
+}
+
+func TestSubscriptions(t *testing.T) {
+	c := newTestClient(t)
+
+	var got []string
+	stopEvents := c.OnEvent(func(e events.Event) { got = append(got, e.Name) })
+	messages, stopMessages := c.Messages(1)
+
+	msg := events.Message{Type: events.TypeGlobal, Sender: "alice", Content: "hi"}
+	c.publish(events.Event{Name: "chat message", Message: &msg})
+	c.publish(events.Event{Name: "chat message", Message: &msg}) // Dropped, the channel is full
+	stopEvents()
+	c.publish(events.Event{Name: "heartbeat"})
+
+	if len(got) != 2 {
+		t.Errorf("OnEvent saw %v; expected the 2 events before it was stopped", got)
+	}
+	if m := <-messages; m != msg {
+		t.Errorf("Messages() delivered %+v; expected %+v", m, msg)
+	}
+
+	stopMessages()
+	if _, ok := <-messages; ok {
+		t.Error("Expected the channel to be closed after unsubscribing")
+	}
+	stopMessages() // Safe to call twice
+}
+
+func TestOfflineSends(t *testing.T) {
+	c := newTestClient(t)
+
+	queued, err := c.SendGlobal("hello")
+	if err != nil || !queued {
+		t.Errorf("SendGlobal() = %v, %v; expected the message to be queued", queued, err)
+	}
+	queued, err = c.SendPrivate(context.Background(), "bob", "psst")
+	if err != nil || !queued {
+		t.Errorf("SendPrivate() = %v, %v; expected the message to be queued", queued, err)
+	}
+	if items := c.State().Outbox().Items(); len(items) != 2 || items[1].Event != "private_message" {
+		t.Errorf("Unexpected outbox %v", items)
+	}
+
+	if err := c.JoinRoom(context.Background(), "room-1"); err == nil {
+		t.Error("Expected JoinRoom to fail while offline")
+	}
+	if _, err := c.ListRooms(context.Background(), RoomGroup); err == nil {
+		t.Error("Expected ListRooms to fail while offline")
+	}
+	if err := c.CreateRoom(context.Background(), "channel", "x"); err == nil {
+		t.Error("Expected an unknown room kind to be rejected")
+	}
+}
+
+func TestWait(t *testing.T) {
+	requests := state.NewRequests(time.Minute)
+
+	rejected := requests.Track("join_room")
+	requests.Resolve(rejected.ID, state.RequestResult{Status: state.RequestRejected, Error: "room is full"})
+	var reqErr *RequestError
+	if err := wait(context.Background(), rejected); !errors.As(err, &reqErr) || reqErr.Reason != "room is full" {
+		t.Errorf("wait() = %v; expected a RequestError", err)
+	}
+
+	timedOut := requests.Track("join_room")
+	requests.Resolve(timedOut.ID, state.RequestResult{Status: state.RequestTimedOut})
+	if err := wait(context.Background(), timedOut); !errors.Is(err, ErrTimedOut) {
+		t.Errorf("wait() = %v; expected ErrTimedOut", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := wait(ctx, requests.Track("join_room")); !errors.Is(err, context.Canceled) {
+		t.Errorf("wait() = %v; expected the context error", err)
+	}
+}
+
+func TestShutdownStopsGoroutines(t *testing.T) {
+	srv := socketiotest.NewServer()
+	defer srv.Close()
+	before := runtime.NumGoroutine()
+
+	cfg := config.Default()
+	srv.Configure(&cfg)
+	cfg.ConnectRetries = 1
+	cfg.HeartbeatInterval = config.Duration{Duration: 10 * time.Millisecond}
+	c, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() error: %v", err)
+	}
+	conns, err := srv.WaitConns(1, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conns[0].Emit("connect", conns[0].ID())
+	if _, err := srv.WaitEvent("client_heartbeat", 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := c.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() error: %v", err)
+	}
+
+	// Goroutines may take a moment to be reaped after they return
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		buf := make([]byte, 1<<16)
+		t.Fatalf("%d goroutine(s) leaked:\n%s", after-before, buf[:runtime.Stack(buf, true)])
+	}
+	select {
+	case <-conns[0].Done():
+	default:
+		t.Error("Expected the server to see the connection closed")
+	}
+
+	if err := c.Connect(context.Background()); !errors.Is(err, ErrClosed) {
+		t.Errorf("Connect() after Shutdown = %v; expected ErrClosed", err)
+	}
+}
+
+// newServer starts a fake chat server that answers joins, private messages
+// and room lists, and returns it with a client connected to it
+func newServer(t *testing.T) (*socketiotest.Server, *Client) {
+	t.Helper()
+	srv := socketiotest.NewServer()
+	t.Cleanup(srv.Close)
+
+	srv.Handle("join_room", func(conn *socketiotest.Conn, e socketiotest.Event) []interface{} {
+		room := e.StringArg(0)
+		if room == "full" {
+			return socketiotest.Reject("room is full")
+		}
+		conn.Emit("room joined", map[string]string{"id": room, "name": room, "type": RoomGroup})
+		return nil
+	})
+	srv.Handle("list_rooms", func(conn *socketiotest.Conn, e socketiotest.Event) []interface{} {
+		conn.Emit("room list", e.StringArg(0), []map[string]string{{"id": "room-1"}, {"id": "room-2"}})
+		return nil
+	})
+
+	cfg := config.Default()
+	srv.Configure(&cfg)
+	cfg.Username = "alice"
+	cfg.ConnectRetries = 1
+	c, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() error: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return srv, c
+}
+
+func TestClientAgainstServer(t *testing.T) {
+	srv, c := newServer(t)
+	ctx := context.Background()
+	messages, stop := c.Messages(10)
+	defer stop()
+
+	if err := c.JoinRoom(ctx, "room-1"); err != nil {
+		t.Fatalf("JoinRoom() error: %v", err)
+	}
+	var reqErr *RequestError
+	if err := c.JoinRoom(ctx, "full"); !errors.As(err, &reqErr) || reqErr.Reason != "room is full" {
+		t.Errorf("JoinRoom(full) = %v; expected the server's rejection", err)
+	}
+	if room := c.State().GetCurrentRoom(); room != "room-1" {
+		t.Errorf("Current room = %q; expected the rejected join to be undone", room)
+	}
+
+	if queued, err := c.SendChat("hello room"); err != nil || queued {
+		t.Fatalf("SendChat() = %v, %v; expected the message to be sent", queued, err)
+	}
+	sent, err := srv.WaitEvent("group_message", 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent.StringArg(0) != "room-1" || sent.StringArg(1) != "hello room" {
+		t.Errorf("Server received group_message %v; expected it for room-1", sent.Args)
+	}
+
+	if queued, err := c.SendPrivate(ctx, "bob", "psst"); err != nil || queued {
+		t.Errorf("SendPrivate() = %v, %v; expected it to be delivered", queued, err)
+	}
+
+	rooms, err := c.ListRooms(ctx, RoomGroup)
+	if err != nil {
+		t.Fatalf("ListRooms() error: %v", err)
+	}
+	if len(rooms) != 2 || rooms[1].ID != "room-2" {
+		t.Errorf("ListRooms() = %+v; expected room-1 and room-2", rooms)
+	}
+
+	srv.Emit("private message", map[string]string{"sender": "bob", "content": "hi alice"})
+	select {
+	case msg := <-messages:
+		if msg.Type != events.TypePrivate || msg.Sender != "bob" || msg.Content != "hi alice" {
+			t.Errorf("Received %+v; expected bob's private message", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the private message")
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+	left, err := srv.WaitEvent("leave_room", 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if left.StringArg(0) != "room-1" {
+		t.Errorf("Left %q on shutdown; expected room-1", left.StringArg(0))
+	}
+}
+
+func TestRequestDeadlineWithLatency(t *testing.T) {
+	srv, c := newServer(t)
+	srv.SetLatency(time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.JoinRoom(ctx, "room-1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("JoinRoom() = %v; expected the deadline to pass before the slow server answers", err)
+	}
+	if _, err := c.ListRooms(ctx, RoomGroup); !errors.Is(err, ErrTimedOut) {
+		t.Errorf("ListRooms() = %v; expected ErrTimedOut", err)
+	}
+}
+
+func TestRoomTypesFromServer(t *testing.T) {
+	srv, c := newServer(t)
+	ctx := context.Background()
+
+	// The list carries no types, they come from the kind that was requested
+	if _, err := c.ListRooms(ctx, RoomGuild); err != nil {
+		t.Fatalf("ListRooms() error: %v", err)
+	}
+	if err := c.CreateRoom(ctx, RoomGuild, "builders"); err != nil {
+		t.Fatalf("CreateRoom() error: %v", err)
+	}
+	if err := c.JoinRoom(ctx, "room-9"); err != nil {
+		t.Fatalf("JoinRoom() error: %v", err)
+	}
+	// "room joined" is pushed after the acknowledgement
+	if !socketiotest.WaitUntil(5*time.Second, func() bool { return c.State().Rooms().Type("room-9") != "" }) {
+		t.Fatal("Expected the room joined event to record the room type")
+	}
+
+	sends := []struct {
+		room, event string
+	}{
+		{"room-2", "guild_message"},
+		{"builders", "guild_message"},
+		{"room-9", "group_message"},
+	}
+	for _, send := range sends {
+		before := len(srv.EventsNamed(send.event))
+		if _, err := c.SendToRoom(send.room, "hi"); err != nil {
+			t.Fatalf("SendToRoom(%s) error: %v", send.room, err)
+		}
+		received, err := srv.WaitEvents(send.event, before+1, 5*time.Second)
+		if err != nil {
+			t.Fatalf("SendToRoom(%s): %v", send.room, err)
+		}
+		if received[before].StringArg(0) != send.room {
+			t.Errorf("SendToRoom(%s) sent %s to %q", send.room, send.event, received[before].StringArg(0))
+		}
+	}
+
+	if rooms := c.Rooms(); len(rooms) != 4 {
+		t.Errorf("Rooms() = %+v; expected the 2 listed, the created and the joined room", rooms)
+	}
+}
+
+func TestPresenceFromServer(t *testing.T) {
+	srv, c := newServer(t)
+	notices := make(chan events.Event, 10)
+	stop := c.OnEvent(func(e events.Event) {
+		if e.Name == "user joined" || e.Name == "user left" {
+			notices <- e
+		}
+	})
+	defer stop()
+
+	// Connect can return before the server has finished upgrading the connection
+	if _, err := srv.WaitConns(1, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	srv.Emit("user list", []map[string]string{{"id": "u-1", "username": "alice"}, {"id": "u-2", "username": "bob"}})
+	srv.Emit("user list", "room-1", []string{"bob"})
+	srv.Emit("user joined", map[string]string{"id": "u-3", "username": "carol"}, "room-1")
+	srv.Emit("user left", "alice")
+
+	if !socketiotest.WaitUntil(5*time.Second, func() bool { return len(notices) == 2 }) {
+		t.Fatalf("Expected the joined and left events to be published, got %d", len(notices))
+	}
+	if e := <-notices; e.User.Username != "carol" || e.Room == nil || e.Room.ID != "room-1" {
+		t.Errorf("user joined event = %+v; expected carol in room-1", e)
+	}
+
+	if c.IsOnline("alice") || !c.IsOnline("u-2") || !c.IsOnline("carol") {
+		t.Errorf("Online() = %+v; expected bob and carol", c.Online(""))
+	}
+	room := c.Online("room-1")
+	if len(room) != 2 || room[0].ID != "u-2" || room[1].Username != "carol" {
+		t.Errorf("Online(room-1) = %+v; expected bob and carol", room)
+	}
+
+	// Presence is unknown while disconnected
+	srv.DropAll()
+	if !socketiotest.WaitUntil(5*time.Second, func() bool { return !c.IsOnline("bob") }) {
+		t.Error("Expected the roster to be cleared on disconnect")
+	}
+}
+
+func TestTypingIndicators(t *testing.T) {
+	srv, c := newServer(t)
+	if err := c.JoinRoom(context.Background(), "room-1"); err != nil {
+		t.Fatalf("JoinRoom() error: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		c.StartTyping("room-1")
+	}
+	if _, err := c.SendToRoom("room-1", "done"); err != nil {
+		t.Fatalf("SendToRoom() error: %v", err)
+	}
+	if _, err := srv.WaitEvent("group_message", 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	typing, stopped := srv.EventsNamed("typing"), srv.EventsNamed("stop typing")
+	if len(typing) != 1 || typing[0].StringArg(0) != "room-1" {
+		t.Errorf("Expected one typing event for room-1, got %d", len(typing))
+	}
+	if len(stopped) != 1 || stopped[0].StringArg(0) != "room-1" {
+		t.Errorf("Expected sending to stop typing in room-1, got %d stop typing event(s)", len(stopped))
+	}
+
+	srv.Emit("typing", "alice", "room-1") // Our own, echoed back
+	srv.Emit("typing", "bob", "room-1")
+	srv.Emit("typing", map[string]string{"username": "carol"}, "room-1")
+	if !socketiotest.WaitUntil(5*time.Second, func() bool { return len(c.Typists("room-1")) == 2 }) {
+		t.Fatalf("Typists(room-1) = %q; expected bob and carol", c.Typists("room-1"))
+	}
+	srv.Emit("stop typing", "carol", "room-1")
+	srv.Emit("group message", "room-1", "bob", "hi")
+	if !socketiotest.WaitUntil(5*time.Second, func() bool { return len(c.Typists("room-1")) == 0 }) {
+		t.Errorf("Typists(room-1) = %q; expected stop typing and bob's message to clear them", c.Typists("room-1"))
+	}
+}
+
+func TestSwitchBetweenJoinedRooms(t *testing.T) {
+	srv, c := newServer(t)
+	ctx := context.Background()
+	for _, room := range []string{"room-1", "room-2"} {
+		if err := c.JoinRoom(ctx, room); err != nil {
+			t.Fatalf("JoinRoom(%s) error: %v", room, err)
+		}
+	}
+
+	srv.Emit("group message", "room-1", "bob", "alice, are you there?")
+	srv.Emit("group message", "room-2", "bob", "in focus")
+	if !socketiotest.WaitUntil(5*time.Second, func() bool { return c.State().Snapshot().MessagesReceived == 2 }) {
+		t.Fatal("Expected both messages to arrive")
+	}
+	if unread := c.Unread("room-2"); unread.Messages != 0 {
+		t.Errorf("Unread(room-2) = %+v; the room in focus should have nothing unread", unread)
+	}
+
+	unread, err := c.SwitchRoom("room-1")
+	if err != nil || unread != (state.UnreadCount{Messages: 1, Mentions: 1}) {
+		t.Errorf("SwitchRoom(room-1) = %+v, %v; expected one unread mention", unread, err)
+	}
+	if _, err := c.SendChat("yes"); err != nil {
+		t.Fatalf("SendChat() error: %v", err)
+	}
+	e, err := srv.WaitEvent("group_message", 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.StringArg(0) != "room-1" {
+		t.Errorf("SendChat sent to %q; expected the room in focus", e.StringArg(0))
+	}
+	if !c.State().IsInRoom("room-2") {
+		t.Error("Expected switching to keep the other membership")
+	}
+}
+
+func TestSentHooksMayUseState(t *testing.T) {
+	srv, c := newServer(t)
+	var stats []state.Stats
+	c.State().OnSent(func(event string, args []interface{}) {
+		// Runs after the outbox is unlocked, so reading its length is safe
+		stats = append(stats, c.State().Snapshot())
+	})
+	if _, err := c.State().Outbox().Enqueue("global_message", "queued"); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if sent, err := c.State().FlushOutbox(); sent != 1 || err != nil {
+			t.Errorf("FlushOutbox() = %d, %v; expected the queued message to be sent", sent, err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("FlushOutbox deadlocked with a hook reading the state")
+	}
+	if _, err := srv.WaitEvent("global_message", 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 || stats[0].QueuedMessages != 0 {
+		t.Errorf("Hook saw %+v; expected one call after the outbox was flushed", stats)
+	}
+}
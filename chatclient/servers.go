@@ -0,0 +1,197 @@
+// servers.go
+package chatclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/jonipwi/go-chat-client/config"
+	"github.com/jonipwi/go-chat-client/events"
+	"github.com/jonipwi/go-chat-client/state"
+)
+
+// Servers is a set of clients, one per configured server profile, each with
+// its own connection, state, heartbeat and rooms. One of them is in focus:
+// the server that plain messages and commands go to. It is safe for
+// concurrent use.
+type Servers struct {
+	clients []*Client // In the order they are configured
+
+	mu        sync.RWMutex
+	focus     *Client
+	listeners []func(*Client)
+}
+
+// NewServers creates a client for each server profile in cfg and puts the
+// one named by cfg.Server in focus, or the first. It does not connect until
+// Connect is called.
+func NewServers(cfg config.Config) (*Servers, error) {
+	s := &Servers{}
+	for _, profile := range cfg.Profiles() {
+		c, err := New(profile)
+		if err != nil {
+			return nil, fmt.Errorf("server %s: %w", profile.Name, err)
+		}
+		s.clients = append(s.clients, c)
+		if profile.Name == cfg.Server {
+			s.focus = c
+		}
+	}
+	if s.focus == nil {
+		s.focus = s.clients[0]
+	}
+	return s, nil
+}
+
+// Clients returns every client, in the order the servers are configured
+func (s *Servers) Clients() []*Client {
+	return append([]*Client{}, s.clients...)
+}
+
+// Names returns the server names, in the order they are configured
+func (s *Servers) Names() []string {
+	names := make([]string, len(s.clients))
+	for i, c := range s.clients {
+		names[i] = c.Name()
+	}
+	return names
+}
+
+// Multiple reports whether more than one server is configured, in which
+// case messages should be labelled with the server they came from
+func (s *Servers) Multiple() bool {
+	return len(s.clients) > 1
+}
+
+// Get returns the client of the named server
+func (s *Servers) Get(name string) (*Client, bool) {
+	for _, c := range s.clients {
+		if c.Name() == name {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// State returns the state of the named server, or nil if there is no such server
+func (s *Servers) State(name string) *state.ClientState {
+	if c, ok := s.Get(name); ok {
+		return c.State()
+	}
+	return nil
+}
+
+// Focused returns the client of the server in focus
+func (s *Servers) Focused() *Client {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.focus
+}
+
+// Focus puts the named server in focus
+func (s *Servers) Focus(name string) error {
+	c, ok := s.Get(name)
+	if !ok {
+		return fmt.Errorf("no server named %q", name)
+	}
+	s.mu.Lock()
+	changed := s.focus != c
+	s.focus = c
+	listeners := s.listeners
+	s.mu.Unlock()
+
+	if changed {
+		for _, fn := range listeners {
+			fn(c)
+		}
+	}
+	return nil
+}
+
+// OnFocus registers fn to be called with the client of the server that
+// comes into focus
+func (s *Servers) OnFocus(fn func(*Client)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listeners = append(s.listeners, fn)
+}
+
+// OnEvent registers fn to be called with every event received from any
+// server, along with the client that received it. The returned function
+// removes it.
+func (s *Servers) OnEvent(fn func(c *Client, e events.Event)) func() {
+	stops := make([]func(), len(s.clients))
+	for i, c := range s.clients {
+		c := c
+		stops[i] = c.OnEvent(func(e events.Event) { fn(c, e) })
+	}
+	return func() {
+		for _, stop := range stops {
+			stop()
+		}
+	}
+}
+
+// Connect connects to every server at once. Servers that cannot be reached
+// while others can are left to the reconnection supervisor; an error is
+// returned only if no server could be reached, or ctx is done.
+func (s *Servers) Connect(ctx context.Context) error {
+	errs := make([]error, len(s.clients))
+	var wg sync.WaitGroup
+	for i, c := range s.clients {
+		wg.Add(1)
+		go func(i int, c *Client) {
+			defer wg.Done()
+			if err := c.Connect(ctx); err != nil {
+				errs[i] = fmt.Errorf("server %s: %w", c.Name(), err)
+			}
+		}(i, c)
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	connected := 0
+	for _, err := range errs {
+		if err == nil {
+			connected++
+		}
+	}
+	if connected == 0 {
+		return errors.Join(errs...)
+	}
+	for i, err := range errs {
+		if err != nil {
+			s.clients[i].log.Warn("Server unreachable, retrying in the background", "error", err)
+			s.clients[i].retryInBackground("initial connection failed")
+		}
+	}
+	return nil
+}
+
+// Shutdown shuts every client down at once, see Client.Shutdown
+func (s *Servers) Shutdown(ctx context.Context) error {
+	errs := make([]error, len(s.clients))
+	var wg sync.WaitGroup
+	for i, c := range s.clients {
+		wg.Add(1)
+		go func(i int, c *Client) {
+			defer wg.Done()
+			if err := c.Shutdown(ctx); err != nil {
+				errs[i] = fmt.Errorf("server %s: %w", c.Name(), err)
+			}
+		}(i, c)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// Close shuts every client down, waiting up to DefaultShutdownTimeout
+func (s *Servers) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultShutdownTimeout)
+	defer cancel()
+	return s.Shutdown(ctx)
+}
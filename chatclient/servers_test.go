@@ -0,0 +1,158 @@
+package chatclient
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jonipwi/go-chat-client/config"
+	"github.com/jonipwi/go-chat-client/events"
+	"github.com/jonipwi/go-chat-client/socketiotest"
+)
+
+// newServersConfig returns settings with a profile for each named fake server
+func newServersConfig(servers map[string]*socketiotest.Server, names ...string) config.Config {
+	cfg := config.Default()
+	cfg.Username = "alice"
+	cfg.ConnectRetries = 1
+	for _, name := range names {
+		host, port := servers[name].Addr()
+		cfg.Servers = append(cfg.Servers, config.ServerProfile{Name: name, Host: host, Port: port})
+	}
+	return cfg
+}
+
+func TestServers(t *testing.T) {
+	prod, staging := socketiotest.NewServer(), socketiotest.NewServer()
+	defer prod.Close()
+	defer staging.Close()
+	cfg := newServersConfig(map[string]*socketiotest.Server{"prod": prod, "staging": staging}, "prod", "staging")
+	cfg.Server = "staging"
+
+	s, err := NewServers(cfg)
+	if err != nil {
+		t.Fatalf("NewServers() error: %v", err)
+	}
+	if !s.Multiple() || s.Focused().Name() != "staging" {
+		t.Fatalf("Expected two servers with staging in focus, got %v focused on %s", s.Names(), s.Focused().Name())
+	}
+	if err := s.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() error: %v", err)
+	}
+	defer s.Close()
+
+	var mu sync.Mutex
+	from := make(map[string]string) // Message content by server
+	s.OnEvent(func(c *Client, e events.Event) {
+		if e.Message != nil {
+			mu.Lock()
+			from[e.Message.Content] = c.Name()
+			mu.Unlock()
+		}
+	})
+	for _, srv := range []*socketiotest.Server{prod, staging} {
+		if _, err := srv.WaitConns(1, 5*time.Second); err != nil {
+			t.Fatal(err)
+		}
+	}
+	prod.Emit("chat message", "bob", "from prod")
+	staging.Emit("chat message", "bob", "from staging")
+	if !socketiotest.WaitUntil(5*time.Second, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(from) == 2
+	}) {
+		t.Fatal("Timed out waiting for a message from each server")
+	}
+	if from["from prod"] != "prod" || from["from staging"] != "staging" {
+		t.Errorf("Messages came from %v; expected each from its own server", from)
+	}
+
+	var focused []string
+	s.OnFocus(func(c *Client) { focused = append(focused, c.Name()) })
+	if err := s.Focus("dev"); err == nil {
+		t.Error("Focus(dev) should fail for a server that is not configured")
+	}
+	if err := s.Focus("prod"); err != nil {
+		t.Fatalf("Focus(prod) error: %v", err)
+	}
+	if len(focused) != 1 || focused[0] != "prod" {
+		t.Errorf("OnFocus was called with %v; expected prod", focused)
+	}
+
+	if _, err := s.Focused().SendChat("hello prod"); err != nil {
+		t.Fatalf("SendChat() error: %v", err)
+	}
+	if _, err := prod.WaitEvent("global_message", 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(staging.EventsNamed("global_message")); n != 0 {
+		t.Errorf("Staging received %d messages; expected them to go to the server in focus", n)
+	}
+}
+
+func TestServersWithOwnTLS(t *testing.T) {
+	// Each server trusts only its own certificate, so a connection made with
+	// the other profile's TLS settings fails
+	servers := map[string]*socketiotest.Server{"prod": socketiotest.NewTLSServer(), "staging": socketiotest.NewTLSServer()}
+	cfg := newServersConfig(servers, "prod", "staging")
+	for i := range cfg.Servers {
+		srv := servers[cfg.Servers[i].Name]
+		defer srv.Close()
+		var profile config.Config
+		srv.Configure(&profile)
+		cfg.Servers[i].TLS = &profile.TLS
+	}
+
+	s, err := NewServers(cfg)
+	if err != nil {
+		t.Fatalf("NewServers() error: %v", err)
+	}
+	defer s.Close()
+	if err := s.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() error: %v", err)
+	}
+	for name, srv := range servers {
+		if !s.State(name).IsConnected() {
+			t.Errorf("Expected %s to be connected with its own TLS settings", name)
+		}
+		if _, err := srv.WaitConns(1, 5*time.Second); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestServersConnectWithOneDown(t *testing.T) {
+	up, down := socketiotest.NewServer(), socketiotest.NewServer()
+	defer up.Close()
+	cfg := newServersConfig(map[string]*socketiotest.Server{"up": up, "down": down}, "up", "down")
+	down.Close()
+
+	s, err := NewServers(cfg)
+	if err != nil {
+		t.Fatalf("NewServers() error: %v", err)
+	}
+	defer s.Close()
+	if err := s.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() = %v; expected it to succeed while one server is reachable", err)
+	}
+	if !s.State("up").IsConnected() || s.State("down").IsConnected() {
+		t.Error("Expected only the reachable server to be connected")
+	}
+}
+
+func TestServersConnectAllDown(t *testing.T) {
+	srv := socketiotest.NewServer()
+	cfg := newServersConfig(map[string]*socketiotest.Server{"a": srv, "b": srv}, "a", "b")
+	srv.Close()
+
+	s, err := NewServers(cfg)
+	if err != nil {
+		t.Fatalf("NewServers() error: %v", err)
+	}
+	defer s.Close()
+	if err := s.Connect(context.Background()); err == nil {
+		t.Error("Connect() should fail when no server is reachable")
+	}
+}
@@ -2,375 +2,666 @@ package commands
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/jonipwi/go-chat-client/state"
+	"github.com/jonipwi/go-chat-client/utils"
 )
 
-// ProcessCommand handles all user input commands
-func ProcessCommand(clientState *state.ClientState, input string, host string, port int) {
-	fmt.Println() // Add a newline before command output
-	// Split the input into parts
-	parts := strings.Split(input, " ")
-	command := parts[0]
-
-	// Determine the appropriate command handler based on the command
-	switch command {
-	case "/global":
-		handleGlobalMessage(clientState, parts)
-	case "/group":
-		handleGroupMessage(clientState, parts)
-	case "/guild":
-		handleGuildMessage(clientState, parts)
-	case "/private":
-		handlePrivateMessage(clientState, parts)
-	case "/create":
-		handleCreateRoom(clientState, parts)
-	case "/join":
-		handleJoinRoom(clientState, parts)
-	case "/list":
-		handleListRooms(clientState, parts)
-	case "/ping":
-		handlePing(clientState)
-	case "/test":
-		handleTestEvent(clientState)
-	case "/heartbeat":
-		handleManualHeartbeat(clientState)
-	case "/stats":
-		handleStats(clientState)
-	case "/username":
-		handleUsernameChange(clientState, parts)
-	case "/debug":
-		handleDebug(clientState)
-	case "/forcereconnect":
-		handleForceReconnect(clientState, host, port)
-	case "/errors":
-		handleConnectionErrors(clientState)
-	case "/help":
-		PrintCommands()
-	default:
-		handleDefaultInput(clientState, input)
-	}
-	fmt.Println() // Add a newline after command output
-}
-
-// PrintCommands displays available chat commands
-func PrintCommands() {
-	fmt.Println("\n==== Chat Commands ====")
-	fmt.Println("/global <message>    - Send a message to global chat")
-	fmt.Println("/group <group_id> <message> - Send a message to a group")
-	fmt.Println("/guild <guild_id> <message> - Send a message to a guild")
-	fmt.Println("/private <user_id> <message> - Send a private message")
-	fmt.Println("/create <type> <name>  - Create a new room (type: group or guild)")
-	fmt.Println("/join <room_id>     - Join a room")
-	fmt.Println("/list <type>        - List available rooms (type: group or guild)")
-	fmt.Println("/ping               - Send a ping to test connection")
-	fmt.Println("/test               - Send a test event")
-	fmt.Println("/heartbeat          - Send a manual heartbeat")
-	fmt.Println("/stats              - Show client connection statistics")
-	fmt.Println("/username <new_name> - Change your username")
-	fmt.Println("/debug              - Display connection debugging information")
-	fmt.Println("/forcereconnect     - Force a reconnection attempt")
-	fmt.Println("/errors             - Display connection error history")
-	fmt.Println("/exit               - Disconnect and exit")
-	fmt.Println("=======================\n")
+// DefaultRegistry returns a registry with all the built-in chat commands
+func DefaultRegistry() *Registry {
+	r := NewRegistry()
+	for _, cmd := range builtinCommands() {
+		r.MustRegister(cmd)
+	}
+	return r
+}
+
+// builtinCommands lists the commands available in every client
+func builtinCommands() []*Command {
+	return []*Command{
+		{Name: "help", Usage: "[command]", Description: "Show this help", Args: ArgSpec{0, 1}, Handler: handleHelp},
+		{Name: "quit", Aliases: []string{"exit"}, Description: "Disconnect and exit", Args: ArgSpec{0, 0}, Handler: handleQuit},
+		{Name: "global", Usage: "<message>", Description: "Send a message to global chat", Args: ArgSpec{1, -1}, Handler: handleGlobalMessage},
+		{Name: "group", Usage: "<group_id> <message>", Description: "Send a message to a group", Args: ArgSpec{2, -1}, Handler: handleGroupMessage},
+		{Name: "guild", Usage: "<guild_id> <message>", Description: "Send a message to a guild", Args: ArgSpec{2, -1}, Handler: handleGuildMessage},
+		{Name: "private", Aliases: []string{"msg"}, Usage: "<user_id> <message>", Description: "Send a private message", Args: ArgSpec{2, -1}, Handler: handlePrivateMessage},
+		{Name: "create", Usage: "<group|guild> <name>", Description: "Create a new room", Args: ArgSpec{2, 2}, Handler: handleCreateRoom},
+		{Name: "join", Usage: "<room_id>", Description: "Join a room", Args: ArgSpec{1, 1}, Handler: handleJoinRoom},
+		{Name: "list", Usage: "<groups|guilds>", Description: "List available rooms", Args: ArgSpec{1, 1}, Handler: handleListRooms},
+		{Name: "server", Usage: "[name]", Description: "Show the servers or switch the server in focus", Args: ArgSpec{0, 1}, Handler: handleServer},
+		{Name: "switch", Usage: "<room_id|global>", Description: "Switch the room plain messages are sent to", Args: ArgSpec{1, 1}, Handler: handleSwitchRoom},
+		{Name: "rooms", Description: "Show the rooms the client knows about, with unread counts", Args: ArgSpec{0, 0}, Handler: handleKnownRooms},
+		{Name: "read", Usage: "<room_id|global|@user>", Description: "Mark a room, global chat or a private conversation as read", Args: ArgSpec{1, 1}, Handler: handleMarkRead},
+		{Name: "who", Usage: "[room]", Description: "Show who is online in a room or global chat", Args: ArgSpec{0, 1}, Handler: handleWho},
+		{Name: "username", Usage: "<new_name>", Description: "Change your username", Args: ArgSpec{1, 1}, Handler: handleUsernameChange},
+		{Name: "ping", Usage: "[-c <count>]", Description: "Measure the round-trip time to the server", Args: ArgSpec{0, 2}, Handler: handlePing},
+		{Name: "test", Description: "Send a test event", Args: ArgSpec{0, 0}, Handler: handleTestEvent},
+		{Name: "heartbeat", Description: "Send a manual heartbeat", Args: ArgSpec{0, 0}, Handler: handleManualHeartbeat},
+		{Name: "stats", Description: "Show client connection statistics", Args: ArgSpec{0, 0}, Handler: handleStats},
+		{Name: "debug", Description: "Display connection debugging information", Args: ArgSpec{0, 0}, Handler: handleDebug},
+		{Name: "forcereconnect", Description: "Force a reconnection attempt", Args: ArgSpec{0, 0}, Handler: handleForceReconnect},
+		{Name: "errors", Description: "Display connection error history", Args: ArgSpec{0, 0}, Handler: handleConnectionErrors},
+		{Name: "queue", Usage: "[drop <id>|clear]", Description: "Show or drop messages waiting to be sent", Args: ArgSpec{0, 2}, Handler: handleQueue},
+	}
 }
 
 // Helper function to check if client is connected
-func checkClientConnected(clientState *state.ClientState) bool {
-	if !clientState.IsConnected() || clientState.Client() == nil {
-		fmt.Println("❌ Error: Not connected to server")
-		fmt.Println("   Use /forcereconnect to attempt reconnection")
+func checkClientConnected(ctx *Context) bool {
+	if !ctx.State.IsConnected() || ctx.State.Client() == nil {
+		ctx.Println("❌ Error: Not connected to server")
+		ctx.Println("   Use /forcereconnect to attempt reconnection")
 		return false
 	}
 	return true
 }
 
-// handlePing sends a ping to test the connection
-func handlePing(clientState *state.ClientState) {
-	fmt.Println("🏓 Testing connection with ping...")
-	if !checkClientConnected(clientState) {
+// printQueued reports that a message was buffered in the outbox
+func printQueued(ctx *Context) {
+	ctx.Printf("📥 Not connected, message queued (%d pending). It will be sent on reconnect.\n",
+		ctx.State.Outbox().Len())
+}
+
+// handleHelp prints the help generated from the registry
+func handleHelp(ctx *Context, args []string) {
+	if len(args) == 1 {
+		cmd, ok := ctx.Registry.Lookup(args[0])
+		if !ok {
+			ctx.Printf("Unknown command: %s\n", args[0])
+			return
+		}
+		ctx.Printf("%s - %s\n", cmd.Synopsis(), cmd.Description)
 		return
 	}
+	ctx.Printf("\n%s", ctx.Registry.Help())
+}
+
+// handleQuit asks the input loop to exit
+func handleQuit(ctx *Context, args []string) {
+	ctx.Println("Disconnecting and exiting...")
+	ctx.Quit()
+}
 
-	err := clientState.Client().Emit("ping", []interface{}{
-		fmt.Sprintf("Ping from %s", clientState.GetUsername()),
-	})
+// pingInterval is the time between probes of /ping -c
+const pingInterval = time.Second
 
-	if err != nil {
-		fmt.Printf("❌ Error sending ping: %v\n", err)
+// handlePing sends timestamped pings and reports their round-trip times
+func handlePing(ctx *Context, args []string) {
+	count := 1
+	if len(args) > 0 {
+		if len(args) != 2 || args[0] != "-c" {
+			ctx.Println("Usage: /ping [-c <count>]")
+			return
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			ctx.Printf("Invalid ping count: %s\n", args[1])
+			return
+		}
+		count = n
+	}
+
+	ctx.Println("🏓 Testing connection with ping...")
+	if !checkClientConnected(ctx) {
 		return
 	}
 
-	fmt.Println("✅ Ping sent successfully!")
+	// Probes are awaited in the background so the input line stays usable
+	go func() {
+		lifetime := ctx.lifetime()
+		var rtts []time.Duration
+		for seq := 1; seq <= count; seq++ {
+			if seq > 1 && !utils.Sleep(lifetime, pingInterval) {
+				return
+			}
+			rtt, ok, err := sendPing(ctx)
+			switch {
+			case lifetime.Err() != nil:
+				return
+			case err != nil:
+				ctx.Printf("❌ Error sending ping: %v\n", err)
+				return
+			case ok:
+				rtts = append(rtts, rtt)
+				ctx.Printf("pong from server: seq=%d time=%.1f ms\n", seq, float64(rtt)/float64(time.Millisecond))
+			default:
+				ctx.Printf("Request timeout for seq=%d\n", seq)
+			}
+		}
+
+		loss := 100 * (count - len(rtts)) / count
+		ctx.Printf("--- ping statistics ---\n%d probe(s) transmitted, %d received, %d%% loss\n", count, len(rtts), loss)
+		ctx.Println(state.SummarizeLatency(rtts, count-len(rtts)))
+	}()
+}
+
+// sendPing emits a single ping probe and waits for the pong, or until ctx.Ctx ends
+func sendPing(ctx *Context) (time.Duration, bool, error) {
+	client := ctx.State.Client()
+	if client == nil {
+		return 0, false, fmt.Errorf("not connected")
+	}
+	probe := ctx.State.Latency().Start(state.ProbePing)
+	err := client.Emit("ping", fmt.Sprintf("Ping from %s", ctx.State.GetUsername()), probe.Payload())
+	if err != nil {
+		ctx.State.Latency().Cancel(probe)
+		ctx.State.TrackEmitFailure("ping")
+		return 0, false, err
+	}
+	select {
+	case <-probe.Done():
+	case <-ctx.lifetime().Done():
+		ctx.State.Latency().Cancel(probe)
+		return 0, false, ctx.lifetime().Err()
+	}
+	rtt, ok := probe.Wait()
+	return rtt, ok, nil
 }
 
 // handleManualHeartbeat sends a manual heartbeat
-func handleManualHeartbeat(clientState *state.ClientState) {
-	fmt.Println("💓 Sending manual heartbeat...")
-	if !checkClientConnected(clientState) {
+func handleManualHeartbeat(ctx *Context, args []string) {
+	ctx.Println("💓 Sending manual heartbeat...")
+	if !checkClientConnected(ctx) {
 		return
 	}
 
-	err := clientState.Client().Emit("client_heartbeat", []interface{}{
-		fmt.Sprintf("Manual heartbeat from %s at %s",
-			clientState.GetUsername(),
-			time.Now().Format(time.RFC3339)),
-	})
+	probe := ctx.State.Latency().Start(state.ProbeHeartbeat)
+	err := ctx.State.Client().Emit("client_heartbeat", fmt.Sprintf("Manual heartbeat from %s at %s",
+		ctx.State.GetUsername(),
+		time.Now().Format(time.RFC3339)), probe.Payload())
 
 	if err != nil {
-		fmt.Printf("❌ Error sending heartbeat: %v\n", err)
+		ctx.State.Latency().Cancel(probe)
+		ctx.State.TrackEmitFailure("client_heartbeat")
+		ctx.Printf("❌ Error sending heartbeat: %v\n", err)
 		return
 	}
 
-	clientState.TrackHeartbeatSent()
-	fmt.Println("✅ Manual heartbeat sent successfully!")
+	ctx.State.TrackHeartbeatSent()
+	ctx.Println("✅ Manual heartbeat sent successfully!")
 }
 
 // handleStats displays client statistics
-func handleStats(clientState *state.ClientState) {
-	fmt.Println("📊 Client Statistics:")
-	stats := clientState.GetStats()
-	fmt.Printf("%s\n", stats)
+func handleStats(ctx *Context, args []string) {
+	ctx.Println("📊 Client Statistics:")
+	ctx.Println(ctx.State.GetStats())
 }
 
 // handleUsernameChange changes the client's username
-func handleUsernameChange(clientState *state.ClientState, parts []string) {
-	if len(parts) < 2 {
-		fmt.Println("Error: New username required")
-		return
-	}
-
-	newUsername := parts[1]
-	clientState.SetUsername(newUsername)
-	fmt.Printf("Username changed to: %s\n", newUsername)
+func handleUsernameChange(ctx *Context, args []string) {
+	newUsername := args[0]
+	ctx.State.SetUsername(newUsername)
+	ctx.Printf("Username changed to: %s\n", newUsername)
 
 	// If connected, notify the server
-	if clientState.IsConnected() && clientState.Client() != nil {
-		err := clientState.Client().Emit("username_change", []interface{}{newUsername})
+	if ctx.State.IsConnected() && ctx.State.Client() != nil {
+		err := ctx.State.Client().Emit("username_change", newUsername)
 		if err != nil {
-			fmt.Printf("Error notifying server of username change: %v\n", err)
+			ctx.State.TrackEmitFailure("username_change")
+			ctx.Printf("Error notifying server of username change: %v\n", err)
 		}
 	}
 }
 
 // handleGlobalMessage handles the /global command
-func handleGlobalMessage(clientState *state.ClientState, args []string) {
-	if !checkClientConnected(clientState) {
-		return
-	}
-	if len(args) < 2 {
-		fmt.Println("❌ Usage: /global <message>")
-		return
-	}
-	message := strings.Join(args[1:], " ")
-	fmt.Printf("🌐 Sending global message: %s\n", message)
+func handleGlobalMessage(ctx *Context, args []string) {
+	message := strings.Join(args, " ")
+	ctx.Printf("🌐 Sending global message: %s\n", message)
 
-	err := clientState.Client().Emit("global_message", []interface{}{message})
+	queued, err := ctx.State.Send("global_message", message)
 	if err != nil {
-		fmt.Printf("❌ Error sending global message: %v\n", err)
+		ctx.Printf("❌ Error sending global message: %v\n", err)
+		return
+	}
+	if queued {
+		printQueued(ctx)
 		return
 	}
-	clientState.TrackMessageSent()
-	fmt.Println("✅ Global message sent successfully!")
+	ctx.Println("✅ Global message sent successfully!")
 }
 
 // handleDebug displays debugging information
-func handleDebug(clientState *state.ClientState) {
-	fmt.Printf("\nDebug Information:\n")
-	fmt.Printf("Connected: %v\n", clientState.IsConnected())
-	fmt.Printf("Username: %s\n", clientState.GetUsername())
-	fmt.Printf("Client ID: %s\n", clientState.GetClientID())
-	fmt.Printf("Current Room: %s\n", clientState.GetCurrentRoom())
-	fmt.Printf("Last Activity: %v\n", clientState.GetLastActivity().Format(time.RFC3339))
-	fmt.Printf("\nConnection Errors:\n")
-	for _, err := range clientState.GetConnectionErrors() {
-		fmt.Printf("- %s\n", err)
-	}
-	fmt.Println()
+func handleDebug(ctx *Context, args []string) {
+	ctx.Printf("\nDebug Information:\n")
+	ctx.Printf("Connected: %v\n", ctx.State.IsConnected())
+	ctx.Printf("Username: %s\n", ctx.State.GetUsername())
+	ctx.Printf("Client ID: %s\n", ctx.State.GetClientID())
+	ctx.Printf("Current Room: %s\n", ctx.State.GetCurrentRoom())
+	ctx.Printf("Joined Rooms: %s\n", strings.Join(ctx.State.GetJoinedRooms(), ", "))
+	ctx.Printf("Last Activity: %v\n", ctx.State.GetLastActivity().Format(time.RFC3339))
+	ctx.Printf("\nConnection Errors:\n")
+	for _, err := range ctx.State.GetConnectionErrors() {
+		ctx.Printf("- %s\n", err)
+	}
+	ctx.Println()
 }
 
-// handleForceReconnect forces a reconnection attempt
-func handleForceReconnect(clientState *state.ClientState, host string, port int) {
-	if clientState.IsConnected() && clientState.Client() != nil {
-		clientState.CloseConnection()
-	}
-
-	fmt.Printf("Attempting to reconnect to %s:%d...\n", host, port)
-	serverURL := fmt.Sprintf("http://%s:%d/socket.io/", host, port)
-	err := clientState.ConnectToServer(serverURL)
-	if err != nil {
-		fmt.Printf("Reconnection failed: %v\n", err)
-		clientState.AddConnectionError(fmt.Sprintf("Reconnection failed: %v", err))
-	} else {
-		fmt.Println("Reconnection successful")
-	}
+// handleForceReconnect asks the reconnection supervisor to reconnect now
+func handleForceReconnect(ctx *Context, args []string) {
+	ctx.State.RequestReconnect("requested by user")
+	ctx.Println("Reconnection requested, watch /stats for progress")
 }
 
 // handleConnectionErrors displays connection error history
-func handleConnectionErrors(clientState *state.ClientState) {
-	errors := clientState.GetConnectionErrors()
+func handleConnectionErrors(ctx *Context, args []string) {
+	errors := ctx.State.GetConnectionErrors()
 	if len(errors) == 0 {
-		fmt.Println("\nNo connection errors recorded")
+		ctx.Println("No connection errors recorded")
 		return
 	}
 
-	fmt.Printf("\nConnection Error History:\n")
-	for _, err := range errors {
-		fmt.Printf("- %s\n", err)
+	ctx.Printf("Connection Error History:\n")
+	for i, err := range errors {
+		ctx.Printf("%d. %s\n", i+1, err)
 	}
-	fmt.Println()
 }
 
-// handleDefaultInput handles any input that doesn't match a command
-func handleDefaultInput(clientState *state.ClientState, input string) {
-	if !checkClientConnected(clientState) {
-		return
-	}
+// SendChat sends plain input to the current room, or to global chat if no room is selected
+func SendChat(ctx *Context, input string) {
+	queued, err := ctx.State.SendToRoom(ctx.State.GetCurrentRoom(), input)
+	PrintSendResult(ctx, queued, err)
+}
 
-	// Treat as a global message
-	err := clientState.Client().Emit("global_message", []interface{}{input})
+// PrintSendResult reports a chat message that failed or had to be queued;
+// messages sent right away print nothing
+func PrintSendResult(ctx *Context, queued bool, err error) {
 	if err != nil {
-		fmt.Printf("Error sending message: %v\n", err)
-		return
+		ctx.Printf("Error sending message: %v\n", err)
+	} else if queued {
+		printQueued(ctx)
 	}
-
-	clientState.TrackMessageSent()
-	fmt.Println("Message sent successfully")
 }
 
 // handleTestEvent sends a test event to the server
-func handleTestEvent(clientState *state.ClientState) {
-	if !checkClientConnected(clientState) {
+func handleTestEvent(ctx *Context, args []string) {
+	if !checkClientConnected(ctx) {
 		return
 	}
 
-	err := clientState.Client().Emit("test_event", []interface{}{
-		fmt.Sprintf("Test event from %s", clientState.GetUsername()),
-	})
+	err := ctx.State.Client().Emit("test_event", fmt.Sprintf("Test event from %s", ctx.State.GetUsername()))
 
 	if err != nil {
-		fmt.Printf("Error sending test event: %v\n", err)
+		ctx.State.TrackEmitFailure("test_event")
+		ctx.Printf("Error sending test event: %v\n", err)
 		return
 	}
 
-	clientState.TrackMessageSent()
-	fmt.Println("Test event sent successfully")
+	ctx.State.TrackMessageSent()
+	ctx.Println("Test event sent successfully")
 }
 
 // handleGroupMessage handles sending messages to a group
-func handleGroupMessage(clientState *state.ClientState, args []string) {
-	if !checkClientConnected(clientState) {
+func handleGroupMessage(ctx *Context, args []string) {
+	groupID := args[0]
+	message := strings.Join(args[1:], " ")
+	queued, err := ctx.State.Send("group_message", groupID, message)
+	if err != nil {
+		ctx.Printf("Error sending group message: %v\n", err)
 		return
 	}
-	if len(args) < 3 {
-		fmt.Println("Usage: /group <group_id> <message>")
+	if queued {
+		printQueued(ctx)
 		return
 	}
-	groupID := args[1]
-	message := strings.Join(args[2:], " ")
-	err := clientState.Client().Emit("group_message", []interface{}{groupID, message})
+	ctx.Println("Group message sent successfully")
+}
+
+// handleGuildMessage handles sending messages to a guild
+func handleGuildMessage(ctx *Context, args []string) {
+	guildID := args[0]
+	message := strings.Join(args[1:], " ")
+	queued, err := ctx.State.Send("guild_message", guildID, message)
 	if err != nil {
-		fmt.Printf("Error sending group message: %v\n", err)
+		ctx.Printf("Error sending guild message: %v\n", err)
 		return
 	}
-	clientState.TrackMessageSent()
-	fmt.Println("Group message sent successfully")
+	if queued {
+		printQueued(ctx)
+		return
+	}
+	ctx.Println("Guild message sent successfully")
 }
 
-// handleGuildMessage handles sending messages to a guild
-func handleGuildMessage(clientState *state.ClientState, args []string) {
-	if !checkClientConnected(clientState) {
+// handlePrivateMessage handles sending private messages
+func handlePrivateMessage(ctx *Context, args []string) {
+	userID := args[0]
+	message := strings.Join(args[1:], " ")
+	req, queued, err := ctx.State.SendRequest("private_message", userID, message)
+	if err != nil {
+		ctx.Printf("Error sending private message: %v\n", err)
 		return
 	}
-	if len(args) < 3 {
-		fmt.Println("Usage: /guild <guild_id> <message>")
+	if queued {
+		printQueued(ctx)
 		return
 	}
-	guildID := args[1]
-	message := strings.Join(args[2:], " ")
-	err := clientState.Client().Emit("guild_message", []interface{}{guildID, message})
-	if err != nil {
-		fmt.Printf("Error sending guild message: %v\n", err)
+	if req == nil {
+		ctx.Printf("Private message sent to %s\n", userID)
 		return
 	}
-	clientState.TrackMessageSent()
-	fmt.Println("Guild message sent successfully")
+	awaitRequest(ctx, req, "Private message to "+userID, "delivered")
 }
 
-// handlePrivateMessage handles sending private messages
-func handlePrivateMessage(clientState *state.ClientState, args []string) {
-	if !checkClientConnected(clientState) {
+// parseRoomType normalises a room type argument, accepting singular and plural forms
+func parseRoomType(arg string) (string, bool) {
+	switch strings.ToLower(arg) {
+	case "group", "groups":
+		return "group", true
+	case "guild", "guilds":
+		return "guild", true
+	}
+	return "", false
+}
+
+// awaitRequest reports the server's answer to req once it arrives, without
+// blocking the input loop, as "<what>: <acked>", "<what>: rejected: <reason>"
+// or "<what>: timed out". Nothing is reported once ctx.Ctx ends.
+func awaitRequest(ctx *Context, req *state.Request, what, acked string) {
+	go func() {
+		select {
+		case <-req.Done():
+		case <-ctx.lifetime().Done():
+			return
+		}
+		result := req.Wait()
+		switch result.Status {
+		case state.RequestAcked:
+			ctx.Printf("✅ %s: %s\n", what, acked)
+		case state.RequestRejected:
+			ctx.Printf("❌ %s: rejected: %s\n", what, result.Error)
+		case state.RequestTimedOut:
+			ctx.Printf("⌛ %s: timed out\n", what)
+		}
+	}()
+}
+
+// handleCreateRoom handles creating a new room
+func handleCreateRoom(ctx *Context, args []string) {
+	if !checkClientConnected(ctx) {
 		return
 	}
-	if len(args) < 3 {
-		fmt.Println("Usage: /private <user_id> <message>")
+	roomType, ok := parseRoomType(args[0])
+	if !ok {
+		ctx.Println("Invalid room type. Use 'group' or 'guild'")
 		return
 	}
-	userID := args[1]
-	message := strings.Join(args[2:], " ")
-	err := clientState.Client().Emit("private_message", []interface{}{userID, message})
+	roomName := args[1]
+	req, err := ctx.State.CreateRoom(roomType, roomName)
 	if err != nil {
-		fmt.Printf("Error sending private message: %v\n", err)
+		ctx.Printf("Error creating room: %v\n", err)
 		return
 	}
-	clientState.TrackMessageSent()
-	fmt.Println("Private message sent successfully")
+	ctx.Printf("Creating %s %s...\n", roomType, roomName)
+	awaitRequest(ctx, req, fmt.Sprintf("Room %s %s", roomType, roomName), "created")
 }
 
-// handleCreateRoom handles creating a new room
-func handleCreateRoom(clientState *state.ClientState, args []string) {
-	if !checkClientConnected(clientState) {
+// handleJoinRoom handles joining a room
+func handleJoinRoom(ctx *Context, args []string) {
+	if !checkClientConnected(ctx) {
+		return
+	}
+	roomID := args[0]
+	req, err := ctx.State.JoinRoom(roomID)
+	if err != nil {
+		ctx.Printf("Error joining room: %v\n", err)
+		return
+	}
+	ctx.Printf("Joining room: %s\n", roomID)
+	awaitRequest(ctx, req, "Room "+roomID, "joined")
+}
+
+// handleListRooms handles listing available rooms
+func handleListRooms(ctx *Context, args []string) {
+	if !checkClientConnected(ctx) {
 		return
 	}
-	if len(args) < 3 {
-		fmt.Println("Usage: /create <type> <name>")
+	roomType, ok := parseRoomType(args[0])
+	if !ok {
+		ctx.Println("Invalid room type. Use 'groups' or 'guilds'")
 		return
 	}
-	roomType := args[1]
-	roomName := args[2]
-	err := clientState.Client().Emit("create_room", []interface{}{roomType, roomName})
+	err := ctx.State.Client().Emit("list_rooms", roomType)
 	if err != nil {
-		fmt.Printf("Error creating room: %v\n", err)
+		ctx.State.TrackEmitFailure("list_rooms")
+		ctx.Printf("Error requesting room list: %v\n", err)
 		return
 	}
-	fmt.Printf("Room creation request sent for %s: %s\n", roomType, roomName)
+	ctx.Printf("Listing %ss...\n", roomType)
 }
 
-// handleJoinRoom handles joining a room
-func handleJoinRoom(clientState *state.ClientState, args []string) {
-	if !checkClientConnected(clientState) {
+// handleKnownRooms lists the rooms in the registry and the joined rooms,
+// with their type as far as the server has told us, followed by what is
+// unread in global chat and private conversations
+func handleKnownRooms(ctx *Context, args []string) {
+	registry := ctx.State.Rooms()
+	rooms := registry.List()
+	for _, id := range ctx.State.GetJoinedRooms() {
+		if _, ok := registry.Get(id); !ok {
+			rooms = append(rooms, state.Room{ID: id})
+		}
+	}
+	counts := ctx.State.Unread().Counts()
+	var peers []string
+	for key, count := range counts {
+		if strings.HasPrefix(key, state.PrivatePrefix) && count.Messages > 0 {
+			peers = append(peers, key)
+		}
+	}
+	sort.Strings(peers)
+
+	if len(rooms) == 0 && counts[""].Messages == 0 && len(peers) == 0 {
+		ctx.Println("No rooms known yet. Use /list groups or /list guilds to fetch them")
+		return
+	}
+	if len(rooms) > 0 {
+		printRooms(ctx, rooms, counts)
+	}
+	if global := counts[""]; global.Messages > 0 {
+		ctx.Printf("Global chat: %s\n", formatUnread(global))
+	}
+	if len(peers) > 0 {
+		ctx.Printf("Private conversations (%d):\n", len(peers))
+		for _, peer := range peers {
+			ctx.Printf("- %s, %s\n", peer, formatUnread(counts[peer]))
+		}
+	}
+}
+
+// printRooms lists rooms with their type, membership and unread count
+func printRooms(ctx *Context, rooms []state.Room, counts map[string]state.UnreadCount) {
+	joined := make(map[string]bool)
+	for _, id := range ctx.State.GetJoinedRooms() {
+		joined[id] = true
+	}
+	current := ctx.State.GetCurrentRoom()
+
+	ctx.Printf("Known rooms (%d):\n", len(rooms))
+	for _, room := range rooms {
+		roomType := room.Type
+		if roomType == "" {
+			roomType = "unknown type"
+		}
+		line := fmt.Sprintf("- %s [%s]", room.ID, roomType)
+		if room.Name != "" && room.Name != room.ID {
+			line += fmt.Sprintf(" %q", room.Name)
+		}
+		if len(room.Members) > 0 {
+			line += fmt.Sprintf(", %d member(s)", len(room.Members))
+		}
+		switch {
+		case room.ID == current:
+			line += " (current)"
+		case joined[room.ID]:
+			line += " (joined)"
+		}
+		if unread := counts[room.ID]; unread.Messages > 0 {
+			line += ", " + formatUnread(unread)
+		}
+		ctx.Println(line)
+	}
+}
+
+// handleMarkRead clears the unread count of a room, global chat or a
+// private conversation without bringing it into focus
+func handleMarkRead(ctx *Context, args []string) {
+	room := args[0]
+	where := "room " + room
+	switch {
+	case room == "global":
+		where = "global chat"
+	case strings.HasPrefix(room, state.PrivatePrefix):
+		where = "your conversation with " + strings.TrimPrefix(room, state.PrivatePrefix)
+	}
+	unread := ctx.State.Unread().MarkRead(room)
+	if unread.Messages == 0 {
+		ctx.Printf("Nothing unread in %s\n", where)
+		return
+	}
+	ctx.Printf("Marked %s as read (%s)\n", where, formatUnread(unread))
+}
+
+// handleServer lists the servers, or puts the named server in focus so
+// commands and plain messages go to it
+func handleServer(ctx *Context, args []string) {
+	if ctx.Servers == nil {
+		ctx.Println("Only one server is configured. Add server profiles to the config file to connect to several")
+		return
+	}
+	if len(args) == 0 {
+		names := ctx.Servers.Names()
+		ctx.Printf("Servers (%d):\n", len(names))
+		for _, name := range names {
+			stats := ctx.Servers.State(name).Snapshot()
+			line := fmt.Sprintf("- %s: ", name)
+			if stats.Connected {
+				line += "connected as " + stats.Username
+			} else {
+				line += "disconnected"
+			}
+			if unread := ctx.Servers.State(name).Unread().Total(); unread.Messages > 0 {
+				line += ", " + formatUnread(unread)
+			}
+			if name == ctx.Server {
+				line += " (focus)"
+			}
+			ctx.Println(line)
+		}
 		return
 	}
-	if len(args) < 2 {
-		fmt.Println("Usage: /join <room_id>")
+
+	name := args[0]
+	if err := ctx.Servers.Focus(name); err != nil {
+		ctx.Printf("❌ %v. Use /server to list the servers\n", err)
 		return
 	}
-	roomID := args[1]
-	err := clientState.Client().Emit("join_room", []interface{}{roomID})
+	ctx.State, ctx.Server = ctx.Servers.State(name), name
+	room := ctx.State.GetCurrentRoom()
+	if room == "" {
+		room = "global chat"
+	}
+	ctx.Printf("Now talking on server %s, in %s\n", name, room)
+}
+
+// handleSwitchRoom brings a joined room into focus
+func handleSwitchRoom(ctx *Context, args []string) {
+	room := args[0]
+	unread, err := ctx.State.SwitchRoom(room)
 	if err != nil {
-		fmt.Printf("Error joining room: %v\n", err)
+		ctx.Printf("❌ Cannot switch to %s: %v. Use /join %s first\n", room, err, room)
+		return
+	}
+	where := "room " + room
+	if room == "global" {
+		where = "global chat"
+	}
+	if unread.Messages == 0 {
+		ctx.Printf("Now talking in %s\n", where)
 		return
 	}
-	clientState.SetCurrentRoom(roomID)
-	fmt.Printf("Joined room: %s\n", roomID)
+	ctx.Printf("Now talking in %s (%s)\n", where, formatUnread(unread))
 }
 
-// handleListRooms handles listing available rooms
-func handleListRooms(clientState *state.ClientState, args []string) {
-	if !checkClientConnected(clientState) {
+// formatUnread describes an unread count, e.g. "3 unread, 1 mention"
+func formatUnread(unread state.UnreadCount) string {
+	text := fmt.Sprintf("%d unread", unread.Messages)
+	switch unread.Mentions {
+	case 0:
+	case 1:
+		text += ", 1 mention"
+	default:
+		text += fmt.Sprintf(", %d mentions", unread.Mentions)
+	}
+	return text
+}
+
+// handleWho lists the users online in the given room, the current room or global chat
+func handleWho(ctx *Context, args []string) {
+	room := ctx.State.GetCurrentRoom()
+	if len(args) > 0 {
+		room = args[0]
+	}
+	where := room
+	if room == "" || room == "global" {
+		room, where = "", "global chat"
+	}
+
+	users := ctx.State.Presence().Online(room)
+	if len(users) == 0 {
+		ctx.Printf("Nobody is known to be online in %s\n", where)
 		return
 	}
-	if len(args) < 2 {
-		fmt.Println("Usage: /list <type>")
+	ctx.Printf("Online in %s (%d):\n", where, len(users))
+	for _, user := range users {
+		switch {
+		case user.ID == "":
+			ctx.Printf("- %s\n", user.Username)
+		case user.Username == "" || user.Username == user.ID:
+			ctx.Printf("- %s\n", user.ID)
+		default:
+			ctx.Printf("- %s (%s)\n", user.Username, user.ID)
+		}
+	}
+}
+
+// handleQueue shows the outbox or drops pending messages from it
+func handleQueue(ctx *Context, args []string) {
+	outbox := ctx.State.Outbox()
+
+	if len(args) >= 1 {
+		switch args[0] {
+		case "clear":
+			ctx.Printf("Dropped %d queued message(s)\n", outbox.Clear())
+		case "drop":
+			if len(args) < 2 {
+				ctx.Println("Usage: /queue drop <id>")
+				return
+			}
+			id, err := strconv.Atoi(strings.TrimPrefix(args[1], "#"))
+			if err != nil {
+				ctx.Printf("Invalid message id: %s\n", args[1])
+				return
+			}
+			if !outbox.Drop(id) {
+				ctx.Printf("No queued message with id %d\n", id)
+				return
+			}
+			ctx.Printf("Dropped queued message #%d\n", id)
+		default:
+			ctx.Println("Usage: /queue [drop <id>|clear]")
+		}
 		return
 	}
-	roomType := args[1]
-	err := clientState.Client().Emit("list_rooms", []interface{}{roomType})
-	if err != nil {
-		fmt.Printf("Error requesting room list: %v\n", err)
+
+	items := outbox.Items()
+	if len(items) == 0 {
+		ctx.Println("Outbox is empty")
 		return
 	}
-	fmt.Printf("Room list request sent for type: %s\n", roomType)
+	ctx.Printf("Outbox (%d pending):\n", outbox.Len())
+	for _, item := range items {
+		ctx.Printf("- %s\n", item)
+	}
 }
@@ -3,6 +3,8 @@ module github.com/jonipwi/go-chat-client/commands
 go 1.21
 
 require (
+	github.com/jonipwi/go-chat-client/events v0.0.0
+	github.com/jonipwi/go-chat-client/history v0.0.0
 	github.com/jonipwi/go-chat-client/state v0.0.0
 	github.com/jonipwi/go-chat-client/utils v0.0.0
 )
@@ -14,9 +16,15 @@ require (
 	github.com/smarty/assertions v1.16.0 // indirect
 	github.com/zhouhui8915/engine.io-go v0.0.0-20150910083302-02ea08f0971f // indirect
 	github.com/zhouhui8915/go-socket.io-client v0.0.0-20200925034401-83ee73793ba4 // indirect
+	go.etcd.io/bbolt v1.3.10 // indirect
+	golang.org/x/sys v0.4.0 // indirect
 )
 
 replace (
+	github.com/jonipwi/go-chat-client/events => ../events
+	github.com/jonipwi/go-chat-client/history => ../history
 	github.com/jonipwi/go-chat-client/state => ../state
 	github.com/jonipwi/go-chat-client/utils => ../utils
+	github.com/zhouhui8915/engine.io-go => ../third_party/engine.io-go
+	github.com/zhouhui8915/go-socket.io-client => ../third_party/go-socket.io-client
 )
@@ -0,0 +1,128 @@
+package commands
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/jonipwi/go-chat-client/events"
+	"github.com/jonipwi/go-chat-client/history"
+	"github.com/jonipwi/go-chat-client/utils"
+)
+
+// defaultHistoryLines is how many messages /history shows when no count is given
+const defaultHistoryLines = 20
+
+// RegisterHistory adds the /history and /search commands backed by store
+func RegisterHistory(r *Registry, store *history.Store) {
+	registerHistory(r, func(*Context) *history.Store { return store })
+}
+
+// RegisterServerHistory adds the /history and /search commands backed by
+// the store of the server in focus, with stores keyed by server name
+func RegisterServerHistory(r *Registry, stores map[string]*history.Store) {
+	registerHistory(r, func(ctx *Context) *history.Store { return stores[ctx.Server] })
+}
+
+// registerHistory adds the history commands, looking up the store to use
+// each time one runs
+func registerHistory(r *Registry, storeFor func(*Context) *history.Store) {
+	r.MustRegister(&Command{
+		Name:        "history",
+		Usage:       "<room> [n]",
+		Description: "Show the last messages of a room (global, a room ID or @user)",
+		Args:        ArgSpec{1, 2},
+		Handler: func(ctx *Context, args []string) {
+			if store := storeFor(ctx); store != nil {
+				handleHistory(ctx, store, args)
+			} else {
+				ctx.Printf("No message history is kept for server %s\n", ctx.Server)
+			}
+		},
+	})
+	r.MustRegister(&Command{
+		Name:        "search",
+		Usage:       "<text> [room:<room>] [from:<user>] [before:<time>] [after:<time>]",
+		Description: "Search the message history",
+		Args:        ArgSpec{1, -1},
+		Handler: func(ctx *Context, args []string) {
+			if store := storeFor(ctx); store != nil {
+				handleSearch(ctx, store, args)
+			} else {
+				ctx.Printf("No message history is kept for server %s\n", ctx.Server)
+			}
+		},
+	})
+}
+
+// handleHistory prints the most recent messages of a room
+func handleHistory(ctx *Context, store *history.Store, args []string) {
+	room := args[0]
+	n := defaultHistoryLines
+	if len(args) == 2 {
+		count, err := strconv.Atoi(args[1])
+		if err != nil || count < 1 {
+			ctx.Printf("Invalid message count: %s\n", args[1])
+			return
+		}
+		n = count
+	}
+
+	messages, err := store.Recent(room, n)
+	if err != nil {
+		ctx.Printf("Error reading history: %v\n", err)
+		return
+	}
+	if len(messages) == 0 {
+		rooms, _ := store.Rooms()
+		ctx.Printf("No history for %s\n", room)
+		if len(rooms) > 0 {
+			ctx.Printf("Rooms with history: %v\n", rooms)
+		}
+		return
+	}
+	ctx.Printf("Last %d message(s) in %s:\n", len(messages), room)
+	printMessages(ctx, messages)
+}
+
+// handleSearch prints the messages matching a query
+func handleSearch(ctx *Context, store *history.Store, args []string) {
+	q, err := history.ParseQuery(args, time.Now())
+	if err != nil {
+		ctx.Printf("%v\n", err)
+		return
+	}
+
+	messages, err := store.Search(q)
+	if err != nil {
+		ctx.Printf("Error searching history: %v\n", err)
+		return
+	}
+	if len(messages) == 0 {
+		ctx.Println("No matching messages")
+		return
+	}
+	ctx.Printf("%d matching message(s):\n", len(messages))
+	printMessages(ctx, messages)
+}
+
+// printMessages writes stored messages in the same layout as incoming ones
+func printMessages(ctx *Context, messages []events.Message) {
+	for _, msg := range messages {
+		label := msg.Type
+		switch msg.Type {
+		case events.TypeGroup, events.TypeGuild:
+			if msg.Room != "" {
+				label = msg.Type + ":" + msg.Room
+			}
+		case events.TypePrivate:
+			label = history.RoomOf(msg)
+		}
+
+		stamp := utils.FormatTimestamp(msg.Timestamp)
+		if msg.Sender == "" {
+			ctx.Printf("%s [%s] %s\n", stamp, label, msg.Content)
+		} else {
+			ctx.Printf("%s [%s] %s: %s\n", stamp, label, msg.Sender, msg.Content)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package commands
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jonipwi/go-chat-client/events"
+	"github.com/jonipwi/go-chat-client/history"
+)
+
+func TestHistoryCommands(t *testing.T) {
+	store, err := history.Open(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatalf("history.Open() returned %v", err)
+	}
+	defer store.Close()
+	store.Add(events.Message{Type: events.TypeGroup, Room: "room-1", Sender: "alice", Content: "build is green"})
+	store.Add(events.Message{Type: events.TypePrivate, Sender: "bob", Content: "are you there?"})
+
+	registry := DefaultRegistry()
+	RegisterHistory(registry, store)
+	ctx, out := newTestContext()
+
+	registry.Dispatch(ctx, "/history room-1 5")
+	if !strings.Contains(out.String(), "[group:room-1] alice: build is green") {
+		t.Errorf("Unexpected /history output: %q", out.String())
+	}
+
+	out.Reset()
+	registry.Dispatch(ctx, "/search THERE from:bob")
+	if !strings.Contains(out.String(), "[@bob] bob: are you there?") {
+		t.Errorf("Unexpected /search output: %q", out.String())
+	}
+
+	out.Reset()
+	registry.Dispatch(ctx, "/history room-2")
+	if !strings.Contains(out.String(), "No history for room-2") {
+		t.Errorf("Expected an empty room to be reported, got %q", out.String())
+	}
+}
@@ -0,0 +1,191 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/jonipwi/go-chat-client/state"
+	"github.com/jonipwi/go-chat-client/utils"
+)
+
+// ErrUnknownCommand is returned by Dispatch for commands that are not registered
+var ErrUnknownCommand = errors.New("unknown command")
+
+// ArgSpec describes how many arguments a command accepts
+type ArgSpec struct {
+	Min int
+	Max int // -1 means no upper limit
+}
+
+// Command describes a single slash command
+type Command struct {
+	Name        string
+	Aliases     []string
+	Usage       string // Argument synopsis shown in help, e.g. "<room_id>"
+	Description string
+	Args        ArgSpec
+	Handler     func(ctx *Context, args []string)
+}
+
+// Context carries everything a command handler needs
+type Context struct {
+	State    *state.ClientState // State of the server in focus
+	Out      io.Writer
+	Registry *Registry
+	Server   string          // Name of the server in focus
+	Servers  Servers         // Nil when only one server is configured
+	Ctx      context.Context // Ends when input stops; output still awaited is dropped. Nil means never.
+	quit     bool
+}
+
+// lifetime returns Ctx, or a context that never ends if it is nil
+func (ctx *Context) lifetime() context.Context {
+	if ctx.Ctx == nil {
+		return context.Background()
+	}
+	return ctx.Ctx
+}
+
+// Servers is the set of servers the client is connected to at once
+type Servers interface {
+	// Names returns the server names, in the order they are configured
+	Names() []string
+	// Focus puts the named server in focus
+	Focus(name string) error
+	// State returns the state of the named server, or nil if there is no such server
+	State(name string) *state.ClientState
+}
+
+// Printf writes formatted command output
+func (ctx *Context) Printf(format string, a ...interface{}) {
+	fmt.Fprintf(ctx.Out, format, a...)
+}
+
+// Println writes a line of command output
+func (ctx *Context) Println(a ...interface{}) {
+	fmt.Fprintln(ctx.Out, a...)
+}
+
+// Quit asks the input loop to disconnect and exit
+func (ctx *Context) Quit() {
+	ctx.quit = true
+}
+
+// Quitting reports whether a command asked the client to exit
+func (ctx *Context) Quitting() bool {
+	return ctx.quit
+}
+
+// Registry holds the available commands, indexed by name and alias
+type Registry struct {
+	commands []*Command
+	byName   map[string]*Command
+}
+
+// NewRegistry creates an empty command registry
+func NewRegistry() *Registry {
+	return &Registry{
+		byName: make(map[string]*Command),
+	}
+}
+
+// Register adds a command; names and aliases must be unique
+func (r *Registry) Register(cmd *Command) error {
+	if cmd.Name == "" || cmd.Handler == nil {
+		return fmt.Errorf("command must have a name and a handler")
+	}
+	names := append([]string{cmd.Name}, cmd.Aliases...)
+	for _, name := range names {
+		if _, exists := r.byName[name]; exists {
+			return fmt.Errorf("command /%s is already registered", name)
+		}
+	}
+	for _, name := range names {
+		r.byName[name] = cmd
+	}
+	r.commands = append(r.commands, cmd)
+	return nil
+}
+
+// MustRegister is like Register but panics on error
+func (r *Registry) MustRegister(cmd *Command) {
+	if err := r.Register(cmd); err != nil {
+		panic(err)
+	}
+}
+
+// Lookup finds a command by name or alias, with or without the leading slash
+func (r *Registry) Lookup(name string) (*Command, bool) {
+	cmd, ok := r.byName[strings.TrimPrefix(name, "/")]
+	return cmd, ok
+}
+
+// Commands returns the registered commands sorted by name
+func (r *Registry) Commands() []*Command {
+	cmds := append([]*Command{}, r.commands...)
+	sort.Slice(cmds, func(i, j int) bool { return cmds[i].Name < cmds[j].Name })
+	return cmds
+}
+
+// logger logs the commands that are run
+var logger = utils.Log(utils.ComponentCommands)
+
+// Dispatch parses a slash command line and runs the matching handler
+func (r *Registry) Dispatch(ctx *Context, input string) error {
+	parts := strings.Fields(input)
+	if len(parts) == 0 {
+		return nil
+	}
+
+	cmd, ok := r.Lookup(parts[0])
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownCommand, parts[0])
+	}
+
+	args := parts[1:]
+	if len(args) < cmd.Args.Min || (cmd.Args.Max >= 0 && len(args) > cmd.Args.Max) {
+		return fmt.Errorf("usage: %s", cmd.Synopsis())
+	}
+
+	if ctx.Registry == nil {
+		ctx.Registry = r
+	}
+	// Arguments are left out, they may hold message text
+	logger.Debug("Running command", "command", cmd.Name, "args", len(args))
+	cmd.Handler(ctx, args)
+	return nil
+}
+
+// Synopsis returns the command name followed by its argument usage
+func (cmd *Command) Synopsis() string {
+	if cmd.Usage == "" {
+		return "/" + cmd.Name
+	}
+	return "/" + cmd.Name + " " + cmd.Usage
+}
+
+// Help returns the help text listing every registered command
+func (r *Registry) Help() string {
+	cmds := r.Commands()
+	width := 0
+	for _, cmd := range cmds {
+		if l := len(cmd.Synopsis()); l > width {
+			width = l
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("Available commands:\n")
+	for _, cmd := range cmds {
+		fmt.Fprintf(&sb, "  %-*s - %s", width, cmd.Synopsis(), cmd.Description)
+		if len(cmd.Aliases) > 0 {
+			fmt.Fprintf(&sb, " (alias: /%s)", strings.Join(cmd.Aliases, ", /"))
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
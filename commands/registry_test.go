@@ -0,0 +1,268 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jonipwi/go-chat-client/state"
+)
+
+func newTestContext() (*Context, *bytes.Buffer) {
+	out := &bytes.Buffer{}
+	return &Context{State: state.NewClientState("testuser"), Out: out}, out
+}
+
+func TestDispatchAliasesAndArgs(t *testing.T) {
+	registry := DefaultRegistry()
+	ctx, out := newTestContext()
+
+	if err := registry.Dispatch(ctx, "/username newname"); err != nil {
+		t.Fatalf("Dispatch(/username) returned %v", err)
+	}
+	if ctx.State.GetUsername() != "newname" {
+		t.Errorf("Expected username to be updated, got %q", ctx.State.GetUsername())
+	}
+
+	if err := registry.Dispatch(ctx, "/username"); err == nil || !strings.Contains(err.Error(), "/username <new_name>") {
+		t.Errorf("Expected usage error for missing argument, got %v", err)
+	}
+
+	if err := registry.Dispatch(ctx, "/nosuchcommand"); !errors.Is(err, ErrUnknownCommand) {
+		t.Errorf("Expected ErrUnknownCommand, got %v", err)
+	}
+
+	// /msg is an alias of /private, offline sends are queued
+	out.Reset()
+	if err := registry.Dispatch(ctx, "/msg user-1 hello there"); err != nil {
+		t.Fatalf("Dispatch(/msg) returned %v", err)
+	}
+	items := ctx.State.Outbox().Items()
+	if len(items) != 1 || items[0].Event != "private_message" || items[0].Args[1] != "hello there" {
+		t.Errorf("Expected queued private message, got %v", items)
+	}
+
+	if err := registry.Dispatch(ctx, "/exit"); err != nil || !ctx.Quitting() {
+		t.Errorf("Expected /exit to request quitting, got err=%v quitting=%v", err, ctx.Quitting())
+	}
+}
+
+func TestRegisterRejectsDuplicates(t *testing.T) {
+	registry := DefaultRegistry()
+	err := registry.Register(&Command{Name: "msg", Handler: func(*Context, []string) {}})
+	if err == nil {
+		t.Error("Expected registering a name that clashes with an alias to fail")
+	}
+}
+
+func TestHelpIsGeneratedFromRegistry(t *testing.T) {
+	registry := DefaultRegistry()
+	help := registry.Help()
+
+	for _, cmd := range registry.Commands() {
+		if !strings.Contains(help, cmd.Synopsis()) {
+			t.Errorf("Expected help to list %s", cmd.Synopsis())
+		}
+	}
+	if !strings.Contains(help, "(alias: /exit)") {
+		t.Errorf("Expected help to mention aliases, got:\n%s", help)
+	}
+
+	ctx, out := newTestContext()
+	registry.Dispatch(ctx, "/help join")
+	if !strings.Contains(out.String(), "/join <room_id> - Join a room") {
+		t.Errorf("Unexpected /help join output: %q", out.String())
+	}
+}
+
+func TestKnownRooms(t *testing.T) {
+	registry := DefaultRegistry()
+	ctx, out := newTestContext()
+
+	registry.Dispatch(ctx, "/rooms")
+	if !strings.Contains(out.String(), "No rooms known yet") {
+		t.Errorf("Expected a hint when no rooms are known, got %q", out.String())
+	}
+
+	ctx.State.Rooms().Update(state.Room{ID: "g1", Name: "Builders", Type: state.RoomGuild})
+	ctx.State.Rooms().Update(state.Room{ID: "r1", Type: state.RoomGroup})
+	ctx.State.AddJoinedRoom("r1")
+	ctx.State.AddJoinedRoom("mystery")
+	ctx.State.SetCurrentRoom("g1")
+
+	out.Reset()
+	registry.Dispatch(ctx, "/rooms")
+	expected := "Known rooms (3):\n" +
+		"- r1 [group] (joined)\n" +
+		"- g1 [guild] \"Builders\" (current)\n" +
+		"- mystery [unknown type] (joined)\n"
+	if out.String() != expected {
+		t.Errorf("/rooms printed:\n%s\nexpected:\n%s", out.String(), expected)
+	}
+}
+
+func TestUnreadOutsideRooms(t *testing.T) {
+	registry := DefaultRegistry()
+	ctx, out := newTestContext()
+	// Global chat is counted while a room is in focus
+	ctx.State.AddJoinedRoom("r1")
+	ctx.State.SetCurrentRoom("r1")
+	ctx.State.TrackUnread("", "bob", "hello all")
+	ctx.State.RemoveJoinedRoom("r1")
+	ctx.State.TrackUnread(state.PrivatePrefix+"carol", "carol", "psst testuser")
+	ctx.State.TrackUnread(state.PrivatePrefix+"bob", "bob", "hi")
+
+	// Shown even when no rooms are known
+	registry.Dispatch(ctx, "/rooms")
+	expected := "Global chat: 1 unread\n" +
+		"Private conversations (2):\n" +
+		"- @bob, 1 unread\n" +
+		"- @carol, 1 unread, 1 mention\n"
+	if out.String() != expected {
+		t.Errorf("/rooms printed:\n%s\nexpected:\n%s", out.String(), expected)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"/read @carol", "Marked your conversation with carol as read (1 unread, 1 mention)\n"},
+		{"/read @carol", "Nothing unread in your conversation with carol\n"},
+		{"/read global", "Marked global chat as read (1 unread)\n"},
+		{"/read r1", "Nothing unread in room r1\n"},
+		{"/rooms", "Private conversations (1):\n- @bob, 1 unread\n"},
+	}
+	for _, test := range tests {
+		out.Reset()
+		registry.Dispatch(ctx, test.input)
+		if out.String() != test.expected {
+			t.Errorf("%s printed %q; expected %q", test.input, out.String(), test.expected)
+		}
+	}
+}
+
+func TestWho(t *testing.T) {
+	registry := DefaultRegistry()
+	ctx, out := newTestContext()
+
+	registry.Dispatch(ctx, "/who")
+	if out.String() != "Nobody is known to be online in global chat\n" {
+		t.Errorf("/who with an empty roster printed %q", out.String())
+	}
+
+	presence := ctx.State.Presence()
+	presence.SetOnline("", []state.User{{ID: "u-2", Username: "bob"}, {ID: "u-1", Username: "alice"}})
+	presence.Join("r1", state.User{Username: "carol"})
+	presence.Join("r1", state.User{ID: "u-2"})
+	ctx.State.SetCurrentRoom("r1")
+
+	out.Reset()
+	registry.Dispatch(ctx, "/who")
+	expected := "Online in r1 (2):\n- bob (u-2)\n- carol\n"
+	if out.String() != expected {
+		t.Errorf("/who printed:\n%s\nexpected:\n%s", out.String(), expected)
+	}
+
+	out.Reset()
+	registry.Dispatch(ctx, "/who global")
+	expected = "Online in global chat (3):\n- alice (u-1)\n- bob (u-2)\n- carol\n"
+	if out.String() != expected {
+		t.Errorf("/who global printed:\n%s\nexpected:\n%s", out.String(), expected)
+	}
+}
+
+func TestSwitchRoom(t *testing.T) {
+	registry := DefaultRegistry()
+	ctx, out := newTestContext()
+	ctx.State.AddJoinedRoom("r1")
+	ctx.State.AddJoinedRoom("r2")
+	ctx.State.SetCurrentRoom("r1")
+	ctx.State.TrackUnread("r2", "bob", "hi all")
+	ctx.State.TrackUnread("r2", "bob", "@testuser look")
+	ctx.State.TrackUnread("r1", "bob", "seen, r1 is in focus")
+
+	registry.Dispatch(ctx, "/rooms")
+	if !strings.Contains(out.String(), "- r2 [unknown type] (joined), 2 unread, 1 mention\n") {
+		t.Errorf("/rooms printed:\n%s\nexpected the unread count of r2", out.String())
+	}
+
+	out.Reset()
+	registry.Dispatch(ctx, "/switch r2")
+	if out.String() != "Now talking in room r2 (2 unread, 1 mention)\n" {
+		t.Errorf("/switch r2 printed %q", out.String())
+	}
+	if ctx.State.GetCurrentRoom() != "r2" || ctx.State.Unread().Get("r2").Messages != 0 {
+		t.Error("Expected r2 to be in focus and read")
+	}
+
+	out.Reset()
+	registry.Dispatch(ctx, "/switch r3")
+	if !strings.Contains(out.String(), "Use /join r3 first") || ctx.State.GetCurrentRoom() != "r2" {
+		t.Errorf("/switch to a room not joined printed %q", out.String())
+	}
+
+	out.Reset()
+	registry.Dispatch(ctx, "/switch global")
+	if out.String() != "Now talking in global chat\n" || ctx.State.GetCurrentRoom() != "" {
+		t.Errorf("/switch global printed %q", out.String())
+	}
+}
+
+// testServers is a set of servers that are never connected
+type testServers struct {
+	names  []string
+	states map[string]*state.ClientState
+	focus  string
+}
+
+func (s *testServers) Names() []string { return s.names }
+
+func (s *testServers) Focus(name string) error {
+	if s.states[name] == nil {
+		return fmt.Errorf("no server named %q", name)
+	}
+	s.focus = name
+	return nil
+}
+
+func (s *testServers) State(name string) *state.ClientState { return s.states[name] }
+
+func TestServer(t *testing.T) {
+	registry := DefaultRegistry()
+	ctx, out := newTestContext()
+
+	registry.Dispatch(ctx, "/server")
+	if !strings.Contains(out.String(), "Only one server is configured") {
+		t.Errorf("/server without profiles printed %q", out.String())
+	}
+
+	staging := state.NewClientState("tester")
+	staging.SetCurrentRoom("room-1")
+	staging.TrackUnread("room-2", "bob", "hi")
+	servers := &testServers{names: []string{"prod", "staging"}, states: map[string]*state.ClientState{"prod": ctx.State, "staging": staging}, focus: "prod"}
+	ctx.Servers, ctx.Server = servers, "prod"
+
+	out.Reset()
+	registry.Dispatch(ctx, "/server")
+	expected := "Servers (2):\n- prod: disconnected (focus)\n- staging: disconnected, 1 unread\n"
+	if out.String() != expected {
+		t.Errorf("/server printed:\n%s\nexpected:\n%s", out.String(), expected)
+	}
+
+	out.Reset()
+	registry.Dispatch(ctx, "/server staging")
+	if out.String() != "Now talking on server staging, in room-1\n" {
+		t.Errorf("/server staging printed %q", out.String())
+	}
+	if servers.focus != "staging" || ctx.Server != "staging" || ctx.State != staging {
+		t.Error("Expected staging to be in focus and its state to be used by later commands")
+	}
+
+	out.Reset()
+	registry.Dispatch(ctx, "/server dev")
+	if !strings.Contains(out.String(), `no server named "dev"`) || ctx.Server != "staging" {
+		t.Errorf("/server dev printed %q", out.String())
+	}
+}
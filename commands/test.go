@@ -2,6 +2,7 @@ package commands
 
 import (
 	"fmt"
+	"os"
 	"strings"
 	"testing"
 
@@ -10,17 +11,17 @@ import (
 
 func TestHandlePing(t *testing.T) {
 	clientState := state.NewClientState("testuser")
-	handlePing(clientState) // Should not panic even if not connected
+	handlePing(&Context{State: clientState, Out: os.Stdout}, nil) // Should not panic even if not connected
 }
 
 func TestHandleStats(t *testing.T) {
 	clientState := state.NewClientState("testuser")
-	handleStats(clientState) // Should not panic
+	handleStats(&Context{State: clientState, Out: os.Stdout}, nil) // Should not panic
 }
 
 func TestHandleUsernameChange(t *testing.T) {
 	clientState := state.NewClientState("testuser")
-	handleUsernameChange(clientState, []string{"/username", "newuser"})
+	handleUsernameChange(&Context{State: clientState, Out: os.Stdout}, []string{"newuser"})
 
 	if clientState.GetUsername() != "newuser" {
 		t.Error("Expected username to be updated to 'newuser'")
@@ -29,7 +30,7 @@ func TestHandleUsernameChange(t *testing.T) {
 
 func TestHandleGlobalMessage(t *testing.T) {
 	clientState := state.NewClientState("testuser")
-	handleGlobalMessage(clientState, []string{"/global", "Hello World"})
+	handleGlobalMessage(&Context{State: clientState, Out: os.Stdout}, []string{"Hello", "World"})
 
 	// Check if message was tracked
 	stats := clientState.GetStats()
@@ -54,14 +55,12 @@ func NewTestCommand() *TestCommand {
 
 // Execute executes the test command
 func (c *TestCommand) Execute(clientState *state.ClientState) error {
-	if !checkClientConnected(clientState) {
+	if !checkClientConnected(&Context{State: clientState, Out: os.Stdout}) {
 		return fmt.Errorf("not connected to server")
 	}
 
 	// Send a test event
-	err := clientState.Client().Emit("test_event", []interface{}{
-		fmt.Sprintf("Test event from %s", clientState.GetUsername()),
-	})
+	err := clientState.Client().Emit("test_event", fmt.Sprintf("Test event from %s", clientState.GetUsername()))
 
 	if err != nil {
 		return fmt.Errorf("error sending test event: %v", err)
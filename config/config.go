@@ -0,0 +1,651 @@
+// config.go
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/BurntSushi/toml"
+	"github.com/jonipwi/go-chat-client/utils"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix is the prefix of every environment variable the client reads
+const EnvPrefix = "CHAT_"
+
+// Duration is a time.Duration that is written as "20s" or "1m" in config files
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalText parses a duration such as "20s"
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// MarshalText formats the duration as time.Duration.String does
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.Duration.String()), nil
+}
+
+// Config holds the client settings. Values are resolved in order of
+// precedence: flags, then environment variables, then the config file,
+// then the defaults.
+type Config struct {
+	Host              string     `json:"host" yaml:"host" toml:"host"`
+	Port              int        `json:"port" yaml:"port" toml:"port"`
+	Username          string     `json:"username" yaml:"username" toml:"username"`
+	HeartbeatInterval Duration   `json:"heartbeat_interval" yaml:"heartbeat_interval" toml:"heartbeat_interval"`
+	StatsInterval     Duration   `json:"stats_interval" yaml:"stats_interval" toml:"stats_interval"`
+	ConnectRetries    int        `json:"connect_retries" yaml:"connect_retries" toml:"connect_retries"`
+	LogFile           string     `json:"log_file" yaml:"log_file" toml:"log_file"` // Empty logs to the console only
+	LogLevel          string     `json:"log_level" yaml:"log_level" toml:"log_level"`
+	LogFormat         string     `json:"log_format" yaml:"log_format" toml:"log_format"`
+	LogMaxSize        int        `json:"log_max_size" yaml:"log_max_size" toml:"log_max_size"`             // Megabytes before the log file is rotated, 0 disables it
+	LogMaxBackups     int        `json:"log_max_backups" yaml:"log_max_backups" toml:"log_max_backups"`    // Rotated log files kept, 0 keeps all
+	LogMaxAge         Duration   `json:"log_max_age" yaml:"log_max_age" toml:"log_max_age"`                // Rotated log files older than this are deleted, 0 keeps them
+	LogRotateEvery    Duration   `json:"log_rotate_every" yaml:"log_rotate_every" toml:"log_rotate_every"` // Rotates the log file this often, 0 disables it
+	HistoryFile       string     `json:"history_file" yaml:"history_file" toml:"history_file"`             // Empty disables message history
+	MetricsAddr       string     `json:"metrics_addr" yaml:"metrics_addr" toml:"metrics_addr"`             // Address of the Prometheus endpoint, empty disables it
+	UI                string     `json:"ui" yaml:"ui" toml:"ui"`
+	TLS               TLSConfig  `json:"tls" yaml:"tls" toml:"tls"`
+	Auth              AuthConfig `json:"auth" yaml:"auth" toml:"auth"`
+	Bot               BotConfig  `json:"bot" yaml:"bot" toml:"bot"`
+
+	Name    string          `json:"name" yaml:"name" toml:"name"`          // Labels the server's messages when connected to several
+	Servers []ServerProfile `json:"servers" yaml:"servers" toml:"servers"` // Servers to connect to at once instead of Host and Port
+	Server  string          `json:"server" yaml:"server" toml:"server"`    // Server in focus on startup, by name; the first if empty
+}
+
+// ServerProfile is one of several servers the client connects to at once.
+// Settings it leaves empty are taken from the top level of the configuration.
+type ServerProfile struct {
+	Name     string      `json:"name" yaml:"name" toml:"name"`
+	Host     string      `json:"host" yaml:"host" toml:"host"`
+	Port     int         `json:"port" yaml:"port" toml:"port"`
+	Username string      `json:"username" yaml:"username" toml:"username"`
+	TLS      *TLSConfig  `json:"tls" yaml:"tls" toml:"tls"`
+	Auth     *AuthConfig `json:"auth" yaml:"auth" toml:"auth"`
+}
+
+// DefaultServerName names the server when no profiles are configured
+const DefaultServerName = "default"
+
+// TLSConfig holds the settings for connecting over https/wss
+type TLSConfig struct {
+	Enabled            bool   `json:"enabled" yaml:"enabled" toml:"enabled"`
+	CAFile             string `json:"ca_file" yaml:"ca_file" toml:"ca_file"`       // PEM bundle trusted in addition to the system roots
+	CertFile           string `json:"cert_file" yaml:"cert_file" toml:"cert_file"` // Client certificate, requires KeyFile
+	KeyFile            string `json:"key_file" yaml:"key_file" toml:"key_file"`
+	ServerName         string `json:"server_name" yaml:"server_name" toml:"server_name"` // Overrides the host name the certificate is checked against
+	InsecureSkipVerify bool   `json:"insecure_skip_verify" yaml:"insecure_skip_verify" toml:"insecure_skip_verify"`
+}
+
+// User interface modes
+const (
+	UIAuto = "auto" // Full-screen UI when running in a terminal, line mode otherwise
+	UITUI  = "tui"  // Full-screen UI with room list and message panes
+	UIREPL = "repl" // Line-based prompt
+)
+
+// Authentication methods
+const (
+	AuthNone  = ""      // Identify by username only
+	AuthToken = "token" // Static bearer token
+	AuthFile  = "file"  // Token read from a file, re-read when it expires
+	AuthEnv   = "env"   // Token read from an environment variable
+	AuthLogin = "login" // Username and password exchanged for a token
+)
+
+// Where the token is sent in the handshake
+const (
+	SendAsHeader = "header" // Authorization: Bearer <token>
+	SendAsQuery  = "query"  // ?token=<token>
+	SendAsBoth   = "both"
+)
+
+// AuthConfig holds the settings for authenticating the Socket.IO handshake
+type AuthConfig struct {
+	Method        string   `json:"method" yaml:"method" toml:"method"`
+	Token         string   `json:"token" yaml:"token" toml:"token"`
+	TokenFile     string   `json:"token_file" yaml:"token_file" toml:"token_file"`
+	TokenEnv      string   `json:"token_env" yaml:"token_env" toml:"token_env"` // Name of the variable holding the token
+	LoginURL      string   `json:"login_url" yaml:"login_url" toml:"login_url"` // Logs in as the configured username
+	Password      string   `json:"password" yaml:"password" toml:"password"`
+	SendAs        string   `json:"send_as" yaml:"send_as" toml:"send_as"`
+	RefreshBefore Duration `json:"refresh_before" yaml:"refresh_before" toml:"refresh_before"` // How long before expiry a token is renewed
+}
+
+// BotConfig holds the settings of clients running as bots, see package bot
+type BotConfig struct {
+	Prefix   string   `json:"prefix" yaml:"prefix" toml:"prefix"`       // Starts a bot command, e.g. "!" in "!help"
+	Admins   []string `json:"admins" yaml:"admins" toml:"admins"`       // User IDs allowed to run admin commands, not usernames, which anyone can take
+	Cooldown Duration `json:"cooldown" yaml:"cooldown" toml:"cooldown"` // How long a user waits between two runs of a command
+}
+
+// Default returns the settings the client used before it was configurable
+func Default() Config {
+	return Config{
+		Host:              "127.0.0.1",
+		Port:              8000,
+		Username:          "GoClient",
+		HeartbeatInterval: Duration{20 * time.Second},
+		StatsInterval:     Duration{1 * time.Minute},
+		ConnectRetries:    3,
+		LogFile:           "chat_client.log",
+		LogLevel:          "info",
+		LogFormat:         utils.LogFormatText,
+		LogMaxSize:        10,
+		LogMaxBackups:     5,
+		HistoryFile:       "chat_history.db",
+		UI:                UIAuto,
+		Auth: AuthConfig{
+			SendAs:        SendAsHeader,
+			RefreshBefore: Duration{1 * time.Minute},
+		},
+		Bot: BotConfig{
+			Prefix:   "!",
+			Cooldown: Duration{3 * time.Second},
+		},
+	}
+}
+
+// Load resolves the configuration from the command-line arguments (without
+// the program name) and the environment. The config file is taken from the
+// -config flag or the CHAT_CONFIG variable. flag.ErrHelp is returned if
+// -h or -help was given.
+func Load(args []string, getenv func(string) string) (Config, error) {
+	cfg := Default()
+
+	fs := flag.NewFlagSet("go-chat-client", flag.ContinueOnError)
+	flags := cfg.bindFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+	if fs.NArg() > 0 {
+		return cfg, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	path := getenv(EnvPrefix + "CONFIG")
+	if flags.config != "" {
+		path = flags.config
+	}
+	if path != "" {
+		if err := cfg.LoadFile(path); err != nil {
+			return cfg, err
+		}
+	}
+	if err := cfg.ApplyEnv(getenv); err != nil {
+		return cfg, err
+	}
+	flags.apply(fs, &cfg)
+
+	return cfg, cfg.Validate()
+}
+
+// LoadFile overlays the settings in a JSON, YAML or TOML file, picked by
+// extension. Settings missing from the file keep their current value.
+func (c *Config) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading config file: %w", err)
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		err = json.Unmarshal(data, c)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, c)
+	case ".toml":
+		err = toml.Unmarshal(data, c)
+	default:
+		return fmt.Errorf("unsupported config file type %q (use .json, .yaml or .toml)", ext)
+	}
+	if err != nil {
+		return fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// ApplyEnv overlays the CHAT_* environment variables that are set
+func (c *Config) ApplyEnv(getenv func(string) string) error {
+	for _, v := range []struct {
+		name string
+		set  func(string) error
+	}{
+		{"HOST", setString(&c.Host)},
+		{"PORT", setInt(&c.Port)},
+		{"USERNAME", setString(&c.Username)},
+		{"HEARTBEAT_INTERVAL", c.HeartbeatInterval.set},
+		{"STATS_INTERVAL", c.StatsInterval.set},
+		{"CONNECT_RETRIES", setInt(&c.ConnectRetries)},
+		{"LOG_FILE", setString(&c.LogFile)},
+		{"LOG_LEVEL", setString(&c.LogLevel)},
+		{"LOG_FORMAT", setString(&c.LogFormat)},
+		{"LOG_MAX_SIZE", setInt(&c.LogMaxSize)},
+		{"LOG_MAX_BACKUPS", setInt(&c.LogMaxBackups)},
+		{"LOG_MAX_AGE", c.LogMaxAge.set},
+		{"LOG_ROTATE_EVERY", c.LogRotateEvery.set},
+		{"HISTORY_FILE", setString(&c.HistoryFile)},
+		{"METRICS_ADDR", setString(&c.MetricsAddr)},
+		{"UI", setString(&c.UI)},
+		{"TLS", setBool(&c.TLS.Enabled)},
+		{"TLS_CA", setString(&c.TLS.CAFile)},
+		{"TLS_CERT", setString(&c.TLS.CertFile)},
+		{"TLS_KEY", setString(&c.TLS.KeyFile)},
+		{"TLS_SERVER_NAME", setString(&c.TLS.ServerName)},
+		{"TLS_INSECURE_SKIP_VERIFY", setBool(&c.TLS.InsecureSkipVerify)},
+		{"AUTH", setString(&c.Auth.Method)},
+		{"AUTH_TOKEN", setString(&c.Auth.Token)},
+		{"AUTH_TOKEN_FILE", setString(&c.Auth.TokenFile)},
+		{"AUTH_TOKEN_ENV", setString(&c.Auth.TokenEnv)},
+		{"AUTH_LOGIN_URL", setString(&c.Auth.LoginURL)},
+		{"AUTH_PASSWORD", setString(&c.Auth.Password)},
+		{"AUTH_SEND_AS", setString(&c.Auth.SendAs)},
+		{"AUTH_REFRESH_BEFORE", c.Auth.RefreshBefore.set},
+		{"SERVER", setString(&c.Server)},
+		{"BOT_PREFIX", setString(&c.Bot.Prefix)},
+		{"BOT_ADMINS", setList(&c.Bot.Admins)},
+		{"BOT_COOLDOWN", c.Bot.Cooldown.set},
+	} {
+		value, ok := lookup(getenv, EnvPrefix+v.name)
+		if !ok {
+			continue
+		}
+		if err := v.set(value); err != nil {
+			return fmt.Errorf("invalid %s%s: %w", EnvPrefix, v.name, err)
+		}
+	}
+	return nil
+}
+
+// Validate checks that the settings can be used to start the client
+func (c Config) Validate() error {
+	var errs []error
+	if strings.TrimSpace(c.Host) == "" {
+		errs = append(errs, errors.New("host must not be empty"))
+	}
+	if c.Port < 1 || c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("port %d is out of range", c.Port))
+	}
+	if err := utils.ValidateUsername(c.Username); err != nil {
+		errs = append(errs, fmt.Errorf("invalid username: %w", err))
+	}
+	if c.HeartbeatInterval.Duration <= 0 {
+		errs = append(errs, errors.New("heartbeat interval must be positive"))
+	}
+	if c.StatsInterval.Duration <= 0 {
+		errs = append(errs, errors.New("stats interval must be positive"))
+	}
+	if c.ConnectRetries < 1 {
+		errs = append(errs, errors.New("connect retries must be at least 1"))
+	}
+	if _, err := utils.ParseLogLevel(c.LogLevel); err != nil {
+		errs = append(errs, err)
+	}
+	switch c.LogFormat {
+	case utils.LogFormatText, utils.LogFormatJSON:
+	default:
+		errs = append(errs, fmt.Errorf("log format must be text or json, not %q", c.LogFormat))
+	}
+	if c.LogMaxSize < 0 || c.LogMaxBackups < 0 || c.LogMaxAge.Duration < 0 || c.LogRotateEvery.Duration < 0 {
+		errs = append(errs, errors.New("log rotation limits must not be negative"))
+	}
+	switch c.UI {
+	case UIAuto, UITUI, UIREPL:
+	default:
+		errs = append(errs, fmt.Errorf("ui must be auto, tui or repl, not %q", c.UI))
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		errs = append(errs, errors.New("tls client certificate and key must be set together"))
+	}
+	if !c.TLS.Enabled && c.TLS != (TLSConfig{}) {
+		errs = append(errs, errors.New("tls options are set but tls is not enabled"))
+	}
+	errs = append(errs, c.Auth.validate())
+	errs = append(errs, c.validateServers())
+	errs = append(errs, c.Bot.validate())
+	return errors.Join(errs...)
+}
+
+// Profiles returns the settings of each server to connect to, in the order
+// they are configured: one per server profile, or the top-level settings if
+// there are none. With several servers, each gets its own history file, named
+// after the history file with the server name added, e.g. chat_history-staging.db.
+func (c Config) Profiles() []Config {
+	if len(c.Servers) == 0 {
+		cfg := c
+		if cfg.Name == "" {
+			cfg.Name = DefaultServerName
+		}
+		return []Config{cfg}
+	}
+
+	profiles := make([]Config, 0, len(c.Servers))
+	for _, p := range c.Servers {
+		cfg := c
+		cfg.Servers, cfg.Server = nil, ""
+		cfg.Name = p.Name
+		if p.Host != "" {
+			cfg.Host = p.Host
+		}
+		if p.Port != 0 {
+			cfg.Port = p.Port
+		}
+		if p.Username != "" {
+			cfg.Username = p.Username
+		}
+		if p.TLS != nil {
+			cfg.TLS = *p.TLS
+		}
+		if p.Auth != nil {
+			cfg.Auth = *p.Auth
+			if cfg.Auth.SendAs == "" {
+				cfg.Auth.SendAs = c.Auth.SendAs
+			}
+			if cfg.Auth.RefreshBefore.Duration == 0 {
+				cfg.Auth.RefreshBefore = c.Auth.RefreshBefore
+			}
+		}
+		if c.HistoryFile != "" && len(c.Servers) > 1 {
+			ext := filepath.Ext(c.HistoryFile)
+			cfg.HistoryFile = strings.TrimSuffix(c.HistoryFile, ext) + "-" + p.Name + ext
+		}
+		profiles = append(profiles, cfg)
+	}
+	return profiles
+}
+
+// validateServers checks the server profiles and the server in focus
+func (c Config) validateServers() error {
+	if len(c.Servers) == 0 {
+		if c.Server != "" && c.Server != c.Name && c.Server != DefaultServerName {
+			return fmt.Errorf("server %q is not configured", c.Server)
+		}
+		return nil
+	}
+
+	var errs []error
+	seen := make(map[string]bool)
+	for i, profile := range c.Profiles() {
+		name := profile.Name
+		switch {
+		case name == "":
+			errs = append(errs, fmt.Errorf("server %d has no name", i+1))
+			continue
+		case strings.ContainsAny(name, " \t/"):
+			errs = append(errs, fmt.Errorf("server name %q must not contain spaces or slashes", name))
+		case seen[name]:
+			errs = append(errs, fmt.Errorf("server name %q is used twice", name))
+		}
+		seen[name] = true
+		if err := profile.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("server %s: %w", name, err))
+		}
+	}
+	if c.Server != "" && !seen[c.Server] {
+		errs = append(errs, fmt.Errorf("server %q is not configured", c.Server))
+	}
+	return errors.Join(errs...)
+}
+
+// LogOptions returns the logging settings in the form utils.ConfigureLogging takes
+func (c Config) LogOptions() utils.LogOptions {
+	return utils.LogOptions{
+		Level:  c.LogLevel,
+		Format: c.LogFormat,
+		File:   c.LogFile,
+		Rotation: utils.RotationOptions{
+			MaxSize:    int64(c.LogMaxSize) << 20,
+			Interval:   c.LogRotateEvery.Duration,
+			MaxBackups: c.LogMaxBackups,
+			MaxAge:     c.LogMaxAge.Duration,
+		},
+	}
+}
+
+// validate checks that the settings the auth method needs are set
+func (a AuthConfig) validate() error {
+	var errs []error
+	switch a.Method {
+	case AuthNone:
+	case AuthToken:
+		if a.Token == "" {
+			errs = append(errs, errors.New("auth method token requires a token"))
+		}
+	case AuthFile:
+		if a.TokenFile == "" {
+			errs = append(errs, errors.New("auth method file requires a token file"))
+		}
+	case AuthEnv:
+		if a.TokenEnv == "" {
+			errs = append(errs, errors.New("auth method env requires a token variable name"))
+		}
+	case AuthLogin:
+		if a.LoginURL == "" || a.Password == "" {
+			errs = append(errs, errors.New("auth method login requires a login URL and a password"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown auth method %q", a.Method))
+	}
+	switch a.SendAs {
+	case SendAsHeader, SendAsQuery, SendAsBoth:
+	default:
+		errs = append(errs, fmt.Errorf("auth send_as must be header, query or both, not %q", a.SendAs))
+	}
+	if a.RefreshBefore.Duration < 0 {
+		errs = append(errs, errors.New("auth refresh_before must not be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+// validate checks the bot prefix and cooldown
+func (b BotConfig) validate() error {
+	var errs []error
+	if b.Prefix == "" || strings.ContainsFunc(b.Prefix, unicode.IsSpace) {
+		errs = append(errs, fmt.Errorf("bot prefix %q must be set and contain no spaces", b.Prefix))
+	}
+	if b.Cooldown.Duration < 0 {
+		errs = append(errs, errors.New("bot cooldown must not be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+// Usage writes the flag documentation to w
+func Usage(w io.Writer) {
+	fs := flag.NewFlagSet("go-chat-client", flag.ContinueOnError)
+	cfg := Default()
+	cfg.bindFlags(fs)
+	fs.SetOutput(w)
+	fmt.Fprintln(w, "Usage: go-chat-client [flags]")
+	fs.PrintDefaults()
+	fmt.Fprintf(w, "\nEvery flag can also be set with a %s variable, e.g. %sHEARTBEAT_INTERVAL=30s or %sTLS_CA=ca.pem.\n", EnvPrefix, EnvPrefix, EnvPrefix)
+}
+
+// flagValues holds the parsed flags until the file and environment are applied
+type flagValues struct {
+	config string
+	values Config
+}
+
+// bindFlags defines the flags on fs, using the current settings as defaults
+func (c Config) bindFlags(fs *flag.FlagSet) *flagValues {
+	f := &flagValues{values: c}
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&f.config, "config", "", "path to a .json, .yaml or .toml config file")
+	fs.StringVar(&f.values.Host, "host", c.Host, "server host")
+	fs.IntVar(&f.values.Port, "port", c.Port, "server port")
+	fs.StringVar(&f.values.Username, "username", c.Username, "username to connect as")
+	fs.DurationVar(&f.values.HeartbeatInterval.Duration, "heartbeat-interval", c.HeartbeatInterval.Duration, "interval between heartbeats")
+	fs.DurationVar(&f.values.StatsInterval.Duration, "stats-interval", c.StatsInterval.Duration, "interval between stats reports")
+	fs.IntVar(&f.values.ConnectRetries, "connect-retries", c.ConnectRetries, "connection attempts on startup")
+	fs.StringVar(&f.values.LogFile, "log-file", c.LogFile, "log file path, empty to log to the console only")
+	fs.StringVar(&f.values.LogLevel, "log-level", c.LogLevel, "log level: debug, info, warn or error")
+	fs.StringVar(&f.values.LogFormat, "log-format", c.LogFormat, "log format: text or json")
+	fs.IntVar(&f.values.LogMaxSize, "log-max-size", c.LogMaxSize, "rotate the log file once it reaches this many megabytes, 0 to disable")
+	fs.IntVar(&f.values.LogMaxBackups, "log-max-backups", c.LogMaxBackups, "rotated log files to keep, 0 to keep all")
+	fs.DurationVar(&f.values.LogMaxAge.Duration, "log-max-age", c.LogMaxAge.Duration, "delete rotated log files older than this, 0 to keep them")
+	fs.DurationVar(&f.values.LogRotateEvery.Duration, "log-rotate-every", c.LogRotateEvery.Duration, "rotate the log file this often, e.g. 24h, 0 to disable")
+	fs.StringVar(&f.values.HistoryFile, "history-file", c.HistoryFile, "message history file, empty to disable /history and /search")
+	fs.StringVar(&f.values.MetricsAddr, "metrics-addr", c.MetricsAddr, "serve Prometheus metrics on this address, e.g. 127.0.0.1:9100")
+	fs.StringVar(&f.values.UI, "ui", c.UI, "user interface: tui, repl, or auto to use the tui in a terminal")
+	fs.BoolVar(&f.values.TLS.Enabled, "tls", c.TLS.Enabled, "connect over https/wss")
+	fs.StringVar(&f.values.TLS.CAFile, "tls-ca", c.TLS.CAFile, "PEM file with additional CA certificates to trust")
+	fs.StringVar(&f.values.TLS.CertFile, "tls-cert", c.TLS.CertFile, "PEM client certificate")
+	fs.StringVar(&f.values.TLS.KeyFile, "tls-key", c.TLS.KeyFile, "PEM client certificate key")
+	fs.StringVar(&f.values.TLS.ServerName, "tls-server-name", c.TLS.ServerName, "server name to verify the certificate against")
+	fs.BoolVar(&f.values.TLS.InsecureSkipVerify, "tls-insecure-skip-verify", c.TLS.InsecureSkipVerify, "skip certificate verification (local testing only)")
+	fs.StringVar(&f.values.Auth.Method, "auth", c.Auth.Method, "authentication method: token, file, env or login")
+	fs.StringVar(&f.values.Auth.Token, "auth-token", c.Auth.Token, "bearer token for -auth token")
+	fs.StringVar(&f.values.Auth.TokenFile, "auth-token-file", c.Auth.TokenFile, "file holding the token for -auth file")
+	fs.StringVar(&f.values.Auth.TokenEnv, "auth-token-env", c.Auth.TokenEnv, "environment variable holding the token for -auth env")
+	fs.StringVar(&f.values.Auth.LoginURL, "auth-login-url", c.Auth.LoginURL, "login endpoint for -auth login, the password is read from CHAT_AUTH_PASSWORD or the config file")
+	fs.StringVar(&f.values.Auth.SendAs, "auth-send-as", c.Auth.SendAs, "send the token as a header, query parameter or both")
+	fs.DurationVar(&f.values.Auth.RefreshBefore.Duration, "auth-refresh-before", c.Auth.RefreshBefore.Duration, "renew tokens this long before they expire")
+	fs.StringVar(&f.values.Server, "server", c.Server, "name of the server profile in focus on startup")
+	fs.StringVar(&f.values.Bot.Prefix, "bot-prefix", c.Bot.Prefix, "prefix of bot commands")
+	fs.Func("bot-admins", "comma-separated user IDs allowed to run admin bot commands", setList(&f.values.Bot.Admins))
+	fs.DurationVar(&f.values.Bot.Cooldown.Duration, "bot-cooldown", c.Bot.Cooldown.Duration, "how long a user waits between two runs of a bot command")
+	return f
+}
+
+// apply copies the flags that were set explicitly onto cfg
+func (f *flagValues) apply(fs *flag.FlagSet, cfg *Config) {
+	fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "host":
+			cfg.Host = f.values.Host
+		case "port":
+			cfg.Port = f.values.Port
+		case "username":
+			cfg.Username = f.values.Username
+		case "heartbeat-interval":
+			cfg.HeartbeatInterval = f.values.HeartbeatInterval
+		case "stats-interval":
+			cfg.StatsInterval = f.values.StatsInterval
+		case "connect-retries":
+			cfg.ConnectRetries = f.values.ConnectRetries
+		case "log-file":
+			cfg.LogFile = f.values.LogFile
+		case "log-level":
+			cfg.LogLevel = f.values.LogLevel
+		case "log-format":
+			cfg.LogFormat = f.values.LogFormat
+		case "log-max-size":
+			cfg.LogMaxSize = f.values.LogMaxSize
+		case "log-max-backups":
+			cfg.LogMaxBackups = f.values.LogMaxBackups
+		case "log-max-age":
+			cfg.LogMaxAge = f.values.LogMaxAge
+		case "log-rotate-every":
+			cfg.LogRotateEvery = f.values.LogRotateEvery
+		case "history-file":
+			cfg.HistoryFile = f.values.HistoryFile
+		case "metrics-addr":
+			cfg.MetricsAddr = f.values.MetricsAddr
+		case "ui":
+			cfg.UI = f.values.UI
+		case "tls":
+			cfg.TLS.Enabled = f.values.TLS.Enabled
+		case "tls-ca":
+			cfg.TLS.CAFile = f.values.TLS.CAFile
+		case "tls-cert":
+			cfg.TLS.CertFile = f.values.TLS.CertFile
+		case "tls-key":
+			cfg.TLS.KeyFile = f.values.TLS.KeyFile
+		case "tls-server-name":
+			cfg.TLS.ServerName = f.values.TLS.ServerName
+		case "tls-insecure-skip-verify":
+			cfg.TLS.InsecureSkipVerify = f.values.TLS.InsecureSkipVerify
+		case "auth":
+			cfg.Auth.Method = f.values.Auth.Method
+		case "auth-token":
+			cfg.Auth.Token = f.values.Auth.Token
+		case "auth-token-file":
+			cfg.Auth.TokenFile = f.values.Auth.TokenFile
+		case "auth-token-env":
+			cfg.Auth.TokenEnv = f.values.Auth.TokenEnv
+		case "auth-login-url":
+			cfg.Auth.LoginURL = f.values.Auth.LoginURL
+		case "auth-send-as":
+			cfg.Auth.SendAs = f.values.Auth.SendAs
+		case "auth-refresh-before":
+			cfg.Auth.RefreshBefore = f.values.Auth.RefreshBefore
+		case "server":
+			cfg.Server = f.values.Server
+		case "bot-prefix":
+			cfg.Bot.Prefix = f.values.Bot.Prefix
+		case "bot-admins":
+			cfg.Bot.Admins = f.values.Bot.Admins
+		case "bot-cooldown":
+			cfg.Bot.Cooldown = f.values.Bot.Cooldown
+		}
+	})
+}
+
+// lookup returns an environment variable and whether it is set to a non-empty value
+func lookup(getenv func(string) string, name string) (string, bool) {
+	value := getenv(name)
+	return value, value != ""
+}
+
+func setString(dst *string) func(string) error {
+	return func(value string) error {
+		*dst = value
+		return nil
+	}
+}
+
+func setInt(dst *int) func(string) error {
+	return func(value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*dst = n
+		return nil
+	}
+}
+
+func setBool(dst *bool) func(string) error {
+	return func(value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*dst = b
+		return nil
+	}
+}
+
+// setList sets a comma-separated list, leaving out blank entries
+func setList(dst *[]string) func(string) error {
+	return func(value string) error {
+		var list []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		*dst = list
+		return nil
+	}
+}
+
+func (d *Duration) set(value string) error {
+	return d.UnmarshalText([]byte(value))
+}
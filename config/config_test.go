@@ -0,0 +1,258 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func env(vars map[string]string) func(string) string {
+	return func(name string) string { return vars[name] }
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := Load(nil, env(nil))
+	if err != nil {
+		t.Fatalf("Load returned %v", err)
+	}
+	if !reflect.DeepEqual(cfg, Default()) {
+		t.Errorf("Load() = %+v; expected the defaults %+v", cfg, Default())
+	}
+}
+
+func TestLoadFileFormats(t *testing.T) {
+	files := map[string]string{
+		"client.json": `{"host": "chat.example.com", "port": 9000, "heartbeat_interval": "30s"}`,
+		"client.yaml": "host: chat.example.com\nport: 9000\nheartbeat_interval: 30s\n",
+		"client.toml": "host = \"chat.example.com\"\nport = 9000\nheartbeat_interval = \"30s\"\n",
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			cfg := Default()
+			if err := cfg.LoadFile(writeFile(t, name, content)); err != nil {
+				t.Fatalf("LoadFile returned %v", err)
+			}
+			if cfg.Host != "chat.example.com" || cfg.Port != 9000 || cfg.HeartbeatInterval.Duration != 30*time.Second {
+				t.Errorf("Unexpected config: %+v", cfg)
+			}
+			// Settings missing from the file keep their defaults
+			if cfg.Username != "GoClient" || cfg.ConnectRetries != 3 {
+				t.Errorf("Expected unset values to keep their defaults, got %+v", cfg)
+			}
+		})
+	}
+
+	cfg := Default()
+	if err := cfg.LoadFile(writeFile(t, "client.ini", "host=x")); err == nil {
+		t.Error("Expected an unsupported extension to be rejected")
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, "client.yaml", "host: file-host\nport: 9000\nusername: fileuser\nstats_interval: 2m\n")
+	vars := map[string]string{
+		"CHAT_CONFIG":   path,
+		"CHAT_PORT":     "9100",
+		"CHAT_USERNAME": "envuser",
+	}
+
+	cfg, err := Load([]string{"-username", "flaguser"}, env(vars))
+	if err != nil {
+		t.Fatalf("Load returned %v", err)
+	}
+
+	if cfg.Host != "file-host" {
+		t.Errorf("Host = %q; expected the file value", cfg.Host)
+	}
+	if cfg.Port != 9100 {
+		t.Errorf("Port = %d; expected the environment to override the file", cfg.Port)
+	}
+	if cfg.Username != "flaguser" {
+		t.Errorf("Username = %q; expected the flag to override the environment", cfg.Username)
+	}
+	if cfg.StatsInterval.Duration != 2*time.Minute {
+		t.Errorf("StatsInterval = %v; expected the file value", cfg.StatsInterval)
+	}
+	if cfg.HeartbeatInterval.Duration != 20*time.Second {
+		t.Errorf("HeartbeatInterval = %v; expected the default", cfg.HeartbeatInterval)
+	}
+}
+
+func TestLoadTLS(t *testing.T) {
+	path := writeFile(t, "client.toml", "[tls]\nenabled = true\nca_file = \"ca.pem\"\n")
+	vars := map[string]string{"CHAT_TLS_SERVER_NAME": "staging.example.com"}
+
+	cfg, err := Load([]string{"-config", path, "-tls-insecure-skip-verify"}, env(vars))
+	if err != nil {
+		t.Fatalf("Load returned %v", err)
+	}
+	expected := TLSConfig{Enabled: true, CAFile: "ca.pem", ServerName: "staging.example.com", InsecureSkipVerify: true}
+	if cfg.TLS != expected {
+		t.Errorf("TLS = %+v; expected %+v", cfg.TLS, expected)
+	}
+}
+
+func TestLoadLogOptions(t *testing.T) {
+	vars := map[string]string{"CHAT_LOG_FORMAT": "json", "CHAT_LOG_ROTATE_EVERY": "24h"}
+
+	cfg, err := Load([]string{"-log-level", "debug", "-log-max-size", "2", "-log-max-backups", "3"}, env(vars))
+	if err != nil {
+		t.Fatalf("Load returned %v", err)
+	}
+	opts := cfg.LogOptions()
+	if opts.Level != "debug" || opts.Format != "json" || opts.File != "chat_client.log" {
+		t.Errorf("LogOptions() = %+v", opts)
+	}
+	if opts.Rotation.MaxSize != 2<<20 || opts.Rotation.MaxBackups != 3 || opts.Rotation.Interval != 24*time.Hour {
+		t.Errorf("Rotation = %+v", opts.Rotation)
+	}
+}
+
+func TestLoadBot(t *testing.T) {
+	path := writeFile(t, "client.yaml", "bot:\n  prefix: \"?\"\n  admins: [alice]\n")
+	vars := map[string]string{"CHAT_BOT_COOLDOWN": "10s"}
+
+	cfg, err := Load([]string{"-config", path}, env(vars))
+	if err != nil {
+		t.Fatalf("Load returned %v", err)
+	}
+	expected := BotConfig{Prefix: "?", Admins: []string{"alice"}, Cooldown: Duration{10 * time.Second}}
+	if !reflect.DeepEqual(cfg.Bot, expected) {
+		t.Errorf("Bot = %+v; expected %+v", cfg.Bot, expected)
+	}
+
+	cfg, err = Load([]string{"-bot-admins", "alice, bob,"}, env(nil))
+	if err != nil {
+		t.Fatalf("Load returned %v", err)
+	}
+	if !reflect.DeepEqual(cfg.Bot.Admins, []string{"alice", "bob"}) || cfg.Bot.Prefix != "!" {
+		t.Errorf("Bot = %+v; expected the admins from the flag and the default prefix", cfg.Bot)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		vars map[string]string
+		want string
+	}{
+		{"invalid username", []string{"-username", "a!"}, nil, "invalid username"},
+		{"port out of range", []string{"-port", "70000"}, nil, "port 70000 is out of range"},
+		{"bad env duration", nil, map[string]string{"CHAT_HEARTBEAT_INTERVAL": "soon"}, "invalid CHAT_HEARTBEAT_INTERVAL"},
+		{"zero retries", []string{"-connect-retries", "0"}, nil, "connect retries"},
+		{"missing file", []string{"-config", "does-not-exist.json"}, nil, "error reading config file"},
+		{"cert without key", []string{"-tls", "-tls-cert", "client.pem"}, nil, "certificate and key must be set together"},
+		{"tls options without tls", nil, map[string]string{"CHAT_TLS_CA": "ca.pem"}, "tls is not enabled"},
+		{"bad env bool", nil, map[string]string{"CHAT_TLS": "maybe"}, "invalid CHAT_TLS"},
+		{"login without password", []string{"-auth", "login", "-auth-login-url", "https://chat.example.com/login"}, nil, "requires a login URL and a password"},
+		{"unknown auth method", []string{"-auth", "magic"}, nil, `unknown auth method "magic"`},
+		{"bad send as", nil, map[string]string{"CHAT_AUTH_SEND_AS": "cookie"}, "send_as must be header, query or both"},
+		{"unknown log level", []string{"-log-level", "verbose"}, nil, `unknown log level "verbose"`},
+		{"unknown log format", nil, map[string]string{"CHAT_LOG_FORMAT": "xml"}, "log format must be text or json"},
+		{"negative log size", []string{"-log-max-size", "-1"}, nil, "log rotation limits must not be negative"},
+		{"unknown server", []string{"-server", "staging"}, nil, `server "staging" is not configured`},
+		{"bot prefix with space", []string{"-bot-prefix", "! "}, nil, "bot prefix"},
+		{"negative bot cooldown", nil, map[string]string{"CHAT_BOT_COOLDOWN": "-1s"}, "bot cooldown must not be negative"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Load(test.args, env(test.vars))
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("Load error = %v; expected it to mention %q", err, test.want)
+			}
+		})
+	}
+
+	if _, err := Load([]string{"-h"}, env(nil)); !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("Expected -h to return flag.ErrHelp, got %v", err)
+	}
+}
+
+func TestServerProfiles(t *testing.T) {
+	path := writeFile(t, "client.yaml", `
+username: alice
+history_file: history.db
+auth:
+  method: token
+  token: shared
+servers:
+  - name: prod
+    host: chat.example.com
+    tls:
+      enabled: true
+  - name: staging
+    host: staging.example.com
+    port: 9000
+    username: alice-test
+    auth:
+      method: env
+      token_env: STAGING_TOKEN
+`)
+	cfg, err := Load([]string{"-config", path, "-server", "staging"}, env(nil))
+	if err != nil {
+		t.Fatalf("Load returned %v", err)
+	}
+	if cfg.Server != "staging" {
+		t.Errorf("Server = %q; expected the flag to set it", cfg.Server)
+	}
+
+	profiles := cfg.Profiles()
+	if len(profiles) != 2 {
+		t.Fatalf("Expected 2 profiles, got %d", len(profiles))
+	}
+	prod, staging := profiles[0], profiles[1]
+	if prod.Name != "prod" || prod.Host != "chat.example.com" || prod.Port != 8000 || prod.Username != "alice" || !prod.TLS.Enabled {
+		t.Errorf("Unexpected prod profile: %+v", prod)
+	}
+	if prod.Auth.Token != "shared" || prod.HistoryFile != "history-prod.db" || prod.Servers != nil {
+		t.Errorf("Expected prod to inherit the top-level auth and get its own history file, got %+v", prod)
+	}
+	if staging.Port != 9000 || staging.Username != "alice-test" || staging.TLS.Enabled {
+		t.Errorf("Unexpected staging profile: %+v", staging)
+	}
+	if staging.Auth.Method != AuthEnv || staging.Auth.SendAs != SendAsHeader || staging.HistoryFile != "history-staging.db" {
+		t.Errorf("Expected staging's auth to replace the top-level one with defaults filled in, got %+v", staging.Auth)
+	}
+
+	// Without profiles there is one server, named after the default
+	if profiles := Default().Profiles(); len(profiles) != 1 || profiles[0].Name != DefaultServerName {
+		t.Errorf("Default().Profiles() = %+v", profiles)
+	}
+}
+
+func TestServerProfileErrors(t *testing.T) {
+	tests := []struct {
+		servers []ServerProfile
+		want    string
+	}{
+		{[]ServerProfile{{Host: "a"}}, "server 1 has no name"},
+		{[]ServerProfile{{Name: "a"}, {Name: "a"}}, `server name "a" is used twice`},
+		{[]ServerProfile{{Name: "a b"}}, "must not contain spaces"},
+		{[]ServerProfile{{Name: "a", Port: 70000}}, "server a: port 70000 is out of range"},
+		{[]ServerProfile{{Name: "a", Auth: &AuthConfig{Method: AuthToken}}}, "server a: auth method token requires a token"},
+	}
+	for _, test := range tests {
+		cfg := Default()
+		cfg.Servers = test.servers
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("Validate() = %v; expected it to mention %q", err, test.want)
+		}
+	}
+}
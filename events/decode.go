@@ -0,0 +1,215 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// isObject reports whether raw holds a JSON object
+func isObject(raw json.RawMessage) bool {
+	for _, b := range raw {
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		case '{':
+			return true
+		}
+		return false
+	}
+	return false
+}
+
+// decodeString decodes a JSON string, or returns the raw text of any other value
+func decodeString(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	if string(raw) == "null" {
+		return ""
+	}
+	return string(raw)
+}
+
+// decodeTimestamp accepts RFC3339 strings and Unix timestamps in milliseconds
+func decodeTimestamp(raw json.RawMessage) time.Time {
+	if len(raw) == 0 {
+		return time.Time{}
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			return t
+		}
+		if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return time.UnixMilli(ms)
+		}
+		return time.Time{}
+	}
+	var ms float64
+	if err := json.Unmarshal(raw, &ms); err == nil {
+		return time.UnixMilli(int64(ms))
+	}
+	return time.Time{}
+}
+
+// decodeMessage builds a Message from an object payload or from positional
+// arguments. fields names the positional arguments in order, using the
+// Message JSON keys ("room", "sender", "content").
+func decodeMessage(args []json.RawMessage, msgType string, fields ...string) (Message, error) {
+	msg := Message{Type: msgType}
+	if len(args) == 0 {
+		return msg, fmt.Errorf("empty %s payload", msgType)
+	}
+
+	if isObject(args[0]) {
+		var wire struct {
+			Message
+			Timestamp json.RawMessage `json:"timestamp"`
+		}
+		if err := json.Unmarshal(args[0], &wire); err != nil {
+			return msg, fmt.Errorf("invalid %s payload: %w", msgType, err)
+		}
+		msg = wire.Message
+		msg.Timestamp = decodeTimestamp(wire.Timestamp)
+		if msg.Type == "" {
+			msg.Type = msgType
+		}
+	} else {
+		// The content is always the last argument, even if fewer were sent
+		if len(args) < len(fields) {
+			fields = fields[len(fields)-len(args):]
+		}
+		for i, field := range fields {
+			value := decodeString(args[i])
+			switch field {
+			case "room":
+				msg.Room = value
+			case "sender":
+				msg.Sender = value
+			case "content":
+				msg.Content = value
+			}
+		}
+	}
+
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+	return msg, nil
+}
+
+// decodeProbeID returns the probe ID echoed back in a pong or heartbeat,
+// or "" if none of the arguments carries one
+func decodeProbeID(args []json.RawMessage) string {
+	for _, arg := range args {
+		if !isObject(arg) {
+			continue
+		}
+		var echo struct {
+			ProbeID string `json:"probe_id"`
+		}
+		if json.Unmarshal(arg, &echo) == nil && echo.ProbeID != "" {
+			return echo.ProbeID
+		}
+	}
+	return ""
+}
+
+// decodeUser builds a User from an object or a plain username
+func decodeUser(raw json.RawMessage) (User, error) {
+	var user User
+	if isObject(raw) {
+		if err := json.Unmarshal(raw, &user); err != nil {
+			return user, fmt.Errorf("invalid user payload: %w", err)
+		}
+		return user, nil
+	}
+	user.Username = decodeString(raw)
+	if user.Username == "" {
+		return user, fmt.Errorf("empty user payload")
+	}
+	return user, nil
+}
+
+// decodeUsers builds a user list from an array of objects or usernames
+func decodeUsers(raw json.RawMessage) ([]User, error) {
+	var items []json.RawMessage
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return nil, fmt.Errorf("invalid user list payload: %w", err)
+	}
+	users := make([]User, 0, len(items))
+	for _, item := range items {
+		user, err := decodeUser(item)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+// decodeRoom builds a Room from an object or a plain room ID
+func decodeRoom(raw json.RawMessage) (Room, error) {
+	var room Room
+	if isObject(raw) {
+		var wire struct {
+			Room
+			CreatedAt json.RawMessage `json:"created_at"`
+		}
+		if err := json.Unmarshal(raw, &wire); err != nil {
+			return room, fmt.Errorf("invalid room payload: %w", err)
+		}
+		room = wire.Room
+		room.CreatedAt = decodeTimestamp(wire.CreatedAt)
+		return room, nil
+	}
+	room.ID = decodeString(raw)
+	if room.ID == "" {
+		return room, fmt.Errorf("empty room payload")
+	}
+	return room, nil
+}
+
+// decodeRooms builds a room list from an array of objects or room IDs
+func decodeRooms(raw json.RawMessage) ([]Room, error) {
+	var items []json.RawMessage
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return nil, fmt.Errorf("invalid room list payload: %w", err)
+	}
+	rooms := make([]Room, 0, len(items))
+	for _, item := range items {
+		room, err := decodeRoom(item)
+		if err != nil {
+			return nil, err
+		}
+		rooms = append(rooms, room)
+	}
+	return rooms, nil
+}
+
+// decodeRoomList decodes the arguments of a room list. The list may be
+// preceded by the room type it was requested for, which is given to the
+// rooms that do not state their own.
+func decodeRoomList(args []json.RawMessage) ([]Room, bool) {
+	roomType := ""
+	for _, arg := range args {
+		rooms, err := decodeRooms(arg)
+		if err != nil {
+			if t := strings.TrimSuffix(decodeString(arg), "s"); t == TypeGroup || t == TypeGuild {
+				roomType = t
+			}
+			continue
+		}
+		for i := range rooms {
+			if rooms[i].Type == "" {
+				rooms[i].Type = roomType
+			}
+		}
+		return rooms, true
+	}
+	return nil, false
+}
@@ -0,0 +1,146 @@
+package events
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func rawArgs(values ...string) []json.RawMessage {
+	args := make([]json.RawMessage, len(values))
+	for i, v := range values {
+		args[i] = json.RawMessage(v)
+	}
+	return args
+}
+
+func TestDecodeMessage(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []json.RawMessage
+		msgType  string
+		fields   []string
+		expected Message
+	}{
+		{
+			name:     "plain string",
+			args:     rawArgs(`"hello"`),
+			msgType:  TypeSystem,
+			fields:   []string{"content"},
+			expected: Message{Type: TypeSystem, Content: "hello"},
+		},
+		{
+			name:     "positional sender and content",
+			args:     rawArgs(`"alice"`, `"hi bob"`),
+			msgType:  TypePrivate,
+			fields:   []string{"sender", "content"},
+			expected: Message{Type: TypePrivate, Sender: "alice", Content: "hi bob"},
+		},
+		{
+			name:     "content only for a sender/content event",
+			args:     rawArgs(`"alice: hi"`),
+			msgType:  TypeGlobal,
+			fields:   []string{"sender", "content"},
+			expected: Message{Type: TypeGlobal, Content: "alice: hi"},
+		},
+		{
+			name:     "object payload",
+			args:     rawArgs(`{"id":"m1","room":"group-1","sender":"bob","content":"yo","timestamp":1700000000000}`),
+			msgType:  TypeGroup,
+			fields:   []string{"room", "sender", "content"},
+			expected: Message{ID: "m1", Type: TypeGroup, Room: "group-1", Sender: "bob", Content: "yo", Timestamp: time.UnixMilli(1700000000000)},
+		},
+		{
+			name:     "object payload with the sender's ID",
+			args:     rawArgs(`{"sender":"bob","sender_id":"u-2","content":"yo","timestamp":1700000000000}`),
+			msgType:  TypeGlobal,
+			fields:   []string{"sender", "content"},
+			expected: Message{Type: TypeGlobal, Sender: "bob", SenderID: "u-2", Content: "yo", Timestamp: time.UnixMilli(1700000000000)},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			msg, err := decodeMessage(test.args, test.msgType, test.fields...)
+			if err != nil {
+				t.Fatalf("decodeMessage returned %v", err)
+			}
+			if test.expected.Timestamp.IsZero() {
+				if msg.Timestamp.IsZero() {
+					t.Error("Expected a missing timestamp to default to now")
+				}
+				msg.Timestamp = time.Time{}
+			}
+			if !msg.Timestamp.Equal(test.expected.Timestamp) {
+				t.Errorf("Timestamp = %v; expected %v", msg.Timestamp, test.expected.Timestamp)
+			}
+			msg.Timestamp, test.expected.Timestamp = time.Time{}, time.Time{}
+			if msg != test.expected {
+				t.Errorf("decodeMessage = %+v; expected %+v", msg, test.expected)
+			}
+		})
+	}
+}
+
+func TestDecodeUsersAndRooms(t *testing.T) {
+	users, err := decodeUsers(json.RawMessage(`["alice", {"id":"u2","username":"bob"}]`))
+	if err != nil || len(users) != 2 {
+		t.Fatalf("decodeUsers = %v, %v", users, err)
+	}
+	if users[0].Username != "alice" || users[1].ID != "u2" || users[1].Username != "bob" {
+		t.Errorf("Unexpected users: %+v", users)
+	}
+
+	rooms, err := decodeRooms(json.RawMessage(`[{"id":"g1","name":"Guild","type":"guild","created_at":"2024-01-02T03:04:05Z"}, "group-1"]`))
+	if err != nil || len(rooms) != 2 {
+		t.Fatalf("decodeRooms = %v, %v", rooms, err)
+	}
+	if rooms[0].Type != "guild" || rooms[0].CreatedAt.Year() != 2024 || rooms[1].ID != "group-1" {
+		t.Errorf("Unexpected rooms: %+v", rooms)
+	}
+
+	if _, err := decodeRoom(json.RawMessage(`""`)); err == nil {
+		t.Error("Expected an empty room ID to be rejected")
+	}
+}
+
+func TestDecodeRoomList(t *testing.T) {
+	// The requested type fills in rooms that do not state their own
+	args := []json.RawMessage{json.RawMessage(`"guilds"`), json.RawMessage(`["g1", {"id":"x","type":"group"}]`)}
+	rooms, ok := decodeRoomList(args)
+	if !ok || len(rooms) != 2 {
+		t.Fatalf("decodeRoomList = %v, %v", rooms, ok)
+	}
+	if rooms[0].Type != TypeGuild || rooms[1].Type != TypeGroup {
+		t.Errorf("Unexpected room types: %+v", rooms)
+	}
+
+	rooms, ok = decodeRoomList([]json.RawMessage{json.RawMessage(`["r1"]`)})
+	if !ok || len(rooms) != 1 || rooms[0].Type != "" {
+		t.Errorf("decodeRoomList without a type = %+v, %v; expected an untyped room", rooms, ok)
+	}
+	if _, ok := decodeRoomList([]json.RawMessage{json.RawMessage(`"group"`)}); ok {
+		t.Error("Expected arguments without a list to be rejected")
+	}
+}
+
+func TestRouterPublish(t *testing.T) {
+	router := NewRouter(nil)
+	var received []string
+	router.Subscribe(func(e Event) { received = append(received, e.Name) })
+	router.Subscribe(func(e Event) { received = append(received, "second:"+e.Name) })
+
+	router.publish(Event{Name: "chat message"})
+	if len(received) != 2 || received[0] != "chat message" || received[1] != "second:chat message" {
+		t.Errorf("Unexpected deliveries: %v", received)
+	}
+}
+
+func TestDecodeProbeID(t *testing.T) {
+	if id := decodeProbeID(rawArgs(`"pong"`, `{"probe_id":"p-1","sent_at":1700000000000}`)); id != "p-1" {
+		t.Errorf("Expected the echoed probe ID, got %q", id)
+	}
+	if id := decodeProbeID(rawArgs(`"pong"`, `{"other":1}`)); id != "" {
+		t.Errorf("Expected no probe ID, got %q", id)
+	}
+}
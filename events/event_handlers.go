@@ -1,7 +1,10 @@
 package events
 
 import (
+	"encoding/json"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/jonipwi/go-chat-client/state"
@@ -14,108 +17,373 @@ import (
 type Message struct {
 	ID        string    `json:"id"`
 	Type      string    `json:"type"`
+	Room      string    `json:"room"`
 	Sender    string    `json:"sender"`
+	SenderID  string    `json:"sender_id"` // The sender's user ID, if the server authenticates senders
 	Content   string    `json:"content"`
 	Timestamp time.Time `json:"timestamp"`
 }
 
-// User structure for user information
-type User struct {
-	ID       string `json:"id"`
-	Username string `json:"username"`
-	Avatar   string `json:"avatar"`
+// User structure for user information, shared with the client state's presence roster
+type User = state.User
+
+// Room structure for room information, shared with the client state's room registry
+type Room = state.Room
+
+// Message types
+const (
+	TypeGlobal  = "global"
+	TypeGroup   = "group"
+	TypeGuild   = "guild"
+	TypePrivate = "private"
+	TypeSystem  = "system"
+)
+
+// Event is an incoming Socket.IO event decoded into the client's types.
+// Only the fields relevant to the event are set.
+type Event struct {
+	Name    string
+	Message *Message
+	User    *User
+	Users   []User
+	Room    *Room
+	Rooms   []Room
+	Args    []json.RawMessage
 }
 
-// Room structure for room information
-type Room struct {
-	ID        string    `json:"id"`
-	Name      string    `json:"name"`
-	Type      string    `json:"type"`
-	CreatedAt time.Time `json:"created_at"`
-	Members   []string  `json:"members"`
+// logger logs events received from the server
+var logger = utils.Log(utils.ComponentEvents)
+
+// maxEventArgs is the most positional arguments a handler accepts. The
+// socket.io client panics if an event carries more arguments than its handler.
+const maxEventArgs = 4
+
+// Router decodes incoming Socket.IO events, applies them to the client state
+// and passes them on to subscribers. One router is shared by every connection
+// the client makes, so subscriptions survive reconnects.
+type Router struct {
+	clientState *state.ClientState
+	mu          sync.RWMutex
+	subscribers []func(Event)
+	client      *socketio_client.Client // The client whose events are handled
 }
 
-// SetupEventHandlers configures event listeners for the Socket.IO client
-func SetupEventHandlers(client *socketio_client.Client, clientState *state.ClientState) {
-	client.On("error", func(args ...interface{}) {
-		errMsg := "Unknown error"
+// NewRouter creates an event router for the given client state
+func NewRouter(clientState *state.ClientState) *Router {
+	return &Router{clientState: clientState}
+}
+
+// Subscribe registers fn to be called with every decoded event
+func (r *Router) Subscribe(fn func(Event)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.subscribers = append(r.subscribers, fn)
+}
+
+// publish passes an event on to all subscribers
+func (r *Router) publish(event Event) {
+	r.mu.RLock()
+	subscribers := append([]func(Event){}, r.subscribers...)
+	r.mu.RUnlock()
+
+	for _, fn := range subscribers {
+		fn(event)
+	}
+}
+
+// Attach registers the router's handlers on client. From then on only the
+// events of client are handled, those of an earlier client are ignored.
+func (r *Router) Attach(client *socketio_client.Client) {
+	cs := r.clientState
+	r.mu.Lock()
+	r.client = client
+	r.mu.Unlock()
+
+	// "disconnection" is what the socket.io client raises itself when the transport closes
+	onDisconnect := func(args []json.RawMessage) Event {
+		if cs.Client() != client {
+			// Stale client that was replaced or closed on purpose
+			return Event{}
+		}
+		logger.Info("Disconnected from server")
+		// Room memberships are kept so they can be rejoined after a reconnect,
+		// while the roster is refilled by the server once connected again
+		cs.SetConnected(false)
+		cs.Presence().Clear()
+		cs.Typing().Clear()
+		cs.RequestReconnect("disconnected from server")
+		return Event{Name: "disconnect"}
+	}
+	r.on(client, "disconnect", onDisconnect)
+	r.on(client, "disconnection", onDisconnect)
+
+	r.on(client, "connect", func(args []json.RawMessage) Event {
+		logger.Info("Connected to server")
+		cs.SetConnected(true)
 		if len(args) > 0 {
-			if err, ok := args[0].(error); ok {
-				errMsg = err.Error()
-			} else if str, ok := args[0].(string); ok {
-				errMsg = str
+			if id := decodeString(args[0]); id != "" {
+				cs.SetClientID(id)
+				logger.Info("Received client ID", "client_id", id)
 			}
 		}
-		utils.Logger.Printf("ERROR: Socket.IO error: %s", errMsg)
-		clientState.AddConnectionError(fmt.Sprintf("Socket.IO error: %s", errMsg))
+		return Event{Name: "connect"}
 	})
 
-	client.On("connect", func(args ...interface{}) {
-		utils.Logger.Println("EVENT: Connected to server")
-		clientState.SetConnected(true)
-		if len(args) > 0 {
-			if id, ok := args[0].(string); ok {
-				clientState.SetClientID(id)
-				utils.Logger.Printf("EVENT: Received client ID: %s", id)
+	r.on(client, "error", func(args []json.RawMessage) Event {
+		// An error carrying a request ID answers a request rather than reporting a connection problem
+		if len(args) > 0 && isObject(args[0]) {
+			if id, result := state.ParseRequestError(args[0]); id != "" {
+				logger.Info("Request rejected", "request_id", id, "reason", result.Error)
+				cs.Requests().Resolve(id, result)
+				return Event{Name: "error"}
 			}
 		}
-	})
 
-	client.On("disconnect", func() {
-		utils.Logger.Println("EVENT: Disconnected from server")
-		clientState.SetConnected(false)
-		clientState.SetCurrentRoom("")
+		errMsg := "Unknown error"
+		if len(args) > 0 {
+			errMsg = decodeString(args[0])
+		}
+		logger.Error("Socket.IO error", "error", errMsg)
+		if isAuthError(errMsg) {
+			cs.AddAuthError(fmt.Sprintf("Socket.IO error: %s", errMsg))
+		} else {
+			cs.AddConnectionError(fmt.Sprintf("Socket.IO error: %s", errMsg))
+		}
+		return Event{Name: "error"}
 	})
 
-	client.On("message", func(msg string) {
-		utils.Logger.Printf("EVENT: Received message: %s", msg)
-		clientState.TrackMessageReceived()
-	})
+	r.onMessage(client, "chat message", TypeGlobal, "sender", "content")
+	r.onMessage(client, "message", TypeSystem, "content")
+	r.onMessage(client, "private message", TypePrivate, "sender", "content")
+	r.onMessage(client, "group message", TypeGroup, "room", "sender", "content")
+	r.onMessage(client, "guild message", TypeGuild, "room", "sender", "content")
+
+	r.onUser(client, "user joined")
+	r.onUser(client, "user left")
+	r.onUser(client, state.EventTyping)
+	r.onUser(client, state.EventStopTyping)
 
-	client.On("chat message", func(msg string) {
-		utils.Logger.Printf("EVENT: Received chat message: %s", msg)
-		clientState.TrackMessageReceived()
+	r.on(client, "user list", func(args []json.RawMessage) Event {
+		if len(args) == 0 {
+			return Event{}
+		}
+		users, err := decodeUsers(args[len(args)-1])
+		if err != nil {
+			logger.Warn("Invalid event payload", "error", err)
+			return Event{}
+		}
+		event := Event{Name: "user list", Users: users}
+		roomID := ""
+		if len(args) > 1 {
+			// A room before the list scopes it to that room
+			if room, err := decodeRoom(args[0]); err == nil {
+				event.Room = &room
+				roomID = room.ID
+			}
+		}
+		logger.Debug("Received user list", "room", roomID, "users", len(users))
+		cs.Presence().SetOnline(roomID, users)
+		return event
 	})
 
-	client.On("user joined", func(username string) {
-		utils.Logger.Printf("EVENT: User joined: %s", username)
+	r.on(client, "room joined", func(args []json.RawMessage) Event {
+		room, ok := r.decodeRoomArg(args)
+		if !ok {
+			return Event{}
+		}
+		logger.Info("Joined room", "room", room.ID, "type", room.Type)
+		cs.Rooms().Update(room)
+		cs.AddJoinedRoom(room.ID)
+		cs.SetCurrentRoom(room.ID)
+		return Event{Name: "room joined", Room: &room}
 	})
 
-	client.On("user left", func(username string) {
-		utils.Logger.Printf("EVENT: User left: %s", username)
+	r.on(client, "room left", func(args []json.RawMessage) Event {
+		room, ok := r.decodeRoomArg(args)
+		if !ok {
+			return Event{}
+		}
+		logger.Info("Left room", "room", room.ID)
+		cs.RemoveJoinedRoom(room.ID)
+		return Event{Name: "room left", Room: &room}
 	})
 
-	client.On("typing", func(username string) {
-		utils.Logger.Printf("EVENT: User %s is typing...", username)
+	r.on(client, "room list", func(args []json.RawMessage) Event {
+		rooms, ok := decodeRoomList(args)
+		if !ok {
+			logger.Warn("Invalid room list payload")
+			return Event{}
+		}
+		logger.Debug("Received room list", "rooms", len(rooms))
+		for _, room := range rooms {
+			cs.Rooms().Update(room)
+		}
+		return Event{Name: "room list", Rooms: rooms}
 	})
 
-	client.On("stop typing", func(username string) {
-		utils.Logger.Printf("EVENT: User %s stopped typing", username)
+	r.on(client, "ack", func(args []json.RawMessage) Event {
+		if len(args) == 0 {
+			return Event{}
+		}
+		id, result := state.ParseAck(args[:1])
+		if id == "" {
+			logger.Warn("Acknowledgement without a request ID")
+			return Event{}
+		}
+		logger.Debug("Request answered", "request_id", id, "status", result.Status)
+		cs.Requests().Resolve(id, result)
+		return Event{Name: "ack"}
 	})
 
-	client.On("user list", func(users []string) {
-		utils.Logger.Printf("EVENT: Current users: %v", users)
+	r.on(client, "heartbeat", func(args []json.RawMessage) Event {
+		logger.Debug("Received server heartbeat")
+		cs.TrackHeartbeatReceived()
+		if rtt, ok := cs.Latency().Complete(state.ProbeHeartbeat, decodeProbeID(args), time.Now()); ok {
+			logger.Debug("Heartbeat round trip", "rtt", rtt)
+		}
+		return Event{Name: "heartbeat"}
 	})
 
-	client.On("private message", func(from string, msg string) {
-		utils.Logger.Printf("EVENT: Private message from %s: %s", from, msg)
-		clientState.TrackMessageReceived()
+	r.on(client, "pong", func(args []json.RawMessage) Event {
+		rtt, ok := cs.Latency().Complete(state.ProbePing, decodeProbeID(args), time.Now())
+		if !ok {
+			logger.Debug("Received pong without a matching ping")
+			return Event{Name: "pong"}
+		}
+		logger.Debug("Received pong", "rtt", rtt)
+		return Event{Name: "pong"}
 	})
+}
+
+// isAuthError reports whether an error sent by the server refers to failed authentication,
+// as sent by Socket.IO auth middleware ("Authentication error", "invalid token", ...)
+func isAuthError(msg string) bool {
+	msg = strings.ToLower(msg)
+	for _, word := range []string{"auth", "token", "forbidden", "credential"} {
+		if strings.Contains(msg, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// Detach stops handling the events of client if it is the attached one.
+// The socket.io client cannot unregister handlers; they stay registered
+// but ignore its events.
+func (r *Router) Detach(client *socketio_client.Client) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.client == client {
+		r.client = nil
+	}
+}
+
+// attached reports whether the events of client are handled
+func (r *Router) attached(client *socketio_client.Client) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.client == client
+}
+
+// on registers handle for an event and publishes what it returns.
+// Handlers return an Event with an empty Name to publish nothing.
+func (r *Router) on(client *socketio_client.Client, name string, handle func(args []json.RawMessage) Event) {
+	client.On(name, func(a1, a2, a3, a4 json.RawMessage) {
+		if !r.attached(client) {
+			return
+		}
+		args := make([]json.RawMessage, 0, maxEventArgs)
+		for _, arg := range []json.RawMessage{a1, a2, a3, a4} {
+			if len(arg) > 0 {
+				args = append(args, arg)
+			}
+		}
 
-	client.On("room joined", func(room string) {
-		utils.Logger.Printf("EVENT: Joined room: %s", room)
-		clientState.SetCurrentRoom(room)
+		event := handle(args)
+		if event.Name == "" {
+			return
+		}
+		event.Args = args
+		r.publish(event)
 	})
+}
 
-	client.On("room left", func(room string) {
-		utils.Logger.Printf("EVENT: Left room: %s", room)
-		if clientState.GetCurrentRoom() == room {
-			clientState.SetCurrentRoom("")
+// onMessage registers a chat message event, see decodeMessage for fields
+func (r *Router) onMessage(client *socketio_client.Client, name string, msgType string, fields ...string) {
+	r.on(client, name, func(args []json.RawMessage) Event {
+		msg, err := decodeMessage(args, msgType, fields...)
+		if err != nil {
+			logger.Warn("Invalid event payload", "error", err)
+			return Event{}
 		}
+		logger.Debug("Received message", "type", msg.Type, "room", msg.Room, "sender", msg.Sender, "content", msg.Content)
+		r.clientState.TrackMessageReceived()
+		if msg.Room != "" && (msgType == TypeGroup || msgType == TypeGuild) {
+			// A message in a room tells us its type
+			r.clientState.Rooms().Update(Room{ID: msg.Room, Type: msgType})
+		}
+		switch msgType {
+		case TypeGlobal, TypeGroup, TypeGuild:
+			// Whoever sent the message has stopped typing it
+			r.clientState.Typing().SetTyping(msg.Room, msg.Sender, false)
+			r.clientState.TrackUnread(msg.Room, msg.Sender, msg.Content)
+		case TypePrivate:
+			r.clientState.TrackUnread(state.PrivatePrefix+msg.Sender, msg.Sender, msg.Content)
+		}
+		return Event{Name: name, Message: &msg}
 	})
+}
 
-	client.On("heartbeat", func(args ...interface{}) {
-		utils.Logger.Println("EVENT: Received server heartbeat")
-		clientState.TrackHeartbeatReceived()
+// onUser registers an event whose payload is a user, optionally followed by a room
+func (r *Router) onUser(client *socketio_client.Client, name string) {
+	r.on(client, name, func(args []json.RawMessage) Event {
+		if len(args) == 0 {
+			return Event{}
+		}
+		user, err := decodeUser(args[0])
+		if err != nil {
+			logger.Warn("Invalid user payload", "event", name, "error", err)
+			return Event{}
+		}
+		event := Event{Name: name, User: &user}
+		roomID := ""
+		if len(args) > 1 {
+			if room, err := decodeRoom(args[1]); err == nil {
+				event.Room = &room
+				roomID = room.ID
+			}
+		}
+		logger.Debug("User event", "event", name, "user", user.Name(), "room", roomID)
+		switch name {
+		case "user joined":
+			r.clientState.Presence().Join(roomID, user)
+		case "user left":
+			r.clientState.Presence().Leave(roomID, user)
+			if roomID == "" {
+				r.clientState.Typing().Forget(user.Name())
+			} else {
+				r.clientState.Typing().SetTyping(roomID, user.Name(), false)
+			}
+		case state.EventTyping, state.EventStopTyping:
+			if user.Name() == r.clientState.GetUsername() {
+				// Our own indicator echoed back
+				return Event{}
+			}
+			r.clientState.Typing().SetTyping(roomID, user.Name(), name == state.EventTyping)
+		}
+		return event
 	})
 }
+
+// decodeRoomArg decodes the first argument of a room event
+func (r *Router) decodeRoomArg(args []json.RawMessage) (Room, bool) {
+	if len(args) == 0 {
+		return Room{}, false
+	}
+	room, err := decodeRoom(args[0])
+	if err != nil {
+		logger.Warn("Invalid event payload", "error", err)
+		return Room{}, false
+	}
+	return room, true
+}
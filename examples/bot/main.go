@@ -0,0 +1,70 @@
+// Command bot is an example bot built on package bot. Run it with the same
+// flags as the client, e.g. go run ./examples/bot -username helper -bot-admins u-123
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jonipwi/go-chat-client/bot"
+	"github.com/jonipwi/go-chat-client/commands"
+)
+
+func main() {
+	bot.Main(func(b *bot.Bot) {
+		b.MustRegister(&bot.Command{
+			Name:        "roll",
+			Usage:       "[sides]",
+			Description: "Roll a die, six-sided unless told otherwise",
+			Args:        commands.ArgSpec{Min: 0, Max: 1},
+			Handler:     roll,
+		})
+		b.MustRegister(&bot.Command{
+			Name:        "echo",
+			Usage:       "<text>",
+			Description: "Repeat the text",
+			Args:        commands.ArgSpec{Min: 1, Max: -1},
+			Handler: func(ctx *bot.Context) {
+				ctx.Reply(strings.Join(ctx.Args, " "))
+			},
+		})
+		b.MustRegister(&bot.Command{
+			Name:        "say",
+			Usage:       "<room_id|global> <text>",
+			Description: "Make the bot talk in a room",
+			Args:        commands.ArgSpec{Min: 2, Max: -1},
+			Admin:       true,
+			Handler: func(ctx *bot.Context) {
+				if _, err := ctx.Bot().Client().SendToRoom(ctx.Args[0], strings.Join(ctx.Args[1:], " ")); err != nil {
+					ctx.Replyf("❌ %v", err)
+				}
+			},
+		})
+
+		b.Handle(bot.Trigger{Pattern: regexp.MustCompile(`(?i)^(hello|hi)\b`), Rooms: []string{"global"}}, func(ctx *bot.Context) {
+			ctx.Replyf("Hello %s!", ctx.Message.Sender)
+		})
+		b.Handle(bot.Trigger{Mention: true}, func(ctx *bot.Context) {
+			ctx.ReplyPrivate("Type !help to see what I can do")
+		})
+	})
+}
+
+// roll answers with a random number between 1 and the number of sides
+func roll(ctx *bot.Context) {
+	sides := 6
+	if len(ctx.Args) == 1 {
+		n, err := strconv.Atoi(ctx.Args[0])
+		if err != nil || n < 2 {
+			ctx.Reply("A die needs at least 2 sides")
+			return
+		}
+		sides = n
+	}
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	ctx.Reply(fmt.Sprintf("🎲 %s rolled %d", ctx.Message.Sender, rng.Intn(sides)+1))
+}
@@ -3,21 +3,44 @@ module github.com/jonipwi/go-chat-client
 go 1.21
 
 require (
+	github.com/BurntSushi/toml v1.3.2
+	github.com/gdamore/tcell/v2 v2.8.1
+	github.com/gorilla/websocket v1.5.3
+	github.com/jonipwi/go-chat-client/commands v0.0.0
+	github.com/jonipwi/go-chat-client/events v0.0.0
+	github.com/jonipwi/go-chat-client/history v0.0.0
 	github.com/jonipwi/go-chat-client/state v0.0.0
+	github.com/jonipwi/go-chat-client/utils v0.0.0
+	github.com/prometheus/client_golang v1.19.1
+	github.com/rivo/tview v0.42.0
 	github.com/zhouhui8915/go-socket.io-client v0.0.0-20200925034401-83ee73793ba4
+	golang.org/x/term v0.28.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
-	github.com/gopherjs/gopherjs v1.17.2 // indirect
-	github.com/gorilla/websocket v1.5.3 // indirect
-	github.com/jtolds/gls v4.20.0+incompatible // indirect
-	github.com/smarty/assertions v1.16.0 // indirect
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/gdamore/encoding v1.0.1 // indirect
+	github.com/lucasb-eyer/go-colorful v1.2.0 // indirect
+	github.com/mattn/go-runewidth v0.0.16 // indirect
+	github.com/prometheus/client_model v0.5.0 // indirect
+	github.com/prometheus/common v0.48.0 // indirect
+	github.com/prometheus/procfs v0.12.0 // indirect
+	github.com/rivo/uniseg v0.4.7 // indirect
 	github.com/zhouhui8915/engine.io-go v0.0.0-20150910083302-02ea08f0971f // indirect
+	go.etcd.io/bbolt v1.3.10 // indirect
+	golang.org/x/sys v0.29.0 // indirect
+	golang.org/x/text v0.21.0 // indirect
+	google.golang.org/protobuf v1.33.0 // indirect
 )
 
 replace (
 	github.com/jonipwi/go-chat-client/commands => ./commands
 	github.com/jonipwi/go-chat-client/events => ./events
+	github.com/jonipwi/go-chat-client/history => ./history
 	github.com/jonipwi/go-chat-client/state => ./state
 	github.com/jonipwi/go-chat-client/utils => ./utils
+	github.com/zhouhui8915/engine.io-go => ./third_party/engine.io-go
+	github.com/zhouhui8915/go-socket.io-client => ./third_party/go-socket.io-client
 )
@@ -6,7 +6,7 @@ go test
 cd ../state
 go clean -modcache
 go mod tidy
-go test
+go test -race
 
 cd ../commands
 go clean -modcache
@@ -0,0 +1,346 @@
+// history.go
+package history
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jonipwi/go-chat-client/events"
+	"github.com/jonipwi/go-chat-client/state"
+	"github.com/jonipwi/go-chat-client/utils"
+	bolt "go.etcd.io/bbolt"
+)
+
+// GlobalRoom is the room global chat and system messages are stored under
+const GlobalRoom = "global"
+
+// PrivatePrefix marks the room of a private conversation, e.g. "@alice"
+const PrivatePrefix = "@"
+
+// openTimeout is how long Open waits for another client to release the file
+const openTimeout = time.Second
+
+// echoWindow is how long a recorded sent message waits for the server to send it back
+const echoWindow = time.Minute
+
+// roomsBucket holds one nested bucket of messages per room
+var roomsBucket = []byte("rooms")
+
+// Store keeps every message sent and received in a local file, keyed by
+// room and timestamp. It is safe for concurrent use.
+type Store struct {
+	db *bolt.DB
+
+	mu      sync.Mutex
+	pending []sentMessage // Messages RecordSent recorded that the server has not sent back yet
+}
+
+// sentMessage is a message the client sent, waiting for its echo
+type sentMessage struct {
+	echo   echo
+	sentAt time.Time
+}
+
+// echo identifies the copy of a sent message the server sends back. The
+// chat events the client sends carry no message ID, so it goes by content.
+type echo struct {
+	msgType string
+	room    string // Only set for group and guild messages
+	sender  string
+	content string
+}
+
+// echoOf returns what identifies msg as the echo of a sent message
+func echoOf(msg events.Message) echo {
+	e := echo{msgType: msg.Type, sender: msg.Sender, content: msg.Content}
+	if msg.Type == events.TypeGroup || msg.Type == events.TypeGuild {
+		e.room = msg.Room
+	}
+	return e
+}
+
+// Query selects messages for Search. Zero fields match everything.
+type Query struct {
+	Text   string    // Case-insensitive substring of the content
+	Room   string    // Room as returned by RoomOf
+	Sender string    // Case-insensitive sender name
+	Before time.Time // Only messages strictly before this time
+	After  time.Time // Only messages strictly after this time
+	Limit  int       // Most recent matches to return, 0 means all
+}
+
+// Open opens or creates the history file at path. It fails if another
+// client holds the file open.
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("opening history %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(roomsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("initializing history %s: %w", path, err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the history file
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// RoomOf returns the room a message is stored under: the room ID for group
+// and guild messages, "@peer" for private messages and "global" otherwise.
+// For private messages the peer is msg.Room when set, which is how sent
+// private messages record their recipient, and the sender otherwise. Both
+// sides of a conversation are stored under the peer's username when it is
+// known, see RecordSent.
+func RoomOf(msg events.Message) string {
+	switch msg.Type {
+	case events.TypeGroup, events.TypeGuild:
+		if msg.Room != "" {
+			return msg.Room
+		}
+	case events.TypePrivate:
+		if msg.Room != "" {
+			return PrivatePrefix + msg.Room
+		}
+		if msg.Sender != "" {
+			return PrivatePrefix + msg.Sender
+		}
+	}
+	return GlobalRoom
+}
+
+// Add records a message. Messages without a timestamp are stored as received now.
+func (s *Store) Add(msg events.Message) error {
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+	value, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		room, err := tx.Bucket(roomsBucket).CreateBucketIfNotExists([]byte(RoomOf(msg)))
+		if err != nil {
+			return err
+		}
+		// The sequence number keeps messages with the same timestamp apart
+		seq, err := room.NextSequence()
+		if err != nil {
+			return err
+		}
+		return room.Put(messageKey(msg.Timestamp, seq), value)
+	})
+}
+
+// logger logs messages that could not be recorded
+var logger = utils.Log(utils.ComponentHistory)
+
+// Subscribe records every chat message the router decodes. The copies of
+// the messages RecordSent recorded that the server sends back are skipped;
+// messages the user sent from other sessions are recorded.
+func (s *Store) Subscribe(router *events.Router) {
+	router.Subscribe(s.recordReceived)
+}
+
+// recordReceived records the message carried by an event
+func (s *Store) recordReceived(e events.Event) {
+	if e.Message == nil || s.takeEcho(*e.Message) {
+		return
+	}
+	if err := s.Add(*e.Message); err != nil {
+		logger.Error("Failed to record message", "error", err)
+	}
+}
+
+// expectEcho remembers a recorded sent message until the server sends it back
+func (s *Store) expectEcho(msg events.Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropExpired(time.Now())
+	s.pending = append(s.pending, sentMessage{echo: echoOf(msg), sentAt: time.Now()})
+}
+
+// takeEcho reports whether msg is the copy of a recorded sent message, and
+// forgets that message if it is
+func (s *Store) takeEcho(msg events.Message) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropExpired(time.Now())
+	e := echoOf(msg)
+	for i, sent := range s.pending {
+		if sent.echo == e {
+			s.pending = append(s.pending[:i], s.pending[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// dropExpired forgets the sent messages whose echo did not arrive in time
+func (s *Store) dropExpired(now time.Time) {
+	kept := s.pending[:0]
+	for _, sent := range s.pending {
+		if now.Sub(sent.sentAt) < echoWindow {
+			kept = append(kept, sent)
+		}
+	}
+	s.pending = kept
+}
+
+// RecordSent records every chat message the client delivers to the server,
+// including queued messages when the outbox is flushed. Private messages
+// may be addressed by user ID; they are stored under the recipient's
+// username when the presence roster knows it, like the ones received from
+// them.
+func (s *Store) RecordSent(clientState *state.ClientState) {
+	clientState.OnSent(func(event string, args []interface{}) {
+		s.recordSent(clientState, event, args)
+	})
+}
+
+// recordSent records the message carried by an event the client sent
+func (s *Store) recordSent(clientState *state.ClientState, event string, args []interface{}) {
+	msg, ok := SentMessage(event, args, clientState.GetUsername())
+	if !ok {
+		return
+	}
+	if msg.Type == events.TypePrivate {
+		if user, ok := clientState.Presence().Lookup(msg.Room); ok {
+			msg.Room = user.Name()
+		}
+	}
+	if err := s.Add(msg); err != nil {
+		logger.Error("Failed to record sent message", "error", err)
+	}
+	s.expectEcho(msg)
+}
+
+// SentMessage converts an emitted chat event into the message it sends.
+// It reports false for events that are not chat messages.
+func SentMessage(event string, args []interface{}, sender string) (events.Message, bool) {
+	msg := events.Message{Sender: sender, Timestamp: time.Now()}
+	switch {
+	case event == "global_message" && len(args) == 1:
+		msg.Type = events.TypeGlobal
+	case event == "group_message" && len(args) == 2:
+		msg.Type = events.TypeGroup
+	case event == "guild_message" && len(args) == 2:
+		msg.Type = events.TypeGuild
+	case event == "private_message" && len(args) == 2:
+		msg.Type = events.TypePrivate
+	default:
+		return msg, false
+	}
+	if len(args) == 2 {
+		msg.Room = fmt.Sprint(args[0])
+	}
+	msg.Content = fmt.Sprint(args[len(args)-1])
+	return msg, true
+}
+
+// Recent returns the last n messages of a room, oldest first
+func (s *Store) Recent(room string, n int) ([]events.Message, error) {
+	return s.Search(Query{Room: room, Limit: n})
+}
+
+// Rooms returns the rooms with recorded messages, sorted by name
+func (s *Store) Rooms() ([]string, error) {
+	var rooms []string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(roomsBucket).ForEach(func(name, _ []byte) error {
+			rooms = append(rooms, string(name))
+			return nil
+		})
+	})
+	return rooms, err
+}
+
+// Search returns the messages matching q, oldest first. With a limit only
+// the most recent matches are returned.
+func (s *Store) Search(q Query) ([]events.Message, error) {
+	text := strings.ToLower(q.Text)
+	var found []events.Message
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		rooms := tx.Bucket(roomsBucket)
+		return rooms.ForEach(func(name, _ []byte) error {
+			if q.Room != "" && string(name) != q.Room {
+				return nil
+			}
+
+			var matches []events.Message
+			c := rooms.Bucket(name).Cursor()
+			// Walk the room newest first so a limit can stop early
+			var k, v []byte
+			if q.Before.IsZero() {
+				k, v = c.Last()
+			} else {
+				k, v = seekBefore(c, q.Before)
+			}
+			for ; k != nil; k, v = c.Prev() {
+				if !q.After.IsZero() && !keyTime(k).After(q.After) {
+					break
+				}
+				var msg events.Message
+				if err := json.Unmarshal(v, &msg); err != nil {
+					return fmt.Errorf("corrupt history entry in %s: %w", name, err)
+				}
+				if q.Sender != "" && !strings.EqualFold(msg.Sender, q.Sender) {
+					continue
+				}
+				if text != "" && !strings.Contains(strings.ToLower(msg.Content), text) {
+					continue
+				}
+				matches = append(matches, msg)
+				if q.Limit > 0 && len(matches) == q.Limit {
+					break
+				}
+			}
+			found = append(found, matches...)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(found, func(i, j int) bool { return found[i].Timestamp.Before(found[j].Timestamp) })
+	if q.Limit > 0 && len(found) > q.Limit {
+		found = found[len(found)-q.Limit:]
+	}
+	return found, nil
+}
+
+// messageKey orders messages by time: nanoseconds since the epoch followed by a sequence number
+func messageKey(t time.Time, seq uint64) []byte {
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	binary.BigEndian.PutUint64(key[8:], seq)
+	return key
+}
+
+// keyTime returns the timestamp part of a message key
+func keyTime(key []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(key)))
+}
+
+// seekBefore positions the cursor on the last message strictly before t
+func seekBefore(c *bolt.Cursor, t time.Time) ([]byte, []byte) {
+	k, _ := c.Seek(messageKey(t, 0))
+	if k == nil {
+		return c.Last()
+	}
+	return c.Prev()
+}
@@ -0,0 +1,194 @@
+package history
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonipwi/go-chat-client/events"
+	"github.com/jonipwi/go-chat-client/state"
+)
+
+func openTestStore(t *testing.T) *Store {
+	t.Helper()
+	store, err := Open(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatalf("Open() returned %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestRoomOf(t *testing.T) {
+	tests := []struct {
+		msg  events.Message
+		want string
+	}{
+		{events.Message{Type: events.TypeGroup, Room: "room-1"}, "room-1"},
+		{events.Message{Type: events.TypeGuild, Room: "guild-1"}, "guild-1"},
+		{events.Message{Type: events.TypePrivate, Sender: "alice"}, "@alice"},
+		{events.Message{Type: events.TypePrivate, Room: "bob", Sender: "me"}, "@bob"},
+		{events.Message{Type: events.TypeGlobal, Sender: "alice"}, GlobalRoom},
+		{events.Message{Type: events.TypeSystem}, GlobalRoom},
+	}
+	for _, tt := range tests {
+		if got := RoomOf(tt.msg); got != tt.want {
+			t.Errorf("RoomOf(%+v) = %q; expected %q", tt.msg, got, tt.want)
+		}
+	}
+}
+
+func TestRecentAndSearch(t *testing.T) {
+	store := openTestStore(t)
+	start := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	for i, msg := range []events.Message{
+		{Type: events.TypeGroup, Room: "room-1", Sender: "alice", Content: "hello team"},
+		{Type: events.TypeGroup, Room: "room-1", Sender: "bob", Content: "Deploy is done"},
+		{Type: events.TypeGlobal, Sender: "alice", Content: "deploy starting"},
+		{Type: events.TypeGroup, Room: "room-1", Sender: "alice", Content: "thanks"},
+	} {
+		msg.Timestamp = start.Add(time.Duration(i) * time.Minute)
+		if err := store.Add(msg); err != nil {
+			t.Fatalf("Add() returned %v", err)
+		}
+	}
+
+	recent, err := store.Recent("room-1", 2)
+	if err != nil {
+		t.Fatalf("Recent() returned %v", err)
+	}
+	if len(recent) != 2 || recent[0].Content != "Deploy is done" || recent[1].Content != "thanks" {
+		t.Errorf("Expected the last two room-1 messages oldest first, got %+v", recent)
+	}
+
+	found, err := store.Search(Query{Text: "deploy"})
+	if err != nil {
+		t.Fatalf("Search() returned %v", err)
+	}
+	if len(found) != 2 || found[0].Sender != "bob" || found[1].Type != events.TypeGlobal {
+		t.Errorf("Expected case-insensitive matches across rooms, got %+v", found)
+	}
+
+	found, _ = store.Search(Query{Sender: "ALICE", Room: "room-1"})
+	if len(found) != 2 {
+		t.Errorf("Expected two room-1 messages from alice, got %+v", found)
+	}
+
+	found, _ = store.Search(Query{After: start, Before: start.Add(3 * time.Minute)})
+	if len(found) != 2 || found[0].Content != "Deploy is done" || found[1].Content != "deploy starting" {
+		t.Errorf("Expected the messages strictly between the bounds, got %+v", found)
+	}
+
+	rooms, _ := store.Rooms()
+	if len(rooms) != 2 || rooms[0] != GlobalRoom || rooms[1] != "room-1" {
+		t.Errorf("Rooms() = %v", rooms)
+	}
+}
+
+func TestHistoryPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	store, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() returned %v", err)
+	}
+	store.Add(events.Message{Type: events.TypePrivate, Sender: "alice", Content: "ping"})
+	store.Close()
+
+	store, err = Open(path)
+	if err != nil {
+		t.Fatalf("Reopening history returned %v", err)
+	}
+	defer store.Close()
+	recent, _ := store.Recent("@alice", 10)
+	if len(recent) != 1 || recent[0].Content != "ping" || recent[0].Timestamp.IsZero() {
+		t.Errorf("Expected the message to survive a reopen with a timestamp, got %+v", recent)
+	}
+}
+
+func TestOwnMessagesRecordedOnce(t *testing.T) {
+	store := openTestStore(t)
+	clientState := state.NewClientState("me")
+	mine := events.Event{Name: "chat message", Message: &events.Message{Type: events.TypeGlobal, Sender: "me", Content: "hi"}}
+	theirs := events.Event{Name: "chat message", Message: &events.Message{Type: events.TypeGlobal, Sender: "bob", Content: "hey"}}
+	otherSession := events.Event{Name: "chat message", Message: &events.Message{Type: events.TypeGlobal, Sender: "me", Content: "from my phone"}}
+
+	// Recorded when sent, so the copy the server sends back is skipped once
+	store.recordSent(clientState, "global_message", []interface{}{"hi"})
+	store.recordReceived(mine)
+	store.recordReceived(theirs)
+	// Messages from the user's other sessions were never sent by this client
+	store.recordReceived(otherSession)
+	store.recordReceived(mine)
+
+	recent, err := store.Recent(GlobalRoom, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, msg := range recent {
+		got = append(got, msg.Sender+": "+msg.Content)
+	}
+	want := []string{"me: hi", "bob: hey", "me: from my phone", "me: hi"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("Recorded %q; expected %q", got, want)
+	}
+}
+
+func TestPrivateConversationRecordedUnderPeer(t *testing.T) {
+	store := openTestStore(t)
+	clientState := state.NewClientState("me")
+	clientState.Presence().SetOnline("room-1", []state.User{{ID: "u-2", Username: "bob"}})
+
+	// Sent messages address bob by user ID, received ones name him
+	store.recordSent(clientState, "private_message", []interface{}{"u-2", "psst"})
+	store.recordReceived(events.Event{Name: "private message", Message: &events.Message{Type: events.TypePrivate, Sender: "bob", Content: "what?"}})
+	// Recipients the roster does not know keep the key they were addressed by
+	store.recordSent(clientState, "private_message", []interface{}{"u-9", "hello?"})
+
+	recent, err := store.Recent("@bob", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recent) != 2 || recent[0].Content != "psst" || recent[1].Content != "what?" {
+		t.Errorf("Expected both sides of the conversation under @bob, got %+v", recent)
+	}
+	if recent, _ := store.Recent("@u-9", 10); len(recent) != 1 {
+		t.Errorf("Expected the message to the unknown user under @u-9, got %+v", recent)
+	}
+}
+
+func TestSentMessage(t *testing.T) {
+	msg, ok := SentMessage("group_message", []interface{}{"room-1", "hi all"}, "me")
+	if !ok || msg.Type != events.TypeGroup || msg.Room != "room-1" || msg.Content != "hi all" || msg.Sender != "me" {
+		t.Errorf("Unexpected group message %+v", msg)
+	}
+	msg, ok = SentMessage("private_message", []interface{}{"bob", "psst"}, "me")
+	if !ok || RoomOf(msg) != "@bob" {
+		t.Errorf("Expected private message to be stored under @bob, got %+v", msg)
+	}
+	if _, ok := SentMessage("client_heartbeat", []interface{}{"beat"}, "me"); ok {
+		t.Error("Expected non-chat events to be ignored")
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	q, err := ParseQuery([]string{"deploy", "failed", "room:room-1", "from:bob", "after:2024-02-28", "before:2h"}, now)
+	if err != nil {
+		t.Fatalf("ParseQuery() returned %v", err)
+	}
+	if q.Text != "deploy failed" || q.Room != "room-1" || q.Sender != "bob" {
+		t.Errorf("Unexpected query %+v", q)
+	}
+	if !q.After.Equal(time.Date(2024, 2, 28, 0, 0, 0, 0, time.UTC)) || !q.Before.Equal(now.Add(-2*time.Hour)) {
+		t.Errorf("Unexpected time bounds after=%v before=%v", q.After, q.Before)
+	}
+
+	if _, err := ParseQuery([]string{"before:yesterday"}, now); err == nil {
+		t.Error("Expected an invalid time to be rejected")
+	}
+	if _, err := ParseQuery([]string{"room:"}, now); err != nil {
+		t.Errorf("Expected a bare prefix to be searched as text, got %v", err)
+	}
+}
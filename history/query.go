@@ -0,0 +1,73 @@
+// query.go
+package history
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultSearchLimit is how many matches /search shows when no limit is given
+const DefaultSearchLimit = 50
+
+// timeLayouts are the absolute times accepted by before: and after:
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// ParseQuery builds a query from /search arguments. Words of the form
+// room:<room>, from:<sender>, before:<time> and after:<time> are filters,
+// everything else is the text to look for. Times are either absolute, such
+// as 2024-03-01 or 2024-03-01T09:30, or a duration before now, such as 2h.
+func ParseQuery(args []string, now time.Time) (Query, error) {
+	q := Query{Limit: DefaultSearchLimit}
+	var words []string
+
+	for _, arg := range args {
+		key, value, found := strings.Cut(arg, ":")
+		if !found || value == "" {
+			words = append(words, arg)
+			continue
+		}
+		switch strings.ToLower(key) {
+		case "room":
+			q.Room = value
+		case "from":
+			q.Sender = value
+		case "before", "after":
+			t, err := parseTime(value, now)
+			if err != nil {
+				return q, fmt.Errorf("invalid %s time %q: %w", key, value, err)
+			}
+			if strings.EqualFold(key, "before") {
+				q.Before = t
+			} else {
+				q.After = t
+			}
+		default:
+			words = append(words, arg)
+		}
+	}
+
+	q.Text = strings.Join(words, " ")
+	if q.Text == "" && q.Room == "" && q.Sender == "" && q.Before.IsZero() && q.After.IsZero() {
+		return q, fmt.Errorf("nothing to search for")
+	}
+	return q, nil
+}
+
+// parseTime accepts an absolute time in local time or a duration before now
+func parseTime(value string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, value, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("use a date such as 2024-03-01, 2024-03-01T09:30 or a duration such as 2h")
+}
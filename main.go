@@ -2,239 +2,200 @@
 package main
 
 import (
-	"bufio"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
 	"os"
-	"strings"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/jonipwi/go-chat-client/chatclient"
+	"github.com/jonipwi/go-chat-client/commands"
+	"github.com/jonipwi/go-chat-client/config"
+	"github.com/jonipwi/go-chat-client/history"
+	"github.com/jonipwi/go-chat-client/metrics"
+	"github.com/jonipwi/go-chat-client/repl"
 	"github.com/jonipwi/go-chat-client/server_connection"
-	"github.com/jonipwi/go-chat-client/state"
+	"github.com/jonipwi/go-chat-client/tui"
+	"github.com/jonipwi/go-chat-client/utils"
 )
 
-func main() {
-	log.Println("[CHAT-CLIENT] STARTUP: Starting Go Socket.IO Chat Client with debug logging...")
+// logger logs the client's startup and shutdown
+var logger = utils.Log(utils.ComponentClient)
 
-	// Create client state with default username
-	clientState := state.NewClientState("GoClient")
+func main() {
+	cfg, err := config.Load(os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		config.Usage(os.Stdout)
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration error: %v\n\n", err)
+		config.Usage(os.Stderr)
+		os.Exit(2)
+	}
+	if err := utils.ConfigureLogging(cfg.LogOptions()); err != nil {
+		fmt.Fprintf(os.Stderr, "Logging error: %v\n", err)
+		os.Exit(1)
+	}
+	defer utils.CloseLog()
 
-	// Start the stats reporting in a goroutine
-	go server_connection.ReportStats(clientState)
+	logger.Info("Starting Go Socket.IO Chat Client", "level", cfg.LogLevel)
 
-	// Connect to server
-	log.Println("[CHAT-CLIENT] STARTUP: Initiating connection to server...")
-	client, err := server_connection.ConnectToServer("127.0.0.1", 8000, clientState)
+	servers, err := chatclient.NewServers(cfg)
 	if err != nil {
-		log.Fatalf("[CHAT-CLIENT] CONNECTION ERROR: Failed on initial connection to server: %v", err)
+		fatal("Invalid settings", err)
+	}
+	registry := commands.DefaultRegistry()
+
+	// SIGINT and SIGTERM end the UI and start a graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var background sync.WaitGroup
+
+	// Start the stats reporting of each server in a goroutine
+	for _, client := range servers.Clients() {
+		background.Add(1)
+		go func(client *chatclient.Client) {
+			defer background.Done()
+			server_connection.ReportStats(ctx, client.State(), cfg.StatsInterval.Duration)
+		}(client)
+	}
+
+	// Record every message sent and received so it can be looked up with
+	// /history and /search, in a separate file for each server
+	stores := make(map[string]*history.Store)
+	for _, client := range servers.Clients() {
+		file := client.Config().HistoryFile
+		if file == "" {
+			continue
+		}
+		store, err := history.Open(file)
+		if err != nil {
+			closeStores(stores)
+			fatal("Failed to open message history", err)
+		}
+		store.Subscribe(client.Router())
+		store.RecordSent(client.State())
+		stores[client.Name()] = store
+	}
+	if servers.Multiple() {
+		commands.RegisterServerHistory(registry, stores)
+	} else if store := stores[servers.Focused().Name()]; store != nil {
+		commands.RegisterHistory(registry, store)
 	}
 
-	clientState.SetClient(client)
+	// Expose the client counters to Prometheus, labelled with the server
+	// when there are several
+	if cfg.MetricsAddr != "" {
+		var m *metrics.Metrics
+		if servers.Multiple() {
+			m = metrics.NewServers()
+			for _, client := range servers.Clients() {
+				m.AddServer(client.Name(), client.State(), client.Router())
+			}
+		} else {
+			client := servers.Focused()
+			m = metrics.New(client.State(), client.Router())
+		}
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			if err := m.Serve(ctx, cfg.MetricsAddr); err != nil {
+				logger.Error("Metrics server failed", "error", err)
+			}
+		}()
+	}
+
+	// The UI subscribes to the clients before connecting so it sees every event
+	var fullScreen *tui.App
+	var lineMode *repl.REPL
+	if useTUI(cfg.UI) {
+		fullScreen = tui.New(servers, registry)
+	} else {
+		lineMode = repl.New(servers, registry)
+	}
 
-	// Start the heartbeat mechanism in a goroutine
-	go server_connection.StartHeartbeat(clientState)
+	// Connect, then keep the connections alive with heartbeats and reconnects
+	logger.Info("Initiating connection to server", "servers", len(servers.Clients()))
+	if err := servers.Connect(ctx); err != nil {
+		if ctx.Err() == nil {
+			logger.Error("Failed on initial connection to server", "error", err)
+			shutdown(stop, servers, stores, &background)
+			utils.CloseLog()
+			os.Exit(1)
+		}
+		logger.Info("Interrupted while connecting")
+		shutdown(stop, servers, stores, &background)
+		return
+	}
 
 	// Wait a moment for connection to stabilize
-	time.Sleep(1 * time.Second)
-
-	// Print welcome message and instructions
-	fmt.Println("\n=== Welcome to Go Chat Client ===")
-	fmt.Println("Available commands:")
-	fmt.Println("  /help - Show this help")
-	fmt.Println("  /quit - Exit the client")
-	fmt.Println("  /stats - Show connection stats")
-	fmt.Println("  /username <new_name> - Change your username")
-	fmt.Println("  /join <room_id> - Join a room")
-	fmt.Println("  /list groups - List available groups")
-	fmt.Println("  /list guilds - List available guilds")
-	fmt.Println("  /create group <name> - Create a new group")
-	fmt.Println("  /create guild <name> - Create a new guild")
-	fmt.Println("  /msg <user_id> <message> - Send private message")
-	fmt.Println("  /ping - Send a ping to the server")
-	fmt.Println("  /errors - Show recent connection errors")
-	fmt.Println("================================================")
-	fmt.Printf("You are connected as: %s\n", clientState.GetUsername())
-	fmt.Println("Type your message and press Enter to send to current room")
-	fmt.Print("> ")
-
-	// Start scanner for user input
-	scanner := bufio.NewScanner(os.Stdin)
-	for scanner.Scan() {
-		input := scanner.Text()
-
-		// Handle different commands
-		if strings.HasPrefix(input, "/") {
-			parts := strings.Fields(input)
-			if len(parts) == 0 {
-				continue
-			}
+	utils.Sleep(ctx, 1*time.Second)
 
-			command := strings.TrimPrefix(parts[0], "/")
-
-			switch command {
-			case "quit", "exit":
-				fmt.Println("Disconnecting and exiting...")
-				clientState.CloseConnection()
-				return
-
-			case "help":
-				fmt.Println("\nAvailable commands:")
-				fmt.Println("  /help - Show this help")
-				fmt.Println("  /quit - Exit the client")
-				fmt.Println("  /stats - Show connection stats")
-				fmt.Println("  /username <new_name> - Change your username")
-				fmt.Println("  /join <room_id> - Join a room")
-				fmt.Println("  /list groups - List available groups")
-				fmt.Println("  /list guilds - List available guilds")
-				fmt.Println("  /create group <name> - Create a new group")
-				fmt.Println("  /create guild <name> - Create a new guild")
-				fmt.Println("  /msg <user_id> <message> - Send private message")
-				fmt.Println("  /ping - Send a ping to the server")
-				fmt.Println("  /errors - Show recent connection errors")
-
-			case "stats":
-				fmt.Println(clientState.GetStats())
-
-			case "username":
-				if len(parts) < 2 {
-					fmt.Println("Usage: /username <new_name>")
-					continue
-				}
-				newUsername := parts[1]
-				err := client.Emit("username_change", newUsername)
-				if err != nil {
-					fmt.Printf("Error changing username: %v\n", err)
-					continue
-				}
-				clientState.SetUsername(newUsername)
-				fmt.Printf("Username change request sent to: %s\n", newUsername)
-
-			case "join":
-				if len(parts) < 2 {
-					fmt.Println("Usage: /join <room_id>")
-					continue
-				}
-				roomID := parts[1]
-				err := client.Emit("join_room", roomID)
-				if err != nil {
-					fmt.Printf("Error joining room: %v\n", err)
-					continue
-				}
-				fmt.Printf("Join request sent for room: %s\n", roomID)
-
-			case "list":
-				if len(parts) < 2 {
-					fmt.Println("Usage: /list groups|guilds")
-					continue
-				}
-				roomType := parts[1]
-				if roomType != "groups" && roomType != "guilds" {
-					fmt.Println("Invalid room type. Use 'groups' or 'guilds'")
-					continue
-				}
-				// Convert to singular for the server
-				if roomType == "groups" {
-					roomType = "group"
-				} else {
-					roomType = "guild"
-				}
-				err := client.Emit("list_rooms", roomType)
-				if err != nil {
-					fmt.Printf("Error listing rooms: %v\n", err)
-					continue
-				}
-				fmt.Printf("Listing %s...\n", roomType)
-
-			case "create":
-				if len(parts) < 3 {
-					fmt.Println("Usage: /create group|guild <name>")
-					continue
-				}
-				roomType := parts[1]
-				if roomType != "group" && roomType != "guild" {
-					fmt.Println("Invalid room type. Use 'group' or 'guild'")
-					continue
-				}
-				roomName := parts[2]
-				err := client.Emit("create_room", roomType, roomName)
-				if err != nil {
-					fmt.Printf("Error creating room: %v\n", err)
-					continue
-				}
-				fmt.Printf("Creating %s: %s\n", roomType, roomName)
-
-			case "msg":
-				if len(parts) < 3 {
-					fmt.Println("Usage: /msg <user_id> <message>")
-					continue
-				}
-				targetUserID := parts[1]
-				messageText := strings.Join(parts[2:], " ")
-				err := client.Emit("private_message", targetUserID, messageText)
-				if err != nil {
-					fmt.Printf("Error sending private message: %v\n", err)
-					continue
-				}
-				fmt.Printf("Private message sent to %s\n", targetUserID)
-
-			case "ping":
-				err := client.Emit("ping", "Ping from client")
-				if err != nil {
-					fmt.Printf("Error sending ping: %v\n", err)
-					continue
-				}
-				fmt.Println("Ping sent to server")
-
-			case "errors":
-				errors := clientState.GetConnectionErrors()
-				if len(errors) == 0 {
-					fmt.Println("No connection errors recorded")
-				} else {
-					fmt.Println("Recent connection errors:")
-					for i, err := range errors {
-						fmt.Printf("%d. %s\n", i+1, err)
-					}
-				}
-
-			default:
-				fmt.Printf("Unknown command: %s. Type /help for available commands.\n", command)
-			}
-		} else if input != "" {
-			// Not a command, send as a chat message to current room
-			currentRoom := clientState.GetCurrentRoom()
-			var err error
-
-			if currentRoom == "" || currentRoom == "global" {
-				// Send to global chat
-				err = client.Emit("global_message", input)
-				if err != nil {
-					fmt.Printf("Error sending message: %v\n", err)
-				} else {
-					clientState.TrackMessageSent()
-				}
-			} else {
-				// Check if it's a group or guild (simplified - you might want to improve this)
-				if strings.HasPrefix(currentRoom, "demo-guild") {
-					err = client.Emit("guild_message", currentRoom, input)
-				} else {
-					err = client.Emit("group_message", currentRoom, input)
-				}
-
-				if err != nil {
-					fmt.Printf("Error sending message: %v\n", err)
-				} else {
-					clientState.TrackMessageSent()
-				}
-			}
+	if fullScreen != nil {
+		// The full-screen UI owns the terminal, so logs only go to the log file
+		utils.SetLogConsole(nil)
+		if err := fullScreen.Run(ctx); err != nil {
+			logger.Error("UI failed", "error", err)
 		}
+		utils.SetLogConsole(os.Stderr)
+	} else {
+		lineMode.Run(ctx)
+	}
+
+	if ctx.Err() != nil {
+		logger.Info("Received signal, shutting down")
+	}
+	shutdown(stop, servers, stores, &background)
+}
 
-		fmt.Print("> ")
+// shutdownTimeout bounds how long shutdown waits for goroutines to finish
+const shutdownTimeout = 5 * time.Second
+
+// shutdown stops the background goroutines, disconnects the clients after
+// sending what is left in their outboxes, and closes the message history
+// last so it records those messages too
+func shutdown(stop context.CancelFunc, servers *chatclient.Servers, stores map[string]*history.Store, background *sync.WaitGroup) {
+	stop()
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := servers.Shutdown(ctx); err != nil {
+		logger.Warn("Client did not shut down cleanly", "error", err)
+	}
+	if err := utils.Wait(ctx, background); err != nil {
+		logger.Warn("Background goroutines did not stop in time", "error", err)
 	}
+	closeStores(stores)
+}
 
-	if err := scanner.Err(); err != nil {
-		log.Printf("Error reading input: %v", err)
+// closeStores closes the message history of each server
+func closeStores(stores map[string]*history.Store) {
+	for server, store := range stores {
+		if err := store.Close(); err != nil {
+			logger.Error("Failed to close message history", "server", server, "error", err)
+		}
 	}
+}
+
+// fatal logs err and exits. Deferred calls do not run.
+func fatal(msg string, err error) {
+	logger.Error(msg, "error", err)
+	utils.CloseLog()
+	os.Exit(1)
+}
 
-	// Close connection before exiting
-	clientState.CloseConnection()
+// useTUI decides whether to start the full-screen UI for the configured mode
+func useTUI(mode string) bool {
+	switch mode {
+	case config.UITUI:
+		return true
+	case config.UIAuto:
+		return tui.Available()
+	}
+	return false
 }
@@ -0,0 +1,93 @@
+// collector.go
+package metrics
+
+import (
+	"github.com/jonipwi/go-chat-client/state"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// stateCollector reads the counters kept in ClientState on every scrape, so
+// the metrics always agree with /stats
+type stateCollector struct {
+	clientState *state.ClientState
+
+	connected          *prometheus.Desc
+	messagesSent       *prometheus.Desc
+	messagesReceived   *prometheus.Desc
+	heartbeatsSent     *prometheus.Desc
+	heartbeatsReceived *prometheus.Desc
+	connectionErrors   *prometheus.Desc
+	authErrors         *prometheus.Desc
+	reconnectAttempts  *prometheus.Desc
+	reconnects         *prometheus.Desc
+	queueDepth         *prometheus.Desc
+	pendingRequests    *prometheus.Desc
+	lostProbes         *prometheus.Desc
+	emitFailures       *prometheus.Desc
+}
+
+// newStateCollector creates the collector for clientState
+func newStateCollector(clientState *state.ClientState) *stateCollector {
+	desc := func(name, help string, labels ...string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "", name), help, labels, nil)
+	}
+	return &stateCollector{
+		clientState:        clientState,
+		connected:          desc("connected", "Whether the client is connected to the server."),
+		messagesSent:       desc("messages_sent_total", "Messages sent to the server."),
+		messagesReceived:   desc("messages_received_total", "Chat messages received from the server."),
+		heartbeatsSent:     desc("heartbeats_sent_total", "Heartbeats sent to the server."),
+		heartbeatsReceived: desc("heartbeats_received_total", "Heartbeats received from the server."),
+		connectionErrors:   desc("connection_errors_total", "Connection errors, including auth rejections."),
+		authErrors:         desc("auth_errors_total", "Times the server rejected the client's credentials."),
+		reconnectAttempts:  desc("reconnect_attempts_total", "Reconnection attempts."),
+		reconnects:         desc("reconnects_total", "Successful reconnections."),
+		queueDepth:         desc("outbox_queue_depth", "Messages waiting in the outbox to be sent."),
+		pendingRequests:    desc("pending_requests", "Requests waiting for the server's acknowledgement."),
+		lostProbes:         desc("lost_probes_total", "Pings and heartbeats that got no reply in time."),
+		emitFailures:       desc("emit_failures_total", "Events that could not be written to the connection.", "event"),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *stateCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{
+		c.connected, c.messagesSent, c.messagesReceived, c.heartbeatsSent, c.heartbeatsReceived,
+		c.connectionErrors, c.authErrors, c.reconnectAttempts, c.reconnects,
+		c.queueDepth, c.pendingRequests, c.lostProbes, c.emitFailures,
+	} {
+		ch <- d
+	}
+}
+
+// Collect implements prometheus.Collector
+func (c *stateCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.clientState.Snapshot()
+
+	connected := 0.0
+	if stats.Connected {
+		connected = 1
+	}
+	gauge := func(d *prometheus.Desc, v float64) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.GaugeValue, v)
+	}
+	counter := func(d *prometheus.Desc, v int, labels ...string) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.CounterValue, float64(v), labels...)
+	}
+
+	gauge(c.connected, connected)
+	counter(c.messagesSent, stats.MessagesSent)
+	counter(c.messagesReceived, stats.MessagesReceived)
+	counter(c.heartbeatsSent, stats.HeartbeatsSent)
+	counter(c.heartbeatsReceived, stats.HeartbeatsReceived)
+	counter(c.connectionErrors, stats.ConnectionErrorsTotal)
+	counter(c.authErrors, stats.AuthErrors)
+	counter(c.reconnectAttempts, stats.ReconnectAttempts)
+	counter(c.reconnects, stats.Reconnects)
+	gauge(c.queueDepth, float64(stats.QueuedMessages))
+	gauge(c.pendingRequests, float64(c.clientState.Requests().Pending()))
+	counter(c.lostProbes, stats.Latency.Lost)
+	for event, n := range stats.EmitFailures {
+		counter(c.emitFailures, n, event)
+	}
+}
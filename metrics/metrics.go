@@ -0,0 +1,125 @@
+// metrics.go
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/jonipwi/go-chat-client/events"
+	"github.com/jonipwi/go-chat-client/history"
+	"github.com/jonipwi/go-chat-client/state"
+	"github.com/jonipwi/go-chat-client/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes every metric name
+const namespace = "chat_client"
+
+// rttBuckets are the round-trip histogram bounds in seconds, from 5ms to 10s
+var rttBuckets = prometheus.ExponentialBuckets(0.005, 2, 12)
+
+// logger logs the metrics server
+var logger = utils.Log(utils.ComponentMetrics)
+
+// Metrics exposes the client's counters in the Prometheus text format
+type Metrics struct {
+	registry *prometheus.Registry
+}
+
+// serverMetrics counts the messages and round trips of one client
+type serverMetrics struct {
+	roomMessages *prometheus.CounterVec
+	rtt          *prometheus.HistogramVec
+}
+
+// New creates the metrics for clientState. Incoming messages are counted
+// from router, sent ones as the client delivers them.
+func New(clientState *state.ClientState, router *events.Router) *Metrics {
+	m := &Metrics{registry: prometheus.NewRegistry()}
+	watch(m.registry, clientState, router)
+	return m
+}
+
+// NewServers creates the metrics of a client connected to several servers.
+// Each server is added with AddServer.
+func NewServers() *Metrics {
+	return &Metrics{registry: prometheus.NewRegistry()}
+}
+
+// AddServer exposes the counters of the client connected to the named
+// server, with a "server" label on every series
+func (m *Metrics) AddServer(name string, clientState *state.ClientState, router *events.Router) {
+	watch(prometheus.WrapRegistererWith(prometheus.Labels{"server": name}, m.registry), clientState, router)
+}
+
+// watch registers the metrics of one client with registerer
+func watch(registerer prometheus.Registerer, clientState *state.ClientState, router *events.Router) *serverMetrics {
+	m := &serverMetrics{
+		roomMessages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "room_messages_total",
+			Help:      "Chat messages by direction, message type and room. Private conversations share the room \"private\".",
+		}, []string{"direction", "type", "room"}),
+		rtt: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "rtt_seconds",
+			Help:      "Round-trip time of pings and heartbeats.",
+			Buckets:   rttBuckets,
+		}, []string{"kind"}),
+	}
+	registerer.MustRegister(m.roomMessages, m.rtt, newStateCollector(clientState))
+
+	router.Subscribe(func(e events.Event) {
+		if e.Message != nil {
+			m.countMessage("received", *e.Message)
+		}
+	})
+	clientState.OnSent(func(event string, args []interface{}) {
+		if msg, ok := history.SentMessage(event, args, ""); ok {
+			m.countMessage("sent", msg)
+		}
+	})
+	clientState.Latency().OnSample(func(kind string, rtt time.Duration) {
+		m.rtt.WithLabelValues(kind).Observe(rtt.Seconds())
+	})
+	return m
+}
+
+// countMessage counts a message under its room. Private messages are not
+// labelled with the peer, which would create a series per user.
+func (m *serverMetrics) countMessage(direction string, msg events.Message) {
+	room := msg.Type
+	if (msg.Type == events.TypeGroup || msg.Type == events.TypeGuild) && msg.Room != "" {
+		room = msg.Room
+	}
+	m.roomMessages.WithLabelValues(direction, msg.Type, room).Inc()
+}
+
+// Handler returns the HTTP handler serving the metrics
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Serve serves the metrics on addr at /metrics until ctx is done or the server fails
+func (m *Metrics) Serve(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.Handler())
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+
+	stop := context.AfterFunc(ctx, func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	})
+	defer stop()
+
+	logger.Info("Serving Prometheus metrics", "url", "http://"+addr+"/metrics")
+	err := server.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
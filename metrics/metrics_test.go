@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonipwi/go-chat-client/events"
+	"github.com/jonipwi/go-chat-client/state"
+)
+
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	return string(body)
+}
+
+func TestMetricsExposeClientState(t *testing.T) {
+	clientState := state.NewClientState("testuser")
+	m := NewServers()
+	sm := watch(m.registry, clientState, events.NewRouter(clientState))
+
+	clientState.TrackHeartbeatSent()
+	clientState.AddConnectionError("boom")
+	clientState.TrackEmitFailure("join_room")
+	clientState.Send("global_message", "queued while offline")
+
+	probe := clientState.Latency().Start(state.ProbePing)
+	clientState.Latency().Complete(state.ProbePing, probe.ID, probe.SentAt.Add(20*time.Millisecond))
+
+	sm.countMessage("received", events.Message{Type: events.TypeGroup, Room: "room-1"})
+	sm.countMessage("received", events.Message{Type: events.TypePrivate, Room: "alice"})
+
+	body := scrape(t, m)
+	for _, want := range []string{
+		"chat_client_connected 0",
+		"chat_client_heartbeats_sent_total 1",
+		"chat_client_connection_errors_total 1",
+		`chat_client_emit_failures_total{event="join_room"} 1`,
+		"chat_client_outbox_queue_depth 1",
+		`chat_client_rtt_seconds_count{kind="ping"} 1`,
+		`chat_client_rtt_seconds_bucket{kind="ping",le="0.02"} 1`,
+		`chat_client_room_messages_total{direction="received",room="room-1",type="group"} 1`,
+		`chat_client_room_messages_total{direction="received",room="private",type="private"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", want, body)
+		}
+	}
+}
+
+func TestMetricsLabelServers(t *testing.T) {
+	m := NewServers()
+	for _, name := range []string{"prod", "staging"} {
+		clientState := state.NewClientState("testuser")
+		m.AddServer(name, clientState, events.NewRouter(clientState))
+		if name == "prod" {
+			clientState.TrackHeartbeatSent()
+		}
+	}
+
+	body := scrape(t, m)
+	for _, want := range []string{
+		`chat_client_heartbeats_sent_total{server="prod"} 1`,
+		`chat_client_heartbeats_sent_total{server="staging"} 0`,
+		`chat_client_connected{server="staging"} 0`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+// render.go
+package render
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/jonipwi/go-chat-client/events"
+	"github.com/jonipwi/go-chat-client/utils"
+)
+
+// Color is how a message type is colored on an ANSI terminal and in the full-screen UI
+type Color struct {
+	ANSI string // SGR parameters, e.g. "36" for cyan
+	Name string // Color name understood by tview, e.g. "aqua"
+}
+
+// typeColors colors each message type so rooms can be told apart at a glance
+var typeColors = map[string]Color{
+	events.TypeGlobal:  {ANSI: "36", Name: "aqua"},
+	events.TypeGroup:   {ANSI: "32", Name: "green"},
+	events.TypeGuild:   {ANSI: "35", Name: "fuchsia"},
+	events.TypePrivate: {ANSI: "33", Name: "yellow"},
+	events.TypeSystem:  {ANSI: "90", Name: "gray"},
+}
+
+// ColorFor returns the color of a message type; unknown types are shown like system messages
+func ColorFor(msgType string) Color {
+	if c, ok := typeColors[msgType]; ok {
+		return c
+	}
+	return typeColors[events.TypeSystem]
+}
+
+// Line is a message broken into the parts shown to the user
+type Line struct {
+	Time    string // Formatted with utils.FormatTimestamp
+	Label   string // Where the message was sent, e.g. "group:room-1", "private" or "staging/global"
+	Sender  string
+	Content string
+	Color   Color
+}
+
+// NewLine prepares a message for display. Control characters in the
+// payload are replaced so a message cannot move the cursor or change colors.
+func NewLine(msg events.Message) Line {
+	label := msg.Type
+	if msg.Room != "" && (msg.Type == events.TypeGroup || msg.Type == events.TypeGuild) {
+		label = msg.Type + ":" + msg.Room
+	}
+	return Line{
+		Time:    utils.FormatTimestamp(msg.Timestamp),
+		Label:   sanitize(label),
+		Sender:  sanitize(msg.Sender),
+		Content: sanitize(msg.Content),
+		Color:   ColorFor(msg.Type),
+	}
+}
+
+// NewNotice prepares a "user joined" or "user left" event for display in
+// the room it happened in, or in global chat if it names no room. It
+// reports false for other events.
+func NewNotice(e events.Event) (Line, bool) {
+	if e.User == nil || (e.Name != "user joined" && e.Name != "user left") {
+		return Line{}, false
+	}
+	label, color := events.TypeGlobal, ColorFor(events.TypeGlobal)
+	if e.Room != nil && e.Room.ID != "" {
+		label = e.Room.ID
+		if e.Room.Type != "" {
+			label = e.Room.Type + ":" + e.Room.ID
+			color = ColorFor(e.Room.Type)
+		}
+	}
+	return Line{
+		Time:    utils.FormatTimestamp(time.Now()),
+		Label:   sanitize(label),
+		Content: sanitize(e.User.Name() + " " + strings.TrimPrefix(e.Name, "user ")),
+		Color:   color,
+	}, true
+}
+
+// TypingIndicator describes the users typing in a room, e.g. "alice, bob
+// are typing…", or returns "" if nobody is
+func TypingIndicator(names []string) string {
+	switch {
+	case len(names) == 0:
+		return ""
+	case len(names) == 1:
+		return sanitize(names[0]) + " is typing…"
+	case len(names) > 3:
+		return "Several people are typing…"
+	}
+	return sanitize(strings.Join(names, ", ")) + " are typing…"
+}
+
+// FromServer labels the line with the server it came from, e.g.
+// "staging/group:room-1", for when the client is connected to several
+func (l Line) FromServer(server string) Line {
+	if server != "" {
+		l.Label = sanitize(server) + "/" + l.Label
+	}
+	return l
+}
+
+// String formats the line without colors
+func (l Line) String() string {
+	if l.Sender == "" {
+		return fmt.Sprintf("%s [%s] %s", l.Time, l.Label, l.Content)
+	}
+	return fmt.Sprintf("%s [%s] %s: %s", l.Time, l.Label, l.Sender, l.Content)
+}
+
+// ANSI formats the line with the label in the type's color and the sender in bold
+func (l Line) ANSI() string {
+	label := fmt.Sprintf("\x1b[%sm[%s]\x1b[0m", l.Color.ANSI, l.Label)
+	time := fmt.Sprintf("\x1b[90m%s\x1b[0m", l.Time)
+	if l.Sender == "" {
+		return fmt.Sprintf("%s %s %s", time, label, l.Content)
+	}
+	return fmt.Sprintf("%s %s \x1b[1m%s\x1b[0m: %s", time, label, l.Sender, l.Content)
+}
+
+// sanitize replaces control characters, including escape sequences, with spaces
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, s)
+}
+
+// Printer writes incoming chat messages and presence notices to a console. The writer is
+// expected to keep the input line intact, as golang.org/x/term's Terminal
+// does; Printer itself only makes sure lines are not interleaved.
+type Printer struct {
+	mu    sync.Mutex
+	out   io.Writer
+	color bool
+}
+
+// NewPrinter creates a printer writing to out, with ANSI colors if color is set
+func NewPrinter(out io.Writer, color bool) *Printer {
+	return &Printer{out: out, color: color}
+}
+
+// Subscribe prints every chat message and presence notice the router decodes
+func (p *Printer) Subscribe(router *events.Router) {
+	router.Subscribe(p.PrintEvent)
+}
+
+// PrintEvent writes the message or presence notice an event carries, if any
+func (p *Printer) PrintEvent(e events.Event) {
+	p.PrintServerEvent("", e)
+}
+
+// PrintServerEvent writes the message or presence notice an event carries,
+// labelled with the server it came from unless server is empty
+func (p *Printer) PrintServerEvent(server string, e events.Event) {
+	if e.Message != nil {
+		p.write(NewLine(*e.Message).FromServer(server))
+		return
+	}
+	if line, ok := NewNotice(e); ok {
+		p.write(line.FromServer(server))
+	}
+}
+
+// Print writes a single message
+func (p *Printer) Print(msg events.Message) {
+	p.write(NewLine(msg))
+}
+
+// write prints line, in color if enabled
+func (p *Printer) write(line Line) {
+	text := line.String()
+	if p.color {
+		text = line.ANSI()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintln(p.out, text)
+}
@@ -0,0 +1,135 @@
+package render
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonipwi/go-chat-client/events"
+)
+
+func TestNewLine(t *testing.T) {
+	ts := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		msg      events.Message
+		expected string
+	}{
+		{
+			events.Message{Type: events.TypeGlobal, Sender: "alice", Content: "hello", Timestamp: ts},
+			"2024-03-01 09:30:00 [global] alice: hello",
+		},
+		{
+			events.Message{Type: events.TypeGroup, Room: "room-1", Sender: "bob", Content: "hi", Timestamp: ts},
+			"2024-03-01 09:30:00 [group:room-1] bob: hi",
+		},
+		{
+			events.Message{Type: events.TypePrivate, Room: "ignored", Sender: "carol", Content: "psst", Timestamp: ts},
+			"2024-03-01 09:30:00 [private] carol: psst",
+		},
+		{
+			events.Message{Type: events.TypeSystem, Content: "server restarting", Timestamp: ts},
+			"2024-03-01 09:30:00 [system] server restarting",
+		},
+		{
+			// Escape sequences and newlines in the payload are neutralized
+			events.Message{Type: events.TypeGlobal, Sender: "eve\x1b[2J", Content: "line1\nline2\x1b[31m", Timestamp: ts},
+			"2024-03-01 09:30:00 [global] eve [2J: line1 line2 [31m",
+		},
+	}
+
+	for _, test := range tests {
+		if got := NewLine(test.msg).String(); got != test.expected {
+			t.Errorf("NewLine(%+v).String() = %q; expected %q", test.msg, got, test.expected)
+		}
+	}
+}
+
+func TestColorFor(t *testing.T) {
+	if ColorFor(events.TypeGroup) == ColorFor(events.TypeGlobal) {
+		t.Error("Expected group and global messages to have different colors")
+	}
+	if ColorFor("unknown") != ColorFor(events.TypeSystem) {
+		t.Error("Expected unknown message types to be colored like system messages")
+	}
+}
+
+func TestPrinter(t *testing.T) {
+	msg := events.Message{Type: events.TypeGuild, Room: "demo-guild", Sender: "dave", Content: "gg", Timestamp: time.Now()}
+
+	var plain bytes.Buffer
+	NewPrinter(&plain, false).Print(msg)
+	if strings.Contains(plain.String(), "\x1b[") {
+		t.Errorf("Expected no escape sequences without color, got %q", plain.String())
+	}
+	if !strings.HasSuffix(plain.String(), "[guild:demo-guild] dave: gg\n") {
+		t.Errorf("Unexpected plain output %q", plain.String())
+	}
+
+	var colored bytes.Buffer
+	NewPrinter(&colored, true).Print(msg)
+	if !strings.Contains(colored.String(), "\x1b[35m[guild:demo-guild]\x1b[0m") {
+		t.Errorf("Expected the label in the guild color, got %q", colored.String())
+	}
+}
+
+func TestPrintServerEvent(t *testing.T) {
+	var out bytes.Buffer
+	p := NewPrinter(&out, false)
+	p.PrintServerEvent("staging", events.Event{Message: &events.Message{Type: events.TypeGroup, Room: "room-1", Sender: "bob", Content: "hi", Timestamp: time.Now()}})
+	p.PrintServerEvent("prod", events.Event{Name: "user left", User: &events.User{Username: "carol"}})
+	p.PrintEvent(events.Event{Message: &events.Message{Type: events.TypeGlobal, Sender: "dave", Content: "hey", Timestamp: time.Now()}})
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	expected := []string{"[staging/group:room-1] bob: hi", "[prod/global] carol left", "[global] dave: hey"}
+	if len(lines) != len(expected) {
+		t.Fatalf("Printed %q", out.String())
+	}
+	for i, suffix := range expected {
+		if !strings.HasSuffix(lines[i], suffix) {
+			t.Errorf("Line %d = %q; expected it to end with %q", i, lines[i], suffix)
+		}
+	}
+}
+
+func TestNewNotice(t *testing.T) {
+	tests := []struct {
+		event    events.Event
+		expected string // Line after the timestamp, "" if the event is no notice
+	}{
+		{events.Event{Name: "user joined", User: &events.User{Username: "alice"}}, "[global] alice joined"},
+		{events.Event{Name: "user left", User: &events.User{ID: "u-7"}, Room: &events.Room{ID: "room-1", Type: events.TypeGroup}}, "[group:room-1] u-7 left"},
+		{events.Event{Name: "user joined", User: &events.User{Username: "bob"}, Room: &events.Room{ID: "room-2"}}, "[room-2] bob joined"},
+		{events.Event{Name: "typing", User: &events.User{Username: "bob"}}, ""},
+		{events.Event{Name: "user joined"}, ""},
+	}
+
+	for _, test := range tests {
+		line, ok := NewNotice(test.event)
+		if ok != (test.expected != "") {
+			t.Errorf("NewNotice(%s) ok = %v", test.event.Name, ok)
+			continue
+		}
+		if ok && !strings.HasSuffix(line.String(), " "+test.expected) {
+			t.Errorf("NewNotice(%s).String() = %q; expected it to end with %q", test.event.Name, line.String(), test.expected)
+		}
+	}
+}
+
+func TestTypingIndicator(t *testing.T) {
+	tests := []struct {
+		names    []string
+		expected string
+	}{
+		{nil, ""},
+		{[]string{"alice"}, "alice is typing…"},
+		{[]string{"alice", "bob"}, "alice, bob are typing…"},
+		{[]string{"a", "b", "c", "d"}, "Several people are typing…"},
+	}
+	for _, test := range tests {
+		if got := TypingIndicator(test.names); got != test.expected {
+			t.Errorf("TypingIndicator(%v) = %q; expected %q", test.names, got, test.expected)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+// repl.go
+package repl
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode"
+
+	"github.com/jonipwi/go-chat-client/chatclient"
+	"github.com/jonipwi/go-chat-client/commands"
+	"github.com/jonipwi/go-chat-client/events"
+	"github.com/jonipwi/go-chat-client/render"
+	"github.com/jonipwi/go-chat-client/state"
+	"github.com/jonipwi/go-chat-client/utils"
+	"golang.org/x/term"
+)
+
+// logger logs input errors
+var logger = utils.Log(utils.ComponentUI)
+
+// prompt is shown in front of the input line
+const prompt = "> "
+
+// REPL is the line-based client: it reads commands and messages from stdin
+// and prints command output and incoming messages to stdout.
+//
+// When stdin is a terminal the input line is edited with golang.org/x/term,
+// which redraws the prompt and whatever was typed so far whenever output is
+// printed, so incoming messages and log lines never corrupt the input.
+type REPL struct {
+	servers     *chatclient.Servers
+	registry    *commands.Registry
+	interactive bool
+	console     *console
+	terminal    atomic.Pointer[term.Terminal] // Line editor while one is active
+}
+
+// New creates the REPL for servers and starts printing the chat messages
+// they receive, labelled with the server when there are several
+func New(servers *chatclient.Servers, registry *commands.Registry) *REPL {
+	interactive := term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
+	r := &REPL{
+		servers:     servers,
+		registry:    registry,
+		interactive: interactive,
+		console:     &console{w: os.Stdout},
+	}
+
+	// NO_COLOR disables colors, see https://no-color.org
+	color := interactive && os.Getenv("NO_COLOR") == ""
+	printer := render.NewPrinter(r.console, color)
+	servers.OnEvent(func(c *chatclient.Client, e events.Event) {
+		printer.PrintServerEvent(r.label(c), e)
+	})
+	for _, c := range servers.Clients() {
+		c.State().Typing().OnChange(func(string) { r.refreshPrompt() })
+	}
+	servers.OnFocus(func(*chatclient.Client) { r.refreshPrompt() })
+	return r
+}
+
+// client returns the client of the server in focus
+func (r *REPL) client() *chatclient.Client {
+	return r.servers.Focused()
+}
+
+// state returns the state of the server in focus
+func (r *REPL) state() *state.ClientState {
+	return r.client().State()
+}
+
+// label returns the name messages from c are labelled with, none when
+// there is only one server
+func (r *REPL) label(c *chatclient.Client) string {
+	if !r.servers.Multiple() {
+		return ""
+	}
+	return c.Name()
+}
+
+// newContext creates the context commands run with
+func (r *REPL) newContext() *commands.Context {
+	ctx := &commands.Context{State: r.state(), Out: r.console, Registry: r.registry}
+	if r.servers.Multiple() {
+		ctx.Servers, ctx.Server = r.servers, r.client().Name()
+	}
+	return ctx
+}
+
+// Run reads input until the user quits, input ends or runCtx is done
+func (r *REPL) Run(runCtx context.Context) {
+	ctx := r.newContext()
+	ctx.Ctx = runCtx
+
+	// Print welcome message and instructions
+	ctx.Println("\n=== Welcome to Go Chat Client ===")
+	ctx.Printf("%s", r.registry.Help())
+	ctx.Println("================================================")
+	if r.servers.Multiple() {
+		for _, c := range r.servers.Clients() {
+			ctx.Printf("Server %s: connected as %s\n", c.Name(), c.State().GetUsername())
+		}
+		ctx.Printf("Talking on server %s, use /server to switch\n", r.client().Name())
+	} else {
+		ctx.Printf("You are connected as: %s\n", r.state().GetUsername())
+	}
+	ctx.Println("Type your message and press Enter to send to current room")
+
+	if r.interactive {
+		err := r.runTerminal(runCtx, ctx)
+		if err == nil {
+			return
+		}
+		logger.Warn("Line editing unavailable, falling back to plain input", "error", err)
+	}
+	r.runPlain(runCtx, ctx)
+}
+
+// runTerminal reads input with a line editor while the terminal is in raw mode
+func (r *REPL) runTerminal(runCtx context.Context, ctx *commands.Context) error {
+	fd := int(os.Stdin.Fd())
+	oldState, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, oldState)
+
+	t := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, prompt)
+	if width, height, err := term.GetSize(fd); err == nil {
+		t.SetSize(width, height)
+	}
+
+	// In raw mode every line of output has to go through the line editor,
+	// including the logs that would otherwise be written straight to the terminal
+	r.console.set(t)
+	utils.SetLogConsole(r.console)
+	t.AutoCompleteCallback = r.onKey
+	r.terminal.Store(t)
+	r.refreshPrompt()
+	defer func() {
+		r.terminal.Store(nil)
+		r.console.set(os.Stdout)
+		utils.SetLogConsole(os.Stderr)
+	}()
+
+	r.loop(runCtx, ctx, t.ReadLine, false)
+	return nil
+}
+
+// runPlain reads input line by line, for when stdin is not a terminal
+func (r *REPL) runPlain(runCtx context.Context, ctx *commands.Context) {
+	fmt.Fprint(r.console, prompt)
+
+	// Start scanner for user input
+	scanner := bufio.NewScanner(os.Stdin)
+	r.loop(runCtx, ctx, func() (string, error) {
+		if scanner.Scan() {
+			return scanner.Text(), nil
+		}
+		if err := scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}, true)
+}
+
+// loop handles the lines returned by read until the user quits, read fails
+// or runCtx is done, printing the prompt after each line if showPrompt is
+// set. Lines are read on a separate goroutine so a pending read never holds
+// up shutdown; that goroutine ends with the next line typed.
+func (r *REPL) loop(runCtx context.Context, ctx *commands.Context, read func() (string, error), showPrompt bool) {
+	runCtx, cancel := context.WithCancel(runCtx)
+	defer cancel()
+
+	type input struct {
+		line string
+		err  error
+	}
+	inputs := make(chan input)
+	go func() {
+		for {
+			line, err := read()
+			select {
+			case inputs <- input{line, err}:
+			case <-runCtx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-runCtx.Done():
+			return
+		case in := <-inputs:
+			if in.err == io.EOF {
+				// Ctrl-C or Ctrl-D, or the end of piped input
+				return
+			}
+			if in.err != nil {
+				logger.Error("Failed to read input", "error", in.err)
+				return
+			}
+			if r.handle(ctx, in.line) {
+				return
+			}
+			// The current room may have changed
+			r.refreshPrompt()
+			if showPrompt {
+				fmt.Fprint(r.console, prompt)
+			}
+		}
+	}
+}
+
+// handle runs a command or sends a chat message and reports whether the user asked to quit
+func (r *REPL) handle(ctx *commands.Context, input string) bool {
+	if strings.HasPrefix(input, "/") {
+		if err := r.registry.Dispatch(ctx, input); err != nil {
+			if errors.Is(err, commands.ErrUnknownCommand) {
+				ctx.Printf("%v. Type /help for available commands.\n", err)
+			} else {
+				ctx.Println(err)
+			}
+		}
+		return ctx.Quitting()
+	}
+
+	if input != "" {
+		// Not a command, send as a chat message to current room
+		queued, err := r.client().SendChat(input)
+		commands.PrintSendResult(ctx, queued, err)
+	}
+	return false
+}
+
+// onKey sends typing indicators while a chat message is composed in the line
+// editor. It is called for each printable key press and never changes the line.
+func (r *REPL) onKey(line string, pos int, key rune) (string, int, bool) {
+	if !unicode.IsPrint(key) {
+		return "", 0, false
+	}
+	if strings.HasPrefix(line[:pos]+string(key)+line[pos:], "/") {
+		r.state().Typing().Stop()
+	} else {
+		r.state().Typing().Keystroke(r.state().GetCurrentRoom())
+	}
+	return "", 0, false
+}
+
+// refreshPrompt shows the server and room in focus and who is typing in it
+// in front of the prompt, while the line editor is active
+func (r *REPL) refreshPrompt() {
+	t := r.terminal.Load()
+	if t == nil {
+		return
+	}
+	clientState := r.state()
+	room := clientState.GetCurrentRoom()
+	where := room
+	if server := r.label(r.client()); server != "" {
+		where = strings.TrimSuffix(server+":"+room, ":")
+	}
+	p := prompt
+	if where != "" {
+		p = "[" + where + "] " + prompt
+	}
+	if typing := render.TypingIndicator(clientState.Typing().Typists(room)); typing != "" {
+		p = "(" + typing + ") " + p
+	}
+	t.SetPrompt(p)
+	// Writing nothing redraws the input line with the new prompt
+	t.Write(nil)
+}
+
+// console forwards output to stdout, or to the line editor while one is active
+type console struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// Write implements io.Writer
+func (c *console) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	w := c.w
+	c.mu.Unlock()
+	return w.Write(p)
+}
+
+// set changes where output goes
+func (c *console) set(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.w = w
+}
@@ -0,0 +1,99 @@
+package repl
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jonipwi/go-chat-client/chatclient"
+	"github.com/jonipwi/go-chat-client/commands"
+	"github.com/jonipwi/go-chat-client/config"
+	"github.com/jonipwi/go-chat-client/socketiotest"
+)
+
+// output collects what the REPL prints, including from the goroutines awaiting answers
+type output struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+// Write implements io.Writer
+func (o *output) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.Write(p)
+}
+
+// String returns everything printed so far
+func (o *output) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.String()
+}
+
+func TestCommandsAgainstServer(t *testing.T) {
+	srv := socketiotest.NewServer()
+	defer srv.Close()
+	srv.Handle("private_message", func(c *socketiotest.Conn, e socketiotest.Event) []interface{} {
+		if e.StringArg(0) == "nobody" {
+			return socketiotest.Reject("no such user")
+		}
+		return nil
+	})
+
+	cfg := config.Default()
+	srv.Configure(&cfg)
+	cfg.ConnectRetries = 1
+	servers, err := chatclient.NewServers(cfg)
+	if err != nil {
+		t.Fatalf("NewServers() error: %v", err)
+	}
+	if err := servers.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() error: %v", err)
+	}
+	defer servers.Close()
+
+	out := &output{}
+	r := &REPL{servers: servers, registry: commands.DefaultRegistry(), console: &console{w: out}}
+	ctx := r.newContext()
+
+	steps := []struct {
+		input    string
+		event    string   // Event the server should receive
+		args     []string // Its leading arguments
+		expected string   // Output printed once the server answered
+	}{
+		{"/join room-1", "join_room", []string{"room-1"}, "✅ Room room-1: joined"},
+		{"hello room", "group_message", []string{"room-1", "hello room"}, ""},
+		{"/global hello all", "global_message", []string{"hello all"}, "Global message sent successfully"},
+		{"/msg bob hi bob", "private_message", []string{"bob", "hi bob"}, "✅ Private message to bob: delivered"},
+		{"/msg nobody hi", "private_message", []string{"nobody", "hi"}, "❌ Private message to nobody: rejected: no such user"},
+		{"/create guild builders", "create_room", []string{"guild", "builders"}, "✅ Room guild builders: created"},
+	}
+	for _, step := range steps {
+		before := len(srv.EventsNamed(step.event))
+		if r.handle(ctx, step.input) {
+			t.Fatalf("%q should not quit", step.input)
+		}
+		received, err := srv.WaitEvents(step.event, before+1, 5*time.Second)
+		if err != nil {
+			t.Fatalf("%q: %v", step.input, err)
+		}
+		e := received[before]
+		for i, arg := range step.args {
+			if e.StringArg(i) != arg {
+				t.Errorf("%q: argument %d of %s = %q; expected %q", step.input, i, step.event, e.StringArg(i), arg)
+			}
+		}
+		if step.expected != "" && !socketiotest.WaitUntil(5*time.Second, func() bool { return strings.Contains(out.String(), step.expected) }) {
+			t.Errorf("%q: expected %q in the output:\n%s", step.input, step.expected, out.String())
+		}
+	}
+
+	if !r.handle(ctx, "/quit") {
+		t.Error("/quit should end the input loop")
+	}
+}
@@ -0,0 +1,179 @@
+// reconnect.go
+package server_connection
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/jonipwi/go-chat-client/auth"
+	"github.com/jonipwi/go-chat-client/config"
+	"github.com/jonipwi/go-chat-client/events"
+	"github.com/jonipwi/go-chat-client/state"
+	"github.com/jonipwi/go-chat-client/utils"
+)
+
+// ReconnectPolicy controls how the supervisor spaces out reconnect attempts
+type ReconnectPolicy struct {
+	InitialDelay  time.Duration // Delay before the first attempt
+	MaxDelay      time.Duration // Upper bound for any single delay
+	Multiplier    float64       // Growth factor applied per failed attempt
+	Jitter        float64       // Fraction (0-1) of the delay that is randomised
+	MaxAttempts   int           // Attempts per outage, 0 means retry forever
+	CheckInterval time.Duration // How often the connection status is polled
+}
+
+// DefaultReconnectPolicy returns the policy used by the interactive client
+func DefaultReconnectPolicy() ReconnectPolicy {
+	return ReconnectPolicy{
+		InitialDelay:  1 * time.Second,
+		MaxDelay:      1 * time.Minute,
+		Multiplier:    2,
+		Jitter:        0.2,
+		CheckInterval: 5 * time.Second,
+	}
+}
+
+// Backoff returns the delay before the given attempt (starting at 0).
+// random must return a value in [0, 1) and is used to apply the jitter.
+func (p ReconnectPolicy) Backoff(attempt int, random func() float64) time.Duration {
+	delay := float64(p.InitialDelay) * math.Pow(p.Multiplier, float64(attempt))
+	if delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+
+	// Spread the delay over [delay*(1-jitter), delay*(1+jitter)]
+	delay *= 1 - p.Jitter + 2*p.Jitter*random()
+	if delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	return time.Duration(delay)
+}
+
+// Supervisor re-establishes the server connection whenever it is lost
+type Supervisor struct {
+	cfg         config.Config
+	clientState *state.ClientState
+	tokens      *auth.Source
+	router      *events.Router
+	policy      ReconnectPolicy
+	random      func() float64
+	sleep       func(context.Context, time.Duration) bool
+}
+
+// NewSupervisor creates a reconnection supervisor for the given server.
+// tokens authenticates each new connection and may be nil.
+func NewSupervisor(cfg config.Config, clientState *state.ClientState, router *events.Router, tokens *auth.Source, policy ReconnectPolicy) *Supervisor {
+	return &Supervisor{
+		cfg:         cfg,
+		clientState: clientState,
+		tokens:      tokens,
+		router:      router,
+		policy:      policy,
+		random:      rand.Float64,
+		sleep:       utils.Sleep,
+	}
+}
+
+// Run watches the connection and reconnects on disconnects or stale heartbeats
+// until ctx is done. Reconnects are requested through ClientState.RequestReconnect;
+// the connection status is also polled in case a disconnect went unnoticed.
+func (s *Supervisor) Run(ctx context.Context) {
+	logger.Info("Starting reconnection supervisor")
+	defer logger.Info("Stopped reconnection supervisor")
+	ticker := time.NewTicker(s.policy.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case reason := <-s.clientState.ReconnectRequests():
+			s.reconnect(ctx, reason)
+		case <-ticker.C:
+			// A nil client means the connection was closed on purpose
+			if s.clientState.Client() != nil && !s.clientState.IsConnected() {
+				s.reconnect(ctx, "connection lost")
+			}
+		}
+	}
+}
+
+// reconnect retries with backoff until a connection is made, the policy
+// gives up or ctx is done
+func (s *Supervisor) reconnect(ctx context.Context, reason string) {
+	logger.Info("Reconnecting", "reason", reason)
+	// Tear the old connection down first, a stale heartbeat does not mean it
+	// is closed and its events would otherwise be handled twice
+	if old := s.clientState.Client(); old != nil {
+		s.router.Detach(old)
+	}
+	s.clientState.Hangup()
+	serverURL := ServerURL(s.cfg)
+	// The TLS files are read again so renewed certificates are picked up
+	transport, err := NewTransport(s.cfg.TLS)
+	if err != nil {
+		logger.Error("Cannot reconnect", "error", err)
+		s.clientState.AddConnectionError(fmt.Sprintf("Reconnect failed, error configuring TLS: %v", err))
+		return
+	}
+
+	for attempt := 0; s.policy.MaxAttempts == 0 || attempt < s.policy.MaxAttempts; attempt++ {
+		delay := s.policy.Backoff(attempt, s.random)
+		logger.Info("Scheduling reconnection attempt", "attempt", attempt+1, "delay", delay.Round(time.Millisecond))
+		if !s.sleep(ctx, delay) {
+			return
+		}
+
+		s.clientState.SetLastReconnectAttempt(time.Now())
+		c, conn, err := dial(transport, serverURL, s.clientState, s.tokens)
+		if err != nil {
+			logger.Warn("Reconnection attempt failed", "attempt", attempt+1, "error", err)
+			recordDialError(s.clientState, s.tokens, fmt.Sprintf("Reconnect attempt %d failed", attempt+1), err)
+			continue
+		}
+
+		// The client may have shut down while the dial was under way
+		if ctx.Err() != nil {
+			conn.Close()
+			return
+		}
+		attach(c, conn, s.clientState, s.router)
+		s.clientState.TrackReconnect()
+		logger.Info("Reconnected", "attempts", attempt+1)
+
+		report := RestoreSession(ctx, s.clientState)
+		if len(report.Failed) > 0 || report.IdentityErr != nil {
+			logger.Warn("Session only partially restored", "report", report.String())
+		} else {
+			logger.Info("Session restored", "report", report.String())
+		}
+
+		if pending := s.clientState.Outbox().Len(); pending > 0 {
+			sent, err := s.clientState.FlushOutbox()
+			if err != nil {
+				logger.Error("Failed to flush outbox", "sent", sent, "queued", pending, "error", err)
+			} else {
+				logger.Info("Flushed outbox", "sent", sent)
+			}
+		}
+		s.drainRequests()
+		return
+	}
+
+	logger.Error("Giving up reconnecting", "attempts", s.policy.MaxAttempts)
+	s.clientState.AddConnectionError(fmt.Sprintf("Reconnect gave up after %d attempts", s.policy.MaxAttempts))
+}
+
+// drainRequests discards reconnect requests raised by the connection that was just replaced
+func (s *Supervisor) drainRequests() {
+	for {
+		select {
+		case <-s.clientState.ReconnectRequests():
+		default:
+			return
+		}
+	}
+}
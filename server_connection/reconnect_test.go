@@ -0,0 +1,57 @@
+package server_connection
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReconnectPolicyBackoff(t *testing.T) {
+	policy := ReconnectPolicy{
+		InitialDelay: 1 * time.Second,
+		MaxDelay:     30 * time.Second,
+		Multiplier:   2,
+		Jitter:       0.5,
+	}
+	middle := func() float64 { return 0.5 }
+
+	tests := []struct {
+		attempt  int
+		expected time.Duration
+	}{
+		{0, 1 * time.Second},
+		{1, 2 * time.Second},
+		{4, 16 * time.Second},
+		{5, 30 * time.Second}, // Capped
+		{50, 30 * time.Second},
+	}
+
+	for _, test := range tests {
+		result := policy.Backoff(test.attempt, middle)
+		if result != test.expected {
+			t.Errorf("Backoff(%d) = %v; expected %v", test.attempt, result, test.expected)
+		}
+	}
+}
+
+func TestReconnectPolicyJitter(t *testing.T) {
+	policy := ReconnectPolicy{
+		InitialDelay: 10 * time.Second,
+		MaxDelay:     time.Minute,
+		Multiplier:   2,
+		Jitter:       0.2,
+	}
+
+	low := policy.Backoff(0, func() float64 { return 0 })
+	high := policy.Backoff(0, func() float64 { return 0.999999 })
+	if low != 8*time.Second {
+		t.Errorf("Expected lowest jittered delay to be 8s, got %v", low)
+	}
+	if high <= low || high > 12*time.Second {
+		t.Errorf("Expected highest jittered delay in (8s, 12s], got %v", high)
+	}
+
+	capped := policy.Backoff(10, func() float64 { return 0.999999 })
+	if capped > policy.MaxDelay {
+		t.Errorf("Expected jittered delay to stay within MaxDelay, got %v", capped)
+	}
+}
@@ -2,159 +2,195 @@
 package server_connection
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"net"
+	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/jonipwi/go-chat-client/auth"
+	"github.com/jonipwi/go-chat-client/config"
+	"github.com/jonipwi/go-chat-client/events"
 	"github.com/jonipwi/go-chat-client/state"
+	"github.com/jonipwi/go-chat-client/utils"
 	socketio_client "github.com/zhouhui8915/go-socket.io-client"
 )
 
-// ConnectToServer connects to the server
-func ConnectToServer(host string, port int, clientState *state.ClientState) (*socketio_client.Client, error) {
-	serverURL := fmt.Sprintf("http://%s:%d/socket.io/", host, port)
-	log.Printf("CONNECTION: Connecting to server at %s", serverURL)
+// Loggers of the connection and the heartbeat
+var (
+	logger          = utils.Log(utils.ComponentConnection)
+	heartbeatLogger = utils.Log(utils.ComponentHeartbeat)
+)
 
-	opts := &socketio_client.Options{
-		Transport: "websocket",
-		Query:     make(map[string]string),
+// ServerURL builds the Socket.IO endpoint URL for the configured server.
+// The socket.io client upgrades https to wss for the websocket transport.
+func ServerURL(cfg config.Config) string {
+	scheme := "http"
+	if cfg.TLS.Enabled {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s/socket.io/", scheme, net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)))
+}
+
+// ConnectToServer connects to the configured server, retrying up to
+// cfg.ConnectRetries times, and attaches router to the new connection.
+// tokens authenticates the handshake and may be nil. Retries stop when ctx
+// is done; an attempt already under way is not interrupted.
+func ConnectToServer(ctx context.Context, cfg config.Config, clientState *state.ClientState, router *events.Router, tokens *auth.Source) (*socketio_client.Client, error) {
+	serverURL := ServerURL(cfg)
+	logger.Info("Connecting to server", "url", serverURL)
+
+	transport, err := NewTransport(cfg.TLS)
+	if err != nil {
+		return nil, fmt.Errorf("error configuring TLS: %w", err)
 	}
-	opts.Query["username"] = clientState.GetUsername()
 
 	var c *socketio_client.Client
-	var err error
-	maxRetries := 3
+	var conn *Conn
+	maxRetries := cfg.ConnectRetries
 	for i := 0; i < maxRetries; i++ {
-		c, err = socketio_client.NewClient(serverURL, opts)
+		c, conn, err = dial(transport, serverURL, clientState, tokens)
 		if err == nil {
 			break
 		}
-		log.Printf("CONNECTION ERROR: Attempt %d/%d failed: %v", i+1, maxRetries, err)
-		if i < maxRetries-1 {
-			time.Sleep(time.Second * 2)
+		logger.Warn("Connection attempt failed", "attempt", i+1, "max_attempts", maxRetries, "error", err)
+		recordDialError(clientState, tokens, fmt.Sprintf("Connection attempt %d failed", i+1), err)
+		if i < maxRetries-1 && !utils.Sleep(ctx, time.Second*2) {
+			return nil, ctx.Err()
 		}
 	}
 
 	if err != nil {
-		log.Printf("CONNECTION ERROR: Failed to create client after %d attempts: %v", maxRetries, err)
+		logger.Error("Failed to create client", "attempts", maxRetries, "error", err)
 		return nil, fmt.Errorf("error creating client: %w", err)
 	}
 
-	// Setup event handlers
-	c.On("connect", func(msg string) {
-		log.Printf("CONNECTION: Connected with client ID: %s", msg)
-		clientState.SetClientID(msg)
-		clientState.SetConnected(true)
-	})
-
-	c.On("disconnect", func() {
-		log.Println("CONNECTION: Disconnected from server")
-		clientState.SetConnected(false)
-	})
-
-	c.On("chat message", func(msg string) {
-		log.Printf("CHAT: %s", msg)
-		clientState.TrackMessageReceived()
-	})
-
-	c.On("message", func(msg string) {
-		log.Printf("SERVER MESSAGE: %s", msg)
-		clientState.TrackMessageReceived()
-	})
-
-	c.On("heartbeat", func(data map[string]interface{}) {
-		log.Printf("HEARTBEAT: Received server heartbeat: %v", data)
-		clientState.TrackHeartbeatReceived()
-	})
-
-	c.On("room joined", func(roomID string) {
-		log.Printf("ROOM: Joined room %s", roomID)
-		clientState.SetCurrentRoom(roomID)
-	})
-
-	c.On("private message", func(sender string, msg string) {
-		log.Printf("PRIVATE: From %s: %s", sender, msg)
-		clientState.TrackMessageReceived()
-	})
-
-	c.On("user joined", func(username string) {
-		log.Printf("ROOM: User %s joined", username)
-	})
-
-	c.On("user left", func(username string) {
-		log.Printf("ROOM: User %s left", username)
-	})
-
-	c.On("typing", func(username string) {
-		log.Printf("TYPING: %s is typing...", username)
-	})
-
-	c.On("stop typing", func(username string) {
-		log.Printf("TYPING: %s stopped typing", username)
-	})
-
-	log.Println("CONNECTION: Client connected successfully")
+	if ctx.Err() != nil {
+		conn.Close()
+		return nil, ctx.Err()
+	}
+	attach(c, conn, clientState, router)
+
+	logger.Info("Client connected")
 	return c, nil
 }
 
-// StartHeartbeat starts a custom heartbeat mechanism
-func StartHeartbeat(clientState *state.ClientState) {
-	log.Println("HEARTBEAT: Starting custom heartbeat mechanism")
-	ticker := time.NewTicker(20 * time.Second)
+// dial makes a single attempt to open a Socket.IO connection over transport
+func dial(transport *Transport, serverURL string, clientState *state.ClientState, tokens *auth.Source) (*socketio_client.Client, *Conn, error) {
+	opts := &socketio_client.Options{
+		Transport: "websocket",
+		Query:     make(map[string]string),
+		Header:    make(http.Header),
+	}
+	opts.Query["username"] = clientState.GetUsername()
+	if tokens != nil {
+		if err := tokens.Apply(opts.Header, opts.Query); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return transport.dial(serverURL, opts, tokens != nil)
+}
+
+// recordDialError adds a failed connection attempt to the error history.
+// Rejected credentials are recorded as auth errors and the cached token is
+// dropped so the next attempt fetches a new one.
+func recordDialError(clientState *state.ClientState, tokens *auth.Source, what string, err error) {
+	if errors.Is(err, auth.ErrRejected) {
+		clientState.AddAuthError(fmt.Sprintf("%s: %v", what, err))
+		if tokens != nil {
+			tokens.Invalidate()
+		}
+		return
+	}
+	clientState.AddConnectionError(fmt.Sprintf("%s: %v", what, err))
+}
+
+// attach makes c the active client, marks the state connected and lets the router handle its events
+func attach(c *socketio_client.Client, conn *Conn, clientState *state.ClientState, router *events.Router) {
+	clientState.SetClient(c, conn)
+	clientState.SetConnected(true)
+	router.Attach(c)
+}
+
+// heartbeatStaleAfter is how long the server may stay silent before the connection is considered dead
+const heartbeatStaleAfter = 2 * time.Minute
+
+// StartHeartbeat sends a heartbeat every interval until ctx is done
+func StartHeartbeat(ctx context.Context, clientState *state.ClientState, interval time.Duration) {
+	heartbeatLogger.Info("Starting custom heartbeat mechanism", "interval", interval)
+	defer heartbeatLogger.Info("Stopped heartbeat")
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
-		<-ticker.C
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 		if clientState.IsConnected() && clientState.Client() != nil {
-			lastHeartbeat := clientState.GetLastActivity()
+			lastHeartbeat := clientState.GetLastServerActivity()
 			timeSinceLastHeartbeat := time.Since(lastHeartbeat)
 
 			// Check if ClientID is set before sending heartbeat
 			clientID := clientState.GetClientID()
 			if clientID == "" {
-				log.Println("HEARTBEAT: Skipping heartbeat - no client ID set yet")
+				heartbeatLogger.Debug("Skipping heartbeat, no client ID set yet")
 				continue
 			}
 
-			log.Printf("HEARTBEAT: Sending heartbeat... (Time since last server response: %v)",
-				timeSinceLastHeartbeat.Round(time.Second))
+			heartbeatLogger.Debug("Sending heartbeat",
+				"since_server_activity", timeSinceLastHeartbeat.Round(time.Second),
+				"last_rtt", clientState.Latency().Stats().Last)
 
 			// Fixed: Send single string parameter instead of array
 			heartbeatMsg := fmt.Sprintf("Heartbeat from %s at %s",
 				clientID,
 				time.Now().Format(time.RFC3339))
 
-			err := clientState.Client().Emit("client_heartbeat", heartbeatMsg)
+			// The probe is echoed back in the server's heartbeat to measure the round trip
+			probe := clientState.Latency().Start(state.ProbeHeartbeat)
+			err := clientState.Client().Emit("client_heartbeat", heartbeatMsg, probe.Payload())
 
 			if err != nil {
-				log.Printf("HEARTBEAT ERROR: Failed to send heartbeat: %v", err)
+				clientState.Latency().Cancel(probe)
+				clientState.TrackEmitFailure("client_heartbeat")
+				heartbeatLogger.Error("Failed to send heartbeat", "error", err)
 				clientState.AddConnectionError(fmt.Sprintf("Heartbeat send failed: %v", err))
 				continue
 			}
 
 			clientState.TrackHeartbeatSent()
 
-			if timeSinceLastHeartbeat > 2*time.Minute {
-				log.Printf("HEARTBEAT WARNING: No server response in %v!",
-					timeSinceLastHeartbeat.Round(time.Second))
+			if timeSinceLastHeartbeat > heartbeatStaleAfter {
+				heartbeatLogger.Warn("No server response",
+					"since_server_activity", timeSinceLastHeartbeat.Round(time.Second))
 				clientState.AddConnectionError(fmt.Sprintf("No heartbeat response in %v",
 					timeSinceLastHeartbeat.Round(time.Second)))
+				clientState.RequestReconnect("heartbeat stale")
 			}
 		} else {
-			log.Println("HEARTBEAT: Skipping heartbeat - not connected")
+			heartbeatLogger.Debug("Skipping heartbeat, not connected")
 		}
 	}
 }
 
-// ReportStats reports client stats periodically
-func ReportStats(clientState *state.ClientState) {
-	log.Println("STATS: Starting periodic stats reporting")
-	ticker := time.NewTicker(1 * time.Minute)
+// ReportStats logs the client stats every interval until ctx is done
+func ReportStats(ctx context.Context, clientState *state.ClientState, interval time.Duration) {
+	logger.Info("Starting periodic stats reporting", "interval", interval)
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
-		<-ticker.C
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 		stats := clientState.GetStats()
-		log.Printf("CLIENT STATS: %s", stats)
+		logger.Info("Client stats", "stats", stats)
 	}
 }
@@ -0,0 +1,347 @@
+package server_connection
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jonipwi/go-chat-client/auth"
+	"github.com/jonipwi/go-chat-client/config"
+	"github.com/jonipwi/go-chat-client/events"
+	"github.com/jonipwi/go-chat-client/socketiotest"
+	"github.com/jonipwi/go-chat-client/state"
+)
+
+func TestDialReportsRejectedHandshake(t *testing.T) {
+	var authorization string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		http.Error(w, "token expired", http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	clientState := state.NewClientState("testuser")
+	tokens := auth.NewSource(auth.StaticToken("stale"), config.SendAsHeader, time.Minute)
+
+	_, _, err := dial(&Transport{}, srv.URL+"/socket.io/", clientState, tokens)
+	if !errors.Is(err, auth.ErrRejected) {
+		t.Fatalf("Expected the handshake to fail with ErrRejected, got %v", err)
+	}
+	if authorization != "Bearer stale" {
+		t.Errorf("Expected the token in the handshake header, got %q", authorization)
+	}
+
+	recordDialError(clientState, tokens, "Connection attempt 1 failed", err)
+	recordDialError(clientState, tokens, "Connection attempt 2 failed", errors.New("connection refused"))
+
+	errs := clientState.GetConnectionErrors()
+	if len(errs) != 2 || !strings.Contains(errs[0], "AUTH REJECTED") || strings.Contains(errs[1], "AUTH") {
+		t.Errorf("Expected one auth error followed by one network error, got %v", errs)
+	}
+	if stats := clientState.Snapshot(); stats.AuthErrors != 1 || stats.ConnectionErrors != 2 {
+		t.Errorf("Unexpected error counts: auth %d, total %d", stats.AuthErrors, stats.ConnectionErrors)
+	}
+}
+
+// connectTo connects clientState to srv and returns the server side of the connection
+func connectTo(t *testing.T, srv *socketiotest.Server, clientState *state.ClientState, router *events.Router) *socketiotest.Conn {
+	t.Helper()
+	cfg := config.Default()
+	srv.Configure(&cfg)
+	cfg.ConnectRetries = 1
+	if _, err := ConnectToServer(context.Background(), cfg, clientState, router, nil); err != nil {
+		t.Fatalf("ConnectToServer() error: %v", err)
+	}
+	t.Cleanup(clientState.CloseConnection)
+
+	conns, err := srv.WaitConns(1, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conns[len(conns)-1]
+}
+
+func TestHeartbeatRoundTrip(t *testing.T) {
+	srv := socketiotest.NewServer()
+	defer srv.Close()
+	// Echo the probe back like the chat server does
+	srv.Handle("client_heartbeat", func(c *socketiotest.Conn, e socketiotest.Event) []interface{} {
+		var probe map[string]interface{}
+		e.DecodeArg(1, &probe)
+		c.Emit("heartbeat", "Heartbeat from server", probe)
+		return nil
+	})
+
+	clientState := state.NewClientState("testuser")
+	conn := connectTo(t, srv, clientState, events.NewRouter(clientState))
+	conn.Emit("connect", conn.ID())
+	if !socketiotest.WaitUntil(5*time.Second, func() bool { return clientState.GetClientID() == conn.ID() }) {
+		t.Fatalf("Client ID = %q; expected the one sent by the server", clientState.GetClientID())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go StartHeartbeat(ctx, clientState, 20*time.Millisecond)
+
+	heartbeats, err := srv.WaitEvents("client_heartbeat", 3, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(heartbeats[0].StringArg(0), conn.ID()) {
+		t.Errorf("Heartbeat %q should name the client ID %s", heartbeats[0].StringArg(0), conn.ID())
+	}
+	if !socketiotest.WaitUntil(5*time.Second, func() bool { return clientState.Latency().Stats().Samples >= 3 }) {
+		t.Fatalf("Expected the echoed heartbeats to be measured, got %+v", clientState.Latency().Stats())
+	}
+	if stats := clientState.Snapshot(); stats.HeartbeatsReceived < 3 {
+		t.Errorf("Received %d heartbeats; expected at least 3", stats.HeartbeatsReceived)
+	}
+}
+
+func TestHeartbeatWithoutProbeEcho(t *testing.T) {
+	srv := socketiotest.NewServer()
+	defer srv.Close()
+	// Answer like a server that knows nothing of probes
+	srv.Handle("client_heartbeat", func(c *socketiotest.Conn, e socketiotest.Event) []interface{} {
+		c.Emit("heartbeat", "Heartbeat from server")
+		return nil
+	})
+
+	clientState := state.NewClientState("testuser")
+	conn := connectTo(t, srv, clientState, events.NewRouter(clientState))
+	conn.Emit("connect", conn.ID())
+	if !socketiotest.WaitUntil(5*time.Second, func() bool { return clientState.GetClientID() == conn.ID() }) {
+		t.Fatalf("Client ID = %q; expected the one sent by the server", clientState.GetClientID())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go StartHeartbeat(ctx, clientState, 50*time.Millisecond)
+
+	if !socketiotest.WaitUntil(5*time.Second, func() bool { return clientState.Latency().Stats().Samples >= 3 }) {
+		t.Fatalf("Expected the heartbeats to be measured, got %+v", clientState.Latency().Stats())
+	}
+	if lost := clientState.Latency().Stats().Lost; lost != 0 {
+		t.Errorf("Counted %d heartbeats lost; expected none", lost)
+	}
+}
+
+func TestSupervisorReconnectsAfterDrop(t *testing.T) {
+	srv := socketiotest.NewServer()
+	defer srv.Close()
+
+	cfg := config.Default()
+	srv.Configure(&cfg)
+	clientState := state.NewClientState("testuser")
+	router := events.NewRouter(clientState)
+	connectTo(t, srv, clientState, router)
+
+	req, err := clientState.JoinRoom("room-1")
+	if err != nil {
+		t.Fatalf("JoinRoom() error: %v", err)
+	}
+	if result := req.Wait(); result.Status != state.RequestAcked {
+		t.Fatalf("join_room: %+v; expected it to be acknowledged", result)
+	}
+
+	supervisor := NewSupervisor(cfg, clientState, router, nil, ReconnectPolicy{
+		InitialDelay:  10 * time.Millisecond,
+		MaxDelay:      50 * time.Millisecond,
+		Multiplier:    2,
+		CheckInterval: time.Second,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go supervisor.Run(ctx)
+
+	// Keep the server down until a message has been queued
+	srv.RejectHandshakes(http.StatusServiceUnavailable)
+	srv.DropAll()
+	if !socketiotest.WaitUntil(5*time.Second, func() bool { return !clientState.IsConnected() }) {
+		t.Fatal("Expected the client to notice the dropped connection")
+	}
+	if queued, err := clientState.Send("global_message", "sent while offline"); err != nil || !queued {
+		t.Fatalf("Send() = %v, %v; expected the message to be queued", queued, err)
+	}
+	srv.RejectHandshakes(0)
+
+	conns, err := srv.WaitConns(2, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	joins, err := srv.WaitEvents("join_room", 2, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if joins[1].Conn != conns[1] || joins[1].StringArg(0) != "room-1" {
+		t.Errorf("Expected room-1 to be rejoined on the new connection, got %q on %s", joins[1].StringArg(0), joins[1].Conn.ID())
+	}
+	flushed, err := srv.WaitEvent("global_message", 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flushed.Conn != conns[1] || flushed.StringArg(0) != "sent while offline" {
+		t.Errorf("Expected the queued message on the new connection, got %q", flushed.StringArg(0))
+	}
+
+	stats := clientState.Snapshot()
+	if !stats.Connected || stats.Reconnects != 1 || stats.QueuedMessages != 0 {
+		t.Errorf("After reconnecting: connected %v, %d reconnects, %d queued; expected connected, 1, 0",
+			stats.Connected, stats.Reconnects, stats.QueuedMessages)
+	}
+}
+
+func TestSupervisorReplacesLiveConnection(t *testing.T) {
+	srv := socketiotest.NewServer()
+	defer srv.Close()
+
+	cfg := config.Default()
+	srv.Configure(&cfg)
+	clientState := state.NewClientState("testuser")
+	router := events.NewRouter(clientState)
+	old := connectTo(t, srv, clientState, router)
+
+	supervisor := NewSupervisor(cfg, clientState, router, nil, ReconnectPolicy{
+		InitialDelay:  10 * time.Millisecond,
+		MaxDelay:      50 * time.Millisecond,
+		Multiplier:    2,
+		CheckInterval: time.Second,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go supervisor.Run(ctx)
+
+	// A stale heartbeat asks for a reconnect while the old connection is still open
+	clientState.RequestReconnect("heartbeat stale")
+	conns, err := srv.WaitConns(2, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-old.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the old connection to be closed")
+	}
+	if !socketiotest.WaitUntil(5*time.Second, clientState.IsConnected) {
+		t.Fatal("Expected the client to be connected again")
+	}
+
+	// A message pushed on both connections is only handled once, from the new one
+	var received []string
+	var mu sync.Mutex
+	router.Subscribe(func(e events.Event) {
+		if e.Message != nil {
+			mu.Lock()
+			received = append(received, e.Message.Content)
+			mu.Unlock()
+		}
+	})
+	old.Emit("chat message", "bob", "from the old connection")
+	conns[1].Emit("chat message", "bob", "from the new connection")
+	if !socketiotest.WaitUntil(5*time.Second, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(received) > 0
+	}) {
+		t.Fatal("Timed out waiting for the message")
+	}
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 1 || received[0] != "from the new connection" {
+		t.Errorf("Received %q; expected only the message from the new connection", received)
+	}
+	if n := clientState.Snapshot().MessagesReceived; n != 1 {
+		t.Errorf("Counted %d messages received; expected 1", n)
+	}
+}
+
+func TestSupervisorStopsDuringDial(t *testing.T) {
+	srv := socketiotest.NewServer()
+	defer srv.Close()
+
+	cfg := config.Default()
+	srv.Configure(&cfg)
+	clientState := state.NewClientState("testuser")
+	router := events.NewRouter(clientState)
+	connectTo(t, srv, clientState, router)
+	clientState.AddJoinedRoom("room-1")
+
+	supervisor := NewSupervisor(cfg, clientState, router, nil, ReconnectPolicy{
+		InitialDelay:  10 * time.Millisecond,
+		MaxDelay:      50 * time.Millisecond,
+		Multiplier:    2,
+		CheckInterval: time.Second,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stopped := make(chan struct{})
+	go func() {
+		supervisor.Run(ctx)
+		close(stopped)
+	}()
+
+	// Shut down like chatclient does while the reconnect is dialing
+	release := srv.HoldHandshakes()
+	defer release()
+	clientState.RequestReconnect("heartbeat stale")
+	if !socketiotest.WaitUntil(5*time.Second, func() bool { return !clientState.Snapshot().LastReconnectAttempt.IsZero() }) {
+		t.Fatal("Expected a reconnect attempt")
+	}
+	cancel()
+	clientState.CloseConnection()
+	release()
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the supervisor to stop")
+	}
+	if clientState.Client() != nil || clientState.IsConnected() {
+		t.Error("Expected no connection to be attached after shutting down")
+	}
+	for _, conn := range srv.Conns() {
+		select {
+		case <-conn.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected connection %s to be closed", conn.ID())
+		}
+	}
+	if joins := srv.EventsNamed("join_room"); len(joins) != 0 {
+		t.Errorf("Expected no rooms to be rejoined after shutting down, got %d join_room events", len(joins))
+	}
+}
+
+func TestRestoreSessionWaitsForAcks(t *testing.T) {
+	srv := socketiotest.NewServer()
+	defer srv.Close()
+	srv.Handle("join_room", func(c *socketiotest.Conn, e socketiotest.Event) []interface{} {
+		if e.StringArg(0) == "full" {
+			return socketiotest.Reject("room is full")
+		}
+		return socketiotest.Ack(nil)
+	})
+
+	clientState := state.NewClientState("testuser")
+	connectTo(t, srv, clientState, events.NewRouter(clientState))
+	for _, room := range []string{"room-1", "full"} {
+		clientState.AddJoinedRoom(room)
+	}
+	clientState.SetCurrentRoom("full")
+
+	report := RestoreSession(context.Background(), clientState)
+	if len(report.Rejoined) != 1 || report.Rejoined[0] != "room-1" {
+		t.Errorf("Rejoined %v; expected only room-1", report.Rejoined)
+	}
+	if err := report.Failed["full"]; err == nil || !strings.Contains(err.Error(), "room is full") {
+		t.Errorf("Failed = %v; expected full to be rejected", report.Failed)
+	}
+	if report.ActiveRoom != "" || clientState.IsInRoom("full") {
+		t.Errorf("Expected the rejected room to be left, active room %q, joined %v", report.ActiveRoom, clientState.GetJoinedRooms())
+	}
+}
@@ -0,0 +1,122 @@
+// session.go
+package server_connection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jonipwi/go-chat-client/state"
+)
+
+// RejoinReport summarises how a session was restored after a reconnect
+type RejoinReport struct {
+	IdentityErr error            // Set if the username could not be replayed
+	Rejoined    []string         // Rooms that were joined again
+	Failed      map[string]error // Rooms that could not be rejoined
+	ActiveRoom  string           // The room that is active after the restore
+}
+
+// String returns a one-line description of the report
+func (r RejoinReport) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "rejoined %d room(s)", len(r.Rejoined))
+	if len(r.Failed) > 0 {
+		failed := make([]string, 0, len(r.Failed))
+		for room, err := range r.Failed {
+			failed = append(failed, fmt.Sprintf("%s (%v)", room, err))
+		}
+		fmt.Fprintf(&sb, ", failed: %s", strings.Join(failed, ", "))
+	}
+	if r.IdentityErr != nil {
+		fmt.Fprintf(&sb, ", username not restored: %v", r.IdentityErr)
+	}
+	if r.ActiveRoom != "" {
+		fmt.Fprintf(&sb, ", active room: %s", r.ActiveRoom)
+	}
+	return sb.String()
+}
+
+// RestoreSession replays the username and every joined room on the current
+// client. The active room is joined last so the server's "room joined" reply
+// leaves it selected. A room counts as rejoined once the server acknowledges
+// the join; rooms the server rejects are left, and rooms whose join fails or
+// is not answered before the request times out or ctx is done are kept for
+// the next reconnect. Failed rejoins are also recorded as connection errors.
+func RestoreSession(ctx context.Context, clientState *state.ClientState) RejoinReport {
+	report := RejoinReport{Failed: make(map[string]error)}
+	client := clientState.Client()
+	if client == nil {
+		report.IdentityErr = fmt.Errorf("no client")
+		return report
+	}
+
+	username := clientState.GetUsername()
+	if err := client.Emit("username_change", username); err != nil {
+		report.IdentityErr = err
+		clientState.TrackEmitFailure("username_change")
+		clientState.AddConnectionError(fmt.Sprintf("Restoring username %s failed: %v", username, err))
+	}
+
+	activeRoom := clientState.GetCurrentRoom()
+	rooms := clientState.GetJoinedRooms()
+	ordered := make([]string, 0, len(rooms))
+	for _, room := range rooms {
+		if room != activeRoom {
+			ordered = append(ordered, room)
+		}
+	}
+	for _, room := range rooms {
+		if room == activeRoom {
+			ordered = append(ordered, room)
+		}
+	}
+
+	// Send every join before waiting, the acknowledgements arrive in any order
+	requests := make(map[string]*state.Request, len(ordered))
+	for _, room := range ordered {
+		req, err := clientState.Request("join_room", room)
+		if err != nil {
+			report.Failed[room] = err
+			continue
+		}
+		requests[room] = req
+	}
+	for _, room := range ordered {
+		req, ok := requests[room]
+		if !ok {
+			continue
+		}
+		select {
+		case <-req.Done():
+		case <-ctx.Done():
+			report.Failed[room] = ctx.Err()
+			continue
+		}
+		switch result := req.Wait(); result.Status {
+		case state.RequestAcked:
+			report.Rejoined = append(report.Rejoined, room)
+		case state.RequestRejected:
+			report.Failed[room] = fmt.Errorf("rejected: %s", result.Error)
+			clientState.RemoveJoinedRoom(room)
+		default:
+			report.Failed[room] = errors.New(string(result.Status))
+		}
+	}
+	for _, room := range ordered {
+		if err, failed := report.Failed[room]; failed {
+			clientState.AddConnectionError(fmt.Sprintf("Rejoining room %s failed: %v", room, err))
+		}
+	}
+
+	// Fall back to global chat rather than pointing at a room we are not in
+	if _, failed := report.Failed[activeRoom]; failed {
+		logger.Warn("Active room could not be rejoined, switching to global chat", "room", activeRoom)
+		activeRoom = ""
+	}
+	clientState.SetCurrentRoom(activeRoom)
+	report.ActiveRoom = activeRoom
+
+	return report
+}
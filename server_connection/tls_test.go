@@ -0,0 +1,186 @@
+package server_connection
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/jonipwi/go-chat-client/config"
+	socketio_client "github.com/zhouhui8915/go-socket.io-client"
+)
+
+// writePEM writes a PEM block to a file in a temporary directory
+func writePEM(t *testing.T, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newClientCert creates a self-signed client certificate and returns its files and parsed form
+func newClientCert(t *testing.T) (certFile, keyFile string, cert *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "go-chat-client test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err = x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writePEM(t, "client.pem", "CERTIFICATE", der), writePEM(t, "client-key.pem", "EC PRIVATE KEY", keyDER), cert
+}
+
+// get makes a request to url with the given TLS settings
+func get(t *testing.T, opts config.TLSConfig, url string) error {
+	t.Helper()
+	tlsConfig, err := BuildTLSConfig(opts)
+	if err != nil {
+		t.Fatalf("BuildTLSConfig returned %v", err)
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func okHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+}
+
+func TestBuildTLSConfigServerVerification(t *testing.T) {
+	srv := httptest.NewTLSServer(okHandler())
+	defer srv.Close()
+	caFile := writePEM(t, "ca.pem", "CERTIFICATE", srv.Certificate().Raw)
+
+	tests := []struct {
+		name    string
+		opts    config.TLSConfig
+		wantErr bool
+	}{
+		{"untrusted server", config.TLSConfig{Enabled: true}, true},
+		{"custom CA", config.TLSConfig{Enabled: true, CAFile: caFile}, false},
+		// The httptest certificate is issued for example.com
+		{"server name override", config.TLSConfig{Enabled: true, CAFile: caFile, ServerName: "example.com"}, false},
+		{"wrong server name", config.TLSConfig{Enabled: true, CAFile: caFile, ServerName: "staging.invalid"}, true},
+		{"insecure skip verify", config.TLSConfig{Enabled: true, InsecureSkipVerify: true}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := get(t, test.opts, srv.URL)
+			if (err != nil) != test.wantErr {
+				t.Errorf("GET error = %v; expected error: %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestBuildTLSConfigClientCertificate(t *testing.T) {
+	certFile, keyFile, cert := newClientCert(t)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(cert)
+
+	srv := httptest.NewUnstartedServer(okHandler())
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	srv.StartTLS()
+	defer srv.Close()
+	caFile := writePEM(t, "ca.pem", "CERTIFICATE", srv.Certificate().Raw)
+
+	if err := get(t, config.TLSConfig{Enabled: true, CAFile: caFile}, srv.URL); err == nil {
+		t.Error("Expected the server to reject a client without a certificate")
+	}
+	opts := config.TLSConfig{Enabled: true, CAFile: caFile, CertFile: certFile, KeyFile: keyFile}
+	if err := get(t, opts, srv.URL); err != nil {
+		t.Errorf("Expected the client certificate to be accepted, got %v", err)
+	}
+}
+
+func TestBuildTLSConfigErrors(t *testing.T) {
+	notPEM := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(notPEM, []byte("not a certificate"), 0600)
+
+	if _, err := BuildTLSConfig(config.TLSConfig{CAFile: notPEM}); err == nil {
+		t.Error("Expected a CA file without certificates to be rejected")
+	}
+	if _, err := BuildTLSConfig(config.TLSConfig{CertFile: notPEM, KeyFile: notPEM}); err == nil {
+		t.Error("Expected an invalid client certificate to be rejected")
+	}
+}
+
+func TestTransportUsesTLSConfig(t *testing.T) {
+	defaultClient, defaultDialer := http.DefaultClient, websocket.DefaultDialer
+
+	srv := httptest.NewTLSServer(okHandler())
+	defer srv.Close()
+	caFile := writePEM(t, "ca.pem", "CERTIFICATE", srv.Certificate().Raw)
+
+	transport, err := NewTransport(config.TLSConfig{Enabled: true, CAFile: caFile})
+	if err != nil {
+		t.Fatalf("NewTransport returned %v", err)
+	}
+	resp, err := transport.HTTPClient(time.Second).Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Expected the transport to trust the CA, got %v", err)
+	}
+	resp.Body.Close()
+
+	// The dial brings its own client and dialer, the process-wide ones are left alone
+	opts := &socketio_client.Options{}
+	if _, _, err := transport.dial(srv.URL+"/socket.io/", opts, false); err == nil {
+		t.Fatal("Expected the dial to fail against a plain HTTPS server")
+	}
+	if opts.HTTPClient == nil || opts.HTTPClient == http.DefaultClient || opts.Dialer == nil || opts.Dialer == websocket.DefaultDialer {
+		t.Error("Expected the dial to use a client and dialer of its own")
+	}
+	if http.DefaultClient != defaultClient || websocket.DefaultDialer != defaultDialer {
+		t.Error("Expected http.DefaultClient and websocket.DefaultDialer to be left alone")
+	}
+	if _, err := http.DefaultClient.Get(srv.URL); err == nil {
+		t.Error("Expected http.DefaultClient not to trust the CA")
+	}
+}
+
+func TestServerURL(t *testing.T) {
+	cfg := config.Default()
+	if url := ServerURL(cfg); url != "http://127.0.0.1:8000/socket.io/" {
+		t.Errorf("ServerURL = %q", url)
+	}
+	cfg.Host, cfg.Port, cfg.TLS.Enabled = "chat.example.com", 443, true
+	if url := ServerURL(cfg); url != "https://chat.example.com:443/socket.io/" {
+		t.Errorf("ServerURL = %q", url)
+	}
+}
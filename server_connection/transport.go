@@ -0,0 +1,141 @@
+// transport.go
+package server_connection
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/jonipwi/go-chat-client/auth"
+	"github.com/jonipwi/go-chat-client/config"
+	socketio_client "github.com/zhouhui8915/go-socket.io-client"
+)
+
+// handshakeTimeout bounds each request and the websocket upgrade of a handshake
+const handshakeTimeout = 45 * time.Second
+
+// Transport opens the connections to one server with its own TLS settings.
+// The zero Transport makes plain connections. Each connection gets an HTTP
+// client and a websocket dialer of its own; http.DefaultClient and
+// websocket.DefaultDialer are never used or changed.
+type Transport struct {
+	tlsConfig *tls.Config // Nil for plain connections
+}
+
+// NewTransport creates a transport for the given TLS settings, which are
+// ignored unless enabled
+func NewTransport(opts config.TLSConfig) (*Transport, error) {
+	if !opts.Enabled {
+		return &Transport{}, nil
+	}
+	tlsConfig, err := BuildTLSConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.InsecureSkipVerify {
+		logger.Warn("Certificate verification is disabled, do not use this outside local testing")
+	}
+	return &Transport{tlsConfig: tlsConfig}, nil
+}
+
+// HTTPClient returns a client for other requests to the server, such as
+// logging in, that uses the transport's TLS settings
+func (t *Transport) HTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{Transport: t.httpTransport(), Timeout: timeout}
+}
+
+// httpTransport returns a new HTTP transport with the TLS settings
+func (t *Transport) httpTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = t.tlsConfig
+	return transport
+}
+
+// dial opens a socket.io connection with a client and dialer of its own,
+// and returns it with the Conn that closes it. With detectRejections, a
+// handshake answered with 401 or 403 fails with auth.ErrRejected.
+func (t *Transport) dial(serverURL string, opts *socketio_client.Options, detectRejections bool) (*socketio_client.Client, *Conn, error) {
+	conn := &Conn{sockets: make(map[net.Conn]struct{})}
+	netDialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+
+	httpTransport := t.httpTransport()
+	httpTransport.DialContext = conn.track(netDialer.DialContext)
+	var roundTripper http.RoundTripper = httpTransport
+	if detectRejections {
+		roundTripper = auth.DetectRejections(roundTripper)
+	}
+	client := &http.Client{Transport: roundTripper, Timeout: handshakeTimeout}
+	dialer := &websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: handshakeTimeout,
+		TLSClientConfig:  t.tlsConfig,
+		NetDialContext:   conn.track(netDialer.DialContext),
+	}
+	opts.HTTPClient, opts.Dialer = client, dialer
+
+	c, err := socketio_client.NewClient(serverURL, opts)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return c, conn, nil
+}
+
+// Conn is the network side of one socket.io connection. The socket.io
+// client has no Close; closing its Conn closes the sockets under it instead,
+// which stops the client's goroutines and raises its "disconnection" event.
+type Conn struct {
+	mu      sync.Mutex
+	sockets map[net.Conn]struct{}
+	closed  bool
+}
+
+// track wraps dial so every socket it opens belongs to c
+func (c *Conn) track(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		socket, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.closed {
+			socket.Close()
+			return nil, net.ErrClosed
+		}
+		c.sockets[socket] = struct{}{}
+		return &trackedSocket{Conn: socket, owner: c}, nil
+	}
+}
+
+// Close closes every socket of the connection. It is safe to call more than once.
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	sockets := c.sockets
+	c.sockets = nil
+	c.closed = true
+	c.mu.Unlock()
+
+	for socket := range sockets {
+		socket.Close()
+	}
+	return nil
+}
+
+// trackedSocket is a socket that is forgotten by its Conn once closed
+type trackedSocket struct {
+	net.Conn
+	owner *Conn
+}
+
+// Close implements net.Conn
+func (s *trackedSocket) Close() error {
+	s.owner.mu.Lock()
+	delete(s.owner.sockets, s.Conn)
+	s.owner.mu.Unlock()
+	return s.Conn.Close()
+}
@@ -0,0 +1,638 @@
+// socketiotest.go
+package socketiotest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/jonipwi/go-chat-client/config"
+)
+
+// Engine.io timings announced in the handshake, in milliseconds
+const (
+	pingInterval = 25000
+	pingTimeout  = 60000
+)
+
+// Server is an in-process stand-in for the chat server. It speaks the
+// engine.io/Socket.IO protocol the client library uses, polling handshake
+// followed by a websocket upgrade, records every event clients emit, answers
+// their acknowledgement requests and pushes events to them. Drops and
+// latency can be simulated to exercise reconnects and timeouts.
+//
+//	srv := socketiotest.NewServer()
+//	defer srv.Close()
+//	srv.Configure(&cfg)
+//	srv.Handle("join_room", func(c *socketiotest.Conn, e socketiotest.Event) []interface{} {
+//		c.Emit("room joined", map[string]string{"id": e.StringArg(0)})
+//		return nil
+//	})
+//
+// Like a real server it knows nothing of the client's handlers: events
+// pushed before the client has attached them are lost.
+type Server struct {
+	URL string // Base URL of the server, http://127.0.0.1:<port> or https for a TLS server
+
+	srv      *httptest.Server
+	caFile   string // Certificate of a TLS server, in PEM
+	upgrader websocket.Upgrader
+
+	mu        sync.Mutex
+	changed   chan struct{} // Closed and replaced whenever a connection or event is recorded
+	nextID    int
+	pending   map[string]*http.Request // Handshakes waiting for their websocket upgrade
+	conns     []*Conn
+	events    []Event
+	handlers  map[string]Handler
+	latency   time.Duration
+	rejecting int
+	held      chan struct{} // Closed when held handshakes may go on, nil if none are held
+}
+
+// Handler answers an event. If the client asked for an acknowledgement the
+// returned values are sent back as its arguments; a nil reply acknowledges
+// with Ack(nil). The client library drops acknowledgements whose arguments
+// do not match its callback, which takes an (err, data) pair, so build
+// replies with Ack and Reject.
+type Handler func(c *Conn, e Event) []interface{}
+
+// Ack is the reply acknowledging a request with data
+func Ack(data interface{}) []interface{} {
+	return []interface{}{nil, data}
+}
+
+// Reject is the reply rejecting a request for the given reason
+func Reject(reason string) []interface{} {
+	return []interface{}{reason, nil}
+}
+
+// Event is an event emitted by a client
+type Event struct {
+	Conn     *Conn
+	Name     string
+	Args     []json.RawMessage
+	Received time.Time
+
+	ackID int // -1 when the client did not ask for an acknowledgement
+}
+
+// StringArg returns argument i decoded as a string, or "" if it is missing or not a string
+func (e Event) StringArg(i int) string {
+	var s string
+	if i < len(e.Args) && json.Unmarshal(e.Args[i], &s) == nil {
+		return s
+	}
+	return ""
+}
+
+// DecodeArg decodes argument i into v
+func (e Event) DecodeArg(i int, v interface{}) error {
+	if i >= len(e.Args) {
+		return fmt.Errorf("%s has no argument %d", e.Name, i)
+	}
+	return json.Unmarshal(e.Args[i], v)
+}
+
+// NewServer starts a server listening on a local port. Close it when done.
+func NewServer() *Server {
+	s := newServer()
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.srv.URL
+	return s
+}
+
+// newServer creates a server that is not listening yet
+func newServer() *Server {
+	return &Server{
+		changed:  make(chan struct{}),
+		pending:  make(map[string]*http.Request),
+		handlers: make(map[string]Handler),
+	}
+}
+
+// Close drops every connection and shuts the server down
+func (s *Server) Close() {
+	s.DropAll()
+	s.srv.Close()
+	if s.caFile != "" {
+		os.Remove(s.caFile)
+	}
+}
+
+// Addr returns the host and port the server listens on
+func (s *Server) Addr() (string, int) {
+	host, port, _ := net.SplitHostPort(s.srv.Listener.Addr().String())
+	n, _ := strconv.Atoi(port)
+	return host, n
+}
+
+// Configure points cfg at the server. For a TLS server it enables TLS and
+// trusts the server's certificate and nothing else.
+func (s *Server) Configure(cfg *config.Config) {
+	cfg.Host, cfg.Port = s.Addr()
+	cfg.TLS = config.TLSConfig{Enabled: s.caFile != "", CAFile: s.caFile}
+}
+
+// Handle registers h to answer the event called name, replacing any earlier
+// handler. Events without a handler are acknowledged with Ack(nil).
+func (s *Server) Handle(name string, h Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[name] = h
+}
+
+// SetLatency delays every packet sent from now on by d
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// RejectHandshakes answers new connection attempts with the HTTP status
+// code, e.g. 503 to simulate an outage or 401 for rejected credentials.
+// A status of 0 accepts them again.
+func (s *Server) RejectHandshakes(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rejecting = status
+}
+
+// HoldHandshakes keeps new connection attempts waiting until release is
+// called, e.g. to act while a client is in the middle of connecting. The
+// server cannot be closed while a handshake is held.
+func (s *Server) HoldHandshakes() (release func()) {
+	held := make(chan struct{})
+	s.mu.Lock()
+	s.held = held
+	s.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			if s.held == held {
+				s.held = nil
+			}
+			s.mu.Unlock()
+			close(held)
+		})
+	}
+}
+
+// Emit pushes an event to every open connection
+func (s *Server) Emit(name string, args ...interface{}) {
+	for _, c := range s.Conns() {
+		if c.Open() {
+			c.Emit(name, args...)
+		}
+	}
+}
+
+// DropAll closes every connection abruptly, as a network failure would
+func (s *Server) DropAll() {
+	for _, c := range s.Conns() {
+		c.Drop()
+	}
+}
+
+// Conns returns every connection accepted so far, oldest first, including closed ones
+func (s *Server) Conns() []*Conn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Conn(nil), s.conns...)
+}
+
+// Events returns every event received so far, oldest first
+func (s *Server) Events() []Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Event(nil), s.events...)
+}
+
+// EventsNamed returns the events received so far called name, oldest first
+func (s *Server) EventsNamed(name string) []Event {
+	var named []Event
+	for _, e := range s.Events() {
+		if e.Name == name {
+			named = append(named, e)
+		}
+	}
+	return named
+}
+
+// WaitConns waits until at least n connections have been accepted and returns them
+func (s *Server) WaitConns(n int, timeout time.Duration) ([]*Conn, error) {
+	var conns []*Conn
+	err := s.waitFor(timeout, func() bool {
+		conns = s.Conns()
+		return len(conns) >= n
+	})
+	if err != nil {
+		return conns, fmt.Errorf("waiting for %d connection(s), got %d: %w", n, len(conns), err)
+	}
+	return conns, nil
+}
+
+// WaitEvents waits until at least n events called name have been received and returns them
+func (s *Server) WaitEvents(name string, n int, timeout time.Duration) ([]Event, error) {
+	var named []Event
+	err := s.waitFor(timeout, func() bool {
+		named = s.EventsNamed(name)
+		return len(named) >= n
+	})
+	if err != nil {
+		return named, fmt.Errorf("waiting for %d %q event(s), got %d: %w", n, name, len(named), err)
+	}
+	return named, nil
+}
+
+// WaitEvent waits for the first event called name
+func (s *Server) WaitEvent(name string, timeout time.Duration) (Event, error) {
+	named, err := s.WaitEvents(name, 1, timeout)
+	if err != nil {
+		return Event{}, err
+	}
+	return named[0], nil
+}
+
+// errTimeout is returned by the Wait methods
+var errTimeout = errors.New("timed out")
+
+// waitFor re-evaluates done each time something is recorded until it holds or timeout passes
+func (s *Server) waitFor(timeout time.Duration, done func() bool) error {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		s.mu.Lock()
+		changed := s.changed
+		s.mu.Unlock()
+		if done() {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-deadline.C:
+			return errTimeout
+		}
+	}
+}
+
+// notifyLocked wakes up the waiters; s.mu must be held
+func (s *Server) notifyLocked() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// record stores an event received on c and returns the handler for it
+func (s *Server) record(e Event) Handler {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, e)
+	s.notifyLocked()
+	return s.handlers[e.Name]
+}
+
+// delay returns the simulated latency
+func (s *Server) delay() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.latency
+}
+
+// serveHTTP implements the engine.io endpoint: the polling handshake and the websocket upgrade
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	sid := query.Get("sid")
+
+	s.mu.Lock()
+	held := s.held
+	s.mu.Unlock()
+	if held != nil && sid == "" {
+		<-held
+	}
+
+	s.mu.Lock()
+	rejecting := s.rejecting
+	s.mu.Unlock()
+	if rejecting != 0 {
+		http.Error(w, http.StatusText(rejecting), rejecting)
+		return
+	}
+
+	switch {
+	case query.Get("transport") == "websocket":
+		s.upgrade(w, r, sid)
+	case sid == "":
+		s.open(w, r)
+	case r.Method == http.MethodPost:
+		// Packets sent over polling before the upgrade, i.e. pings; nothing to answer
+		w.Write([]byte("ok"))
+	default:
+		// The client reads one more polling payload before upgrading
+		writePayload(w, "40")
+	}
+}
+
+// open starts a session and answers with the engine.io open packet
+func (s *Server) open(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.nextID++
+	sid := fmt.Sprintf("conn-%d", s.nextID)
+	s.pending[sid] = r
+	s.mu.Unlock()
+
+	handshake, _ := json.Marshal(map[string]interface{}{
+		"sid":          sid,
+		"upgrades":     []string{"websocket"},
+		"pingInterval": pingInterval,
+		"pingTimeout":  pingTimeout,
+	})
+	writePayload(w, "0"+string(handshake))
+}
+
+// upgrade switches a session to the websocket transport and serves it
+func (s *Server) upgrade(w http.ResponseWriter, r *http.Request, sid string) {
+	s.mu.Lock()
+	handshake, ok := s.pending[sid]
+	delete(s.pending, sid)
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, "unknown sid", http.StatusBadRequest)
+		return
+	}
+
+	ws, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	c := newConn(s, sid, handshake, ws)
+	if err := c.probe(); err != nil {
+		c.Drop()
+		return
+	}
+
+	s.mu.Lock()
+	s.conns = append(s.conns, c)
+	s.notifyLocked()
+	s.mu.Unlock()
+
+	c.readLoop()
+}
+
+// writePayload writes a polling payload holding a single text packet
+func writePayload(w http.ResponseWriter, packet string) {
+	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+	fmt.Fprintf(w, "%d:%s", len(packet), packet)
+}
+
+// Conn is a client connected to the server
+type Conn struct {
+	server    *Server
+	id        string
+	handshake *http.Request
+	ws        *websocket.Conn
+
+	out       chan outgoing
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// outgoing is a packet waiting to be written once its simulated latency has passed
+type outgoing struct {
+	data []byte
+	due  time.Time
+}
+
+// newConn wraps an upgraded websocket and starts writing to it
+func newConn(s *Server, sid string, handshake *http.Request, ws *websocket.Conn) *Conn {
+	c := &Conn{
+		server:    s,
+		id:        sid,
+		handshake: handshake,
+		ws:        ws,
+		out:       make(chan outgoing, 1024),
+		done:      make(chan struct{}),
+	}
+	go c.writeLoop()
+	return c
+}
+
+// ID returns the engine.io session ID, a convenient client ID to hand out
+func (c *Conn) ID() string {
+	return c.id
+}
+
+// Username returns the username the client connected with
+func (c *Conn) Username() string {
+	return c.Query().Get("username")
+}
+
+// Query returns the query parameters of the handshake
+func (c *Conn) Query() url.Values {
+	return c.handshake.URL.Query()
+}
+
+// Header returns the HTTP headers of the handshake
+func (c *Conn) Header() http.Header {
+	return c.handshake.Header
+}
+
+// Done is closed when the connection ends
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Open reports whether the connection is still up
+func (c *Conn) Open() bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// Emit pushes an event to the client
+func (c *Conn) Emit(name string, args ...interface{}) error {
+	data, err := json.Marshal(append([]interface{}{name}, args...))
+	if err != nil {
+		return err
+	}
+	return c.send("42" + string(data))
+}
+
+// Drop closes the connection without a goodbye, as a network failure would
+func (c *Conn) Drop() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.ws.Close()
+	})
+}
+
+// send queues an engine.io packet, delayed by the server's latency
+func (c *Conn) send(packet string) error {
+	if !c.Open() {
+		return fmt.Errorf("connection %s is closed", c.id)
+	}
+	select {
+	case <-c.done:
+		return fmt.Errorf("connection %s is closed", c.id)
+	case c.out <- outgoing{data: []byte(packet), due: time.Now().Add(c.server.delay())}:
+		return nil
+	}
+}
+
+// writeLoop writes queued packets in order, each once it is due
+func (c *Conn) writeLoop() {
+	for {
+		var p outgoing
+		select {
+		case <-c.done:
+			return
+		case p = <-c.out:
+		}
+
+		if wait := time.Until(p.due); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-c.done:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+		if err := c.ws.WriteMessage(websocket.TextMessage, p.data); err != nil {
+			c.Drop()
+			return
+		}
+	}
+}
+
+// probe completes the transport upgrade: the client pings "probe" over the
+// websocket, the server pongs it back and the client confirms with an upgrade packet
+func (c *Conn) probe() error {
+	c.ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	defer c.ws.SetReadDeadline(time.Time{})
+
+	for _, step := range []struct{ expect, reply string }{{"2probe", "3probe"}, {"5", ""}} {
+		_, data, err := c.ws.ReadMessage()
+		if err != nil {
+			return err
+		}
+		if string(data) != step.expect {
+			return fmt.Errorf("expected %q during the upgrade, got %q", step.expect, data)
+		}
+		if step.reply != "" {
+			if err := c.send(step.reply); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readLoop handles engine.io packets until the connection ends
+func (c *Conn) readLoop() {
+	defer c.Drop()
+	for {
+		_, data, err := c.ws.ReadMessage()
+		if err != nil || len(data) == 0 {
+			return
+		}
+		switch data[0] {
+		case '1': // close
+			return
+		case '2': // ping
+			c.send("3" + string(data[1:]))
+		case '4': // message
+			c.handleMessage(data[1:])
+		}
+	}
+}
+
+// handleMessage records a Socket.IO event and acknowledges it if asked to
+func (c *Conn) handleMessage(data []byte) {
+	e, ok := parseEvent(data)
+	if !ok {
+		return
+	}
+	e.Conn = c
+	e.Received = time.Now()
+
+	handler := c.server.record(e)
+	var reply []interface{}
+	if handler != nil {
+		reply = handler(c, e)
+	}
+	if e.ackID < 0 {
+		return
+	}
+	if reply == nil {
+		reply = Ack(nil)
+	}
+	encoded, err := json.Marshal(reply)
+	if err != nil {
+		return
+	}
+	c.send(fmt.Sprintf("43%d%s", e.ackID, encoded))
+}
+
+// parseEvent decodes a Socket.IO event packet: 2[/namespace,][ackID]["name",args...]
+func parseEvent(data []byte) (Event, bool) {
+	if len(data) == 0 || data[0] != '2' {
+		return Event{}, false
+	}
+	rest := string(data[1:])
+	if len(rest) > 0 && rest[0] == '/' {
+		i := 0
+		for i < len(rest) && rest[i] != ',' {
+			i++
+		}
+		if i == len(rest) {
+			return Event{}, false
+		}
+		rest = rest[i+1:]
+	}
+
+	e := Event{ackID: -1}
+	i := 0
+	for i < len(rest) && rest[i] >= '0' && rest[i] <= '9' {
+		i++
+	}
+	if i > 0 {
+		e.ackID, _ = strconv.Atoi(rest[:i])
+	}
+
+	var raw []json.RawMessage
+	if json.Unmarshal([]byte(rest[i:]), &raw) != nil || len(raw) == 0 {
+		return Event{}, false
+	}
+	if json.Unmarshal(raw[0], &e.Name) != nil {
+		return Event{}, false
+	}
+	e.Args = raw[1:]
+	return e, true
+}
+
+// WaitUntil polls cond until it holds or timeout passes and reports whether
+// it held, for waiting on client state the server cannot observe
+func WaitUntil(timeout time.Duration, cond func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return true
+}
@@ -0,0 +1,178 @@
+package socketiotest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jonipwi/go-chat-client/config"
+	"github.com/jonipwi/go-chat-client/events"
+	"github.com/jonipwi/go-chat-client/server_connection"
+	"github.com/jonipwi/go-chat-client/state"
+)
+
+// connect dials srv with the client library and returns the server side of the connection
+func connect(t *testing.T, srv *Server, clientState *state.ClientState, router *events.Router) *Conn {
+	t.Helper()
+	cfg := config.Default()
+	srv.Configure(&cfg)
+	cfg.ConnectRetries = 1
+
+	if _, err := server_connection.ConnectToServer(context.Background(), cfg, clientState, router, nil); err != nil {
+		t.Fatalf("ConnectToServer() error: %v", err)
+	}
+	t.Cleanup(clientState.CloseConnection)
+
+	conns, err := srv.WaitConns(1, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conns[len(conns)-1]
+}
+
+func TestHandshakeAndEvents(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	clientState := state.NewClientState("alice")
+	router := events.NewRouter(clientState)
+	received := make(chan events.Event, 10)
+	router.Subscribe(func(e events.Event) { received <- e })
+
+	conn := connect(t, srv, clientState, router)
+	if conn.Username() != "alice" {
+		t.Errorf("Username() = %q; expected the username from the handshake query", conn.Username())
+	}
+
+	if err := clientState.Client().Emit("global_message", "hello"); err != nil {
+		t.Fatalf("Emit() error: %v", err)
+	}
+	e, err := srv.WaitEvent("global_message", 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.StringArg(0) != "hello" || e.Conn != conn {
+		t.Errorf("Received %q with %v on %s; expected hello", e.Name, e.Args, e.Conn.ID())
+	}
+
+	conn.Emit("chat message", map[string]string{"sender": "bob", "content": "hi alice"})
+	select {
+	case e := <-received:
+		if e.Message == nil || e.Message.Sender != "bob" || e.Message.Content != "hi alice" {
+			t.Errorf("Client decoded %+v; expected bob's chat message", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the pushed message")
+	}
+}
+
+func TestAcknowledgements(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.Handle("create_room", func(c *Conn, e Event) []interface{} {
+		if e.StringArg(1) == "taken" {
+			return Reject("name taken")
+		}
+		return nil
+	})
+
+	clientState := state.NewClientState("alice")
+	connect(t, srv, clientState, events.NewRouter(clientState))
+
+	req, err := clientState.Request("create_room", "group", "fresh")
+	if err != nil {
+		t.Fatalf("Request() error: %v", err)
+	}
+	if result := req.Wait(); result.Status != state.RequestAcked {
+		t.Errorf("create_room fresh: %+v; expected it to be acknowledged", result)
+	}
+
+	req, err = clientState.Request("create_room", "group", "taken")
+	if err != nil {
+		t.Fatalf("Request() error: %v", err)
+	}
+	if result := req.Wait(); result.Status != state.RequestRejected || result.Error != "name taken" {
+		t.Errorf("create_room taken: %+v; expected it to be rejected", result)
+	}
+}
+
+func TestLatency(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	clientState := state.NewClientState("alice")
+	connect(t, srv, clientState, events.NewRouter(clientState))
+
+	const latency = 200 * time.Millisecond
+	srv.SetLatency(latency)
+	start := time.Now()
+	req, err := clientState.Request("join_room", "slow")
+	if err != nil {
+		t.Fatalf("Request() error: %v", err)
+	}
+	if result := req.Wait(); result.Status != state.RequestAcked {
+		t.Fatalf("join_room: %+v; expected it to be acknowledged", result)
+	}
+	if elapsed := time.Since(start); elapsed < latency {
+		t.Errorf("Acknowledged after %v; expected at least the %v latency", elapsed, latency)
+	}
+}
+
+func TestDropAndReject(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	clientState := state.NewClientState("alice")
+	conn := connect(t, srv, clientState, events.NewRouter(clientState))
+
+	conn.Drop()
+	select {
+	case reason := <-clientState.ReconnectRequests():
+		t.Logf("Client asked to reconnect: %s", reason)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the client to notice the dropped connection")
+	}
+	if clientState.IsConnected() {
+		t.Error("Expected the client to be marked disconnected")
+	}
+	if err := conn.Emit("chat message", "late"); err == nil {
+		t.Error("Expected Emit on a dropped connection to fail")
+	}
+
+	srv.RejectHandshakes(503)
+	cfg := config.Default()
+	srv.Configure(&cfg)
+	cfg.ConnectRetries = 1
+	if _, err := server_connection.ConnectToServer(context.Background(), cfg, clientState, events.NewRouter(clientState), nil); err == nil {
+		t.Error("Expected the handshake to be rejected")
+	}
+}
+
+func TestParseEvent(t *testing.T) {
+	tests := []struct {
+		packet string
+		name   string
+		ackID  int
+		args   int
+		ok     bool
+	}{
+		{`2["global_message","hi"]`, "global_message", -1, 1, true},
+		{`212["join_room","room-1","req-1"]`, "join_room", 12, 2, true},
+		{`2/chat,3["ping"]`, "ping", 3, 0, true},
+		{"2[\"typing\"]\n", "typing", -1, 0, true},
+		{`3[]`, "", 0, 0, false},
+		{`2[]`, "", 0, 0, false},
+		{`2[42]`, "", 0, 0, false},
+	}
+	for _, tt := range tests {
+		e, ok := parseEvent([]byte(tt.packet))
+		if ok != tt.ok {
+			t.Errorf("parseEvent(%q) ok = %v; expected %v", tt.packet, ok, tt.ok)
+			continue
+		}
+		if ok && (e.Name != tt.name || e.ackID != tt.ackID || len(e.Args) != tt.args) {
+			t.Errorf("parseEvent(%q) = %q, ack %d, %d args; expected %q, ack %d, %d args",
+				tt.packet, e.Name, e.ackID, len(e.Args), tt.name, tt.ackID, tt.args)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// tls.go
+package socketiotest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"time"
+)
+
+// NewTLSServer starts a server like NewServer that serves HTTPS with a
+// self-signed certificate of its own, so no two TLS servers trust each
+// other's certificate. It panics if the certificate cannot be created.
+func NewTLSServer() *Server {
+	cert, certPEM, err := selfSignedCert()
+	if err != nil {
+		panic(fmt.Sprintf("socketiotest: creating certificate: %v", err))
+	}
+	caFile, err := os.CreateTemp("", "socketiotest-*.pem")
+	if err != nil {
+		panic(fmt.Sprintf("socketiotest: writing certificate: %v", err))
+	}
+	defer caFile.Close()
+	if _, err := caFile.Write(certPEM); err != nil {
+		panic(fmt.Sprintf("socketiotest: writing certificate: %v", err))
+	}
+
+	s := newServer()
+	s.caFile = caFile.Name()
+	s.srv = httptest.NewUnstartedServer(http.HandlerFunc(s.serveHTTP))
+	s.srv.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	s.srv.StartTLS()
+	s.URL = s.srv.URL
+	return s
+}
+
+// selfSignedCert creates a certificate for 127.0.0.1 and returns it with its PEM encoding
+func selfSignedCert() (tls.Certificate, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "socketiotest"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	return cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), nil
+}
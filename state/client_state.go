@@ -1,17 +1,23 @@
 package state
 
 import (
+	"encoding/json"
 	"fmt"
-	"log"
+	"io"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/jonipwi/go-chat-client/utils"
 	socketio_client "github.com/zhouhui8915/go-socket.io-client"
 )
 
-// ClientState keeps track of the client state
+// ClientState keeps track of the client state. It is safe for concurrent use.
 type ClientState struct {
+	mu                    sync.RWMutex
 	connected             bool
 	client                *socketio_client.Client
+	conn                  io.Closer // Closes the client's connection
 	username              string
 	clientID              string
 	lastHeartbeatSent     time.Time
@@ -23,66 +29,159 @@ type ClientState struct {
 	heartbeatsSent        int
 	heartbeatsReceived    int
 	connectionErrors      []string
+	connectionErrorsTotal int
+	emitFailures          map[string]int
+	authErrors            int
 	lastReconnectAttempt  time.Time
+	lastServerActivity    time.Time
+	reconnectAttempts     int
+	reconnects            int
+	reconnectRequests     chan string
 	currentRoom           string
+	joinedRooms           []string
+	outbox                *Outbox
+	requests              *Requests
+	rooms                 *RoomRegistry
+	presence              *Presence
+	typing                *Typing
+	unread                *Unread
+	latency               *Latency
+	sentHooks             []func(event string, args []interface{})
 }
 
 // NewClientState creates a new ClientState instance
 func NewClientState(username string) *ClientState {
-	return &ClientState{
-		connected:        false,
-		username:         username,
-		lastActivity:     time.Now(),
-		connectionErrors: make([]string, 0, 10),
+	cs := &ClientState{
+		connected:         false,
+		username:          username,
+		lastActivity:      time.Now(),
+		connectionErrors:  make([]string, 0, 10),
+		emitFailures:      make(map[string]int),
+		reconnectRequests: make(chan string, 1),
+		outbox:            NewOutbox(DefaultOutboxCapacity, DefaultOutboxMaxAge),
+		requests:          NewRequests(DefaultRequestTimeout),
+		rooms:             NewRoomRegistry(),
+		presence:          NewPresence(),
+		unread:            NewUnread(),
+		latency:           NewLatency(DefaultLatencyWindow, DefaultProbeTimeout),
 	}
+	cs.typing = NewTyping(DefaultTypingIdle, DefaultTypingExpiry, cs.emitTyping)
+	return cs
 }
 
 // IsConnected returns the current connection status
 func (cs *ClientState) IsConnected() bool {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
 	return cs.connected
 }
 
 // Client returns the current socket.io client
 func (cs *ClientState) Client() *socketio_client.Client {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
 	return cs.client
 }
 
-// SetClient updates the socket.io client
-func (cs *ClientState) SetClient(client *socketio_client.Client) {
+// SetClient updates the socket.io client. conn closes the client's
+// connection, which the client cannot do itself, and may be nil.
+func (cs *ClientState) SetClient(client *socketio_client.Client, conn io.Closer) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
 	cs.client = client
+	cs.conn = conn
 }
 
+// logger logs connection state changes
+var logger = utils.Log(utils.ComponentConnection)
+
 // SetConnected updates the connection status
 func (cs *ClientState) SetConnected(connected bool) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
 	wasConnected := cs.connected
 	cs.connected = connected
 
 	if connected && !wasConnected {
 		cs.connectionStarted = time.Now()
-		log.Printf("CONNECTION STATE: Connected at %v\n", cs.connectionStarted.Format(time.RFC3339))
+		cs.lastServerActivity = cs.connectionStarted
+		logger.Info("Connected", "at", cs.connectionStarted.Format(time.RFC3339))
 	} else if !connected && wasConnected {
 		duration := time.Since(cs.connectionStarted).Round(time.Second)
-		log.Printf("CONNECTION STATE: Disconnected after %v\n", duration)
+		logger.Info("Disconnected", "after", duration)
 	}
 }
 
 // UpdateActivity updates the last activity timestamp
 func (cs *ClientState) UpdateActivity() {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
 	cs.lastActivity = time.Now()
 }
 
 // GetLastActivity returns the last activity timestamp
 func (cs *ClientState) GetLastActivity() time.Time {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
 	return cs.lastActivity
 }
 
-// SetLastReconnectAttempt updates the last reconnect attempt timestamp
+// GetLastServerActivity returns the time the server was last heard from
+func (cs *ClientState) GetLastServerActivity() time.Time {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return cs.lastServerActivity
+}
+
+// SetLastReconnectAttempt records a reconnect attempt made at t
 func (cs *ClientState) SetLastReconnectAttempt(t time.Time) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
 	cs.lastReconnectAttempt = t
+	cs.reconnectAttempts++
+}
+
+// TrackReconnect increments the successful reconnects counter
+func (cs *ClientState) TrackReconnect() {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.reconnects++
+}
+
+// RequestReconnect asks the reconnection supervisor to re-establish the connection.
+// It never blocks; a request made while another one is pending is dropped.
+func (cs *ClientState) RequestReconnect(reason string) {
+	select {
+	case cs.reconnectRequests <- reason:
+	default:
+	}
+}
+
+// ReconnectRequests returns the channel on which reconnect requests are delivered
+func (cs *ClientState) ReconnectRequests() <-chan string {
+	return cs.reconnectRequests
 }
 
 // AddConnectionError adds a new connection error to the history
 func (cs *ClientState) AddConnectionError(err string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.addErrorLocked(err)
+}
+
+// AddAuthError records that the server rejected the client's credentials.
+// Auth errors are kept in the same history as connection errors but are
+// labelled and counted separately, since retrying will not fix them.
+func (cs *ClientState) AddAuthError(err string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.authErrors++
+	cs.addErrorLocked("AUTH REJECTED: " + err)
+}
+
+// addErrorLocked appends to the error history, keeping the last 10 entries
+func (cs *ClientState) addErrorLocked(err string) {
+	cs.connectionErrorsTotal++
 	if len(cs.connectionErrors) >= 10 {
 		cs.connectionErrors = cs.connectionErrors[1:]
 	}
@@ -91,60 +190,39 @@ func (cs *ClientState) AddConnectionError(err string) {
 		time.Now().Format("15:04:05"), err))
 }
 
-// GetStats returns a formatted string of connection statistics
-func (cs *ClientState) GetStats() string {
-	var connStatus string
-	var connDuration time.Duration
-
-	if cs.connected {
-		connStatus = "Connected"
-		connDuration = time.Since(cs.connectionStarted).Round(time.Second)
-	} else {
-		connStatus = "Disconnected"
-		if !cs.connectionStarted.IsZero() {
-			connDuration = cs.lastActivity.Sub(cs.connectionStarted).Round(time.Second)
-		}
-	}
-
-	timeSinceLastHeartbeatSent := "Never"
-	if !cs.lastHeartbeatSent.IsZero() {
-		timeSinceLastHeartbeatSent = time.Since(cs.lastHeartbeatSent).Round(time.Second).String()
-	}
-
-	timeSinceLastHeartbeatReceived := "Never"
-	if !cs.lastHeartbeatReceived.IsZero() {
-		timeSinceLastHeartbeatReceived = time.Since(cs.lastHeartbeatReceived).Round(time.Second).String()
-	}
-
-	// Add reconnection info
-	var reconnInfo string
-	if !cs.lastReconnectAttempt.IsZero() {
-		reconnInfo = fmt.Sprintf(", Last reconnect attempt: %s ago",
-			time.Since(cs.lastReconnectAttempt).Round(time.Second))
-	}
-
-	return fmt.Sprintf("Status: %s, Duration: %v, Client ID: %s, Username: %s, "+
-		"Messages Sent: %d, Messages Received: %d, Heartbeats Sent: %d, Heartbeats Received: %d, "+
-		"Time Since Last Heartbeat Sent: %s, Time Since Last Heartbeat Received: %s%s",
-		connStatus, connDuration, cs.clientID, cs.username,
-		cs.messagesSent, cs.messagesReceived, cs.heartbeatsSent, cs.heartbeatsReceived,
-		timeSinceLastHeartbeatSent, timeSinceLastHeartbeatReceived, reconnInfo)
+// TrackEmitFailure counts an event that could not be written to the connection
+func (cs *ClientState) TrackEmitFailure(event string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.emitFailures[event]++
 }
 
 // TrackMessageSent increments the messages sent counter
 func (cs *ClientState) TrackMessageSent() {
-	cs.messagesSent++
+	cs.trackMessagesSent(1)
+}
+
+// trackMessagesSent adds n to the messages sent counter
+func (cs *ClientState) trackMessagesSent(n int) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.messagesSent += n
 	cs.lastActivity = time.Now()
 }
 
 // TrackMessageReceived increments the messages received counter
 func (cs *ClientState) TrackMessageReceived() {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
 	cs.messagesReceived++
 	cs.lastActivity = time.Now()
+	cs.lastServerActivity = cs.lastActivity
 }
 
 // TrackHeartbeatSent increments the heartbeats sent counter
 func (cs *ClientState) TrackHeartbeatSent() {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
 	cs.heartbeatsSent++
 	cs.lastHeartbeatSent = time.Now()
 	cs.lastActivity = cs.lastHeartbeatSent
@@ -152,71 +230,446 @@ func (cs *ClientState) TrackHeartbeatSent() {
 
 // TrackHeartbeatReceived increments the heartbeats received counter
 func (cs *ClientState) TrackHeartbeatReceived() {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
 	cs.heartbeatsReceived++
 	cs.lastHeartbeatReceived = time.Now()
 	cs.lastActivity = cs.lastHeartbeatReceived
+	cs.lastServerActivity = cs.lastHeartbeatReceived
+}
+
+// Outbox returns the queue of messages waiting to be sent
+func (cs *ClientState) Outbox() *Outbox {
+	return cs.outbox
+}
+
+// online returns the current client if the state is connected
+func (cs *ClientState) online() *socketio_client.Client {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	if !cs.connected {
+		return nil
+	}
+	return cs.client
+}
+
+// Send emits a message event, or queues it in the outbox when it cannot be sent
+// right now. It reports whether the message is still waiting in the outbox.
+func (cs *ClientState) Send(event string, args ...interface{}) (bool, error) {
+	client := cs.online()
+	if client != nil && cs.outbox.Len() == 0 {
+		err := client.Emit(event, args...)
+		if err == nil {
+			cs.TrackMessageSent()
+			cs.notifySent(event, args)
+			return false, nil
+		}
+		cs.TrackEmitFailure(event)
+		cs.AddConnectionError(fmt.Sprintf("Sending %s failed, queued for retry: %v", event, err))
+		client = nil
+	}
+
+	item, err := cs.outbox.Enqueue(event, args...)
+	if err != nil {
+		return false, err
+	}
+
+	// Earlier messages are still waiting, send them first to keep the order
+	if client != nil {
+		cs.FlushOutbox()
+	}
+	status, _ := cs.outbox.Status(item.ID)
+	return status == StatusQueued, nil
+}
+
+// FlushOutbox sends the queued messages over the current client
+func (cs *ClientState) FlushOutbox() (int, error) {
+	client := cs.online()
+	if client == nil {
+		return 0, fmt.Errorf("not connected")
+	}
+
+	// The outbox stays locked while it flushes, so failures are counted and
+	// the hooks called once it is done, leaving them free to use the state
+	type delivery struct {
+		event string
+		args  []interface{}
+	}
+	var delivered []delivery
+	var failed []string
+	sent, err := cs.outbox.Flush(func(event string, args ...interface{}) error {
+		if err := client.Emit(event, args...); err != nil {
+			failed = append(failed, event)
+			return err
+		}
+		delivered = append(delivered, delivery{event, args})
+		return nil
+	})
+	for _, event := range failed {
+		cs.TrackEmitFailure(event)
+	}
+	if sent > 0 {
+		cs.trackMessagesSent(sent)
+	}
+	for _, d := range delivered {
+		cs.notifySent(d.event, d.args)
+	}
+	return sent, err
+}
+
+// Latency returns the round-trip time measurements
+func (cs *ClientState) Latency() *Latency {
+	return cs.latency
+}
+
+// Requests returns the tracker of requests waiting for the server's answer
+func (cs *ClientState) Requests() *Requests {
+	return cs.requests
+}
+
+// Rooms returns what the server has told the client about each room
+func (cs *ClientState) Rooms() *RoomRegistry {
+	return cs.rooms
+}
+
+// Presence returns the roster of users known to be online
+func (cs *ClientState) Presence() *Presence {
+	return cs.presence
+}
+
+// Typing returns the typing indicators sent and received
+func (cs *ClientState) Typing() *Typing {
+	return cs.typing
+}
+
+// Unread returns the counts of messages received outside the focused room
+func (cs *ClientState) Unread() *Unread {
+	return cs.unread
+}
+
+// TrackUnread counts a message received in room unless the room is in focus
+// or the message is the user's own. Private conversations are identified by
+// PrivatePrefix and the other user.
+func (cs *ClientState) TrackUnread(room, sender, content string) {
+	username := cs.GetUsername()
+	if sender == username || (!strings.HasPrefix(room, PrivatePrefix) && rosterKey(room) == rosterKey(cs.GetCurrentRoom())) {
+		return
+	}
+	cs.unread.Add(room, Mentions(content, username))
+}
+
+// emitTyping sends a typing event for room, or for global chat if room is
+// empty. Typing events are not worth queueing and are dropped while offline.
+func (cs *ClientState) emitTyping(event, room string) {
+	client := cs.online()
+	if client == nil {
+		return
+	}
+	args := []interface{}{}
+	if room != "" {
+		args = append(args, room)
+	}
+	if err := client.Emit(event, args...); err != nil {
+		cs.TrackEmitFailure(event)
+		logger.Debug("Failed to send typing indicator", "event", event, "room", room, "error", err)
+	}
+}
+
+// Request emits event with a fresh request ID appended to args and tracks
+// it until the server acknowledges or rejects it, or it times out. The
+// answer may come as a Socket.IO acknowledgement or as an "ack" or "error"
+// event carrying the request ID.
+func (cs *ClientState) Request(event string, args ...interface{}) (*Request, error) {
+	client := cs.online()
+	if client == nil {
+		return nil, fmt.Errorf("not connected")
+	}
+	return cs.emitRequest(client, event, args, nil)
+}
+
+// SendRequest is Send for events that should be acknowledged. When the
+// message is sent right away it is tracked like Request; when it has to wait
+// in the outbox it is queued untracked and the returned request is nil.
+func (cs *ClientState) SendRequest(event string, args ...interface{}) (*Request, bool, error) {
+	client := cs.online()
+	if client == nil || cs.outbox.Len() > 0 {
+		queued, err := cs.Send(event, args...)
+		return nil, queued, err
+	}
+
+	req, err := cs.emitRequest(client, event, args, nil)
+	if err != nil {
+		cs.AddConnectionError(fmt.Sprintf("Sending %s failed, queued for retry: %v", event, err))
+		queued, err := cs.Send(event, args...)
+		return nil, queued, err
+	}
+	cs.TrackMessageSent()
+	cs.notifySent(event, args)
+	return req, false, nil
+}
+
+// emitRequest emits a tracked request over client. onResolve, if not nil,
+// is applied to the result before the request is done.
+func (cs *ClientState) emitRequest(client *socketio_client.Client, event string, args []interface{}, onResolve func(RequestResult)) (*Request, error) {
+	req := cs.requests.track(event, onResolve)
+	// The socket.io client only calls back when the server acknowledges with
+	// exactly two arguments, an (err, data) pair. Nulls arrive empty and are
+	// restored so a rejection with null data is not mistaken for a success.
+	ack := func(errArg, data json.RawMessage) {
+		acked := []json.RawMessage{errArg, data}
+		for i, arg := range acked {
+			if len(arg) == 0 {
+				acked[i] = json.RawMessage("null")
+			}
+		}
+		_, result := ParseAck(acked)
+		cs.requests.Resolve(req.ID, result)
+	}
+
+	payload := append(append([]interface{}{}, args...), req.ID, ack)
+	if err := client.Emit(event, payload...); err != nil {
+		cs.TrackEmitFailure(event)
+		cs.requests.Resolve(req.ID, RequestResult{Status: RequestRejected, Error: err.Error()})
+		return nil, err
+	}
+	return req, nil
+}
+
+// OnSent registers fn to be called with every message event Send or
+// FlushOutbox delivers to the server, in the order they were sent
+func (cs *ClientState) OnSent(fn func(event string, args []interface{})) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.sentHooks = append(cs.sentHooks, fn)
+}
+
+// notifySent passes a delivered message event on to the OnSent hooks
+func (cs *ClientState) notifySent(event string, args []interface{}) {
+	cs.mu.RLock()
+	hooks := append([]func(string, []interface{}){}, cs.sentHooks...)
+	cs.mu.RUnlock()
+
+	for _, fn := range hooks {
+		fn(event, args)
+	}
 }
 
 // GetUsername returns the current username
 func (cs *ClientState) GetUsername() string {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
 	return cs.username
 }
 
 // SetUsername updates the username
 func (cs *ClientState) SetUsername(username string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
 	cs.username = username
 }
 
 // GetConnectionErrors returns the list of connection errors
 func (cs *ClientState) GetConnectionErrors() []string {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
 	return append([]string{}, cs.connectionErrors...)
 }
 
 // GetClientID returns the current client ID
 func (cs *ClientState) GetClientID() string {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
 	return cs.clientID
 }
 
 // SetClientID updates the client ID
 func (cs *ClientState) SetClientID(clientID string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
 	cs.clientID = clientID
 }
 
 // GetCurrentRoom returns the current room
 func (cs *ClientState) GetCurrentRoom() string {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
 	return cs.currentRoom
 }
 
-// SetCurrentRoom updates the current room
+// SetCurrentRoom updates the current room, which plain messages are sent to.
+// The room comes into focus, so its unread count is cleared.
 func (cs *ClientState) SetCurrentRoom(room string) {
+	cs.mu.Lock()
 	cs.currentRoom = room
+	cs.mu.Unlock()
+	cs.unread.MarkRead(room)
 }
 
-// ConnectToServer establishes a connection to the WebSocket server
-func (cs *ClientState) ConnectToServer(serverURL string) error {
-	opts := &socketio_client.Options{
-		Transport: "websocket",
-		Query:     make(map[string]string),
+// SwitchRoom brings a joined room into focus, or global chat if room is
+// empty or "global", and returns what was unread in it
+func (cs *ClientState) SwitchRoom(room string) (UnreadCount, error) {
+	room = rosterKey(room)
+	if room != "" && !cs.IsInRoom(room) {
+		return UnreadCount{}, fmt.Errorf("not a member of room %s", room)
 	}
-	opts.Query["username"] = cs.username
+	unread := cs.unread.Get(room)
+	cs.SetCurrentRoom(room)
+	return unread, nil
+}
 
-	client, err := socketio_client.NewClient(serverURL, opts)
-	if err != nil {
-		return err
+// IsInRoom reports whether the client has joined room
+func (cs *ClientState) IsInRoom(room string) bool {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	for _, r := range cs.joinedRooms {
+		if r == room {
+			return true
+		}
 	}
+	return false
+}
 
-	cs.client = client
-	cs.connected = true
+// GetJoinedRooms returns the rooms the client has joined, in join order
+func (cs *ClientState) GetJoinedRooms() []string {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return append([]string{}, cs.joinedRooms...)
+}
 
-	return nil
+// AddJoinedRoom records membership of a room so it can be rejoined after a reconnect
+func (cs *ClientState) AddJoinedRoom(room string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if room == "" || room == "global" {
+		return
+	}
+	for _, r := range cs.joinedRooms {
+		if r == room {
+			return
+		}
+	}
+	cs.joinedRooms = append(cs.joinedRooms, room)
+}
+
+// RemoveJoinedRoom forgets a room membership and its unread count, and
+// leaves the room if it was the current one
+func (cs *ClientState) RemoveJoinedRoom(room string) {
+	cs.unread.MarkRead(room)
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	for i, r := range cs.joinedRooms {
+		if r == room {
+			cs.joinedRooms = append(cs.joinedRooms[:i], cs.joinedRooms[i+1:]...)
+			break
+		}
+	}
+	if cs.currentRoom == room {
+		cs.currentRoom = ""
+	}
+}
+
+// SendToRoom sends a chat message to room, or to global chat when room is
+// empty or "global". The event is chosen by the room's type in the registry;
+// rooms whose type is not known yet are sent to as groups. It reports
+// whether the message is waiting in the outbox. Sending ends the typing
+// indicator.
+func (cs *ClientState) SendToRoom(room, text string) (bool, error) {
+	cs.typing.Stop()
+	if room == "" || room == "global" {
+		return cs.Send("global_message", text)
+	}
+	roomType := cs.rooms.Type(room)
+	if roomType == RoomGuild {
+		return cs.Send("guild_message", room, text)
+	}
+	if roomType == "" {
+		logger.Debug("Room type unknown, sending as a group message", "room", room)
+	}
+	return cs.Send("group_message", room, text)
+}
+
+// JoinRoom asks the server to join room and makes it the current room. The
+// membership is recorded straight away so the room is rejoined after a
+// reconnect even if the server never acknowledges; a rejection undoes it and
+// returns to the previous room before the request is done.
+func (cs *ClientState) JoinRoom(room string) (*Request, error) {
+	client := cs.online()
+	if client == nil {
+		return nil, fmt.Errorf("not connected")
+	}
+
+	previous := cs.GetCurrentRoom()
+	cs.AddJoinedRoom(room)
+	cs.SetCurrentRoom(room)
+	return cs.emitRequest(client, "join_room", []interface{}{room}, func(result RequestResult) {
+		if result.Status == RequestAcked {
+			if info, ok := roomFromAck(result.Data); ok {
+				cs.rooms.Update(info)
+			}
+		}
+		if result.Status != RequestRejected {
+			return
+		}
+		cs.RemoveJoinedRoom(room)
+		cs.mu.Lock()
+		defer cs.mu.Unlock()
+		if cs.currentRoom == "" {
+			cs.currentRoom = previous
+		}
+	})
+}
+
+// CreateRoom asks the server to create a room of the given type. Once the
+// server confirms, the room is added to the registry, as described by the
+// acknowledgement if it carries the room and under its name otherwise.
+func (cs *ClientState) CreateRoom(roomType, name string) (*Request, error) {
+	client := cs.online()
+	if client == nil {
+		return nil, fmt.Errorf("not connected")
+	}
+	return cs.emitRequest(client, "create_room", []interface{}{roomType, name}, func(result RequestResult) {
+		if result.Status != RequestAcked {
+			return
+		}
+		room, ok := roomFromAck(result.Data)
+		if !ok {
+			room = Room{ID: name, Name: name}
+		}
+		if room.Type == "" {
+			room.Type = roomType
+		}
+		cs.rooms.Update(room)
+	})
+}
+
+// Hangup closes the current client's connection but keeps the client, so
+// the connection counts as lost rather than closed on purpose
+func (cs *ClientState) Hangup() {
+	cs.mu.Lock()
+	conn := cs.conn
+	cs.conn = nil
+	cs.mu.Unlock()
+
+	cs.SetConnected(false)
+	if conn != nil {
+		conn.Close()
+	}
 }
 
 // CloseConnection closes the client connection and updates the state
 func (cs *ClientState) CloseConnection() {
-	if cs.client != nil {
-		cs.client.Emit("disconnect", []interface{}{})
-		cs.client = nil
-		cs.connected = false
-		cs.lastActivity = time.Now()
+	cs.mu.Lock()
+	if cs.client == nil {
+		cs.mu.Unlock()
+		return
+	}
+	conn := cs.conn
+	cs.client, cs.conn = nil, nil
+	cs.connected = false
+	cs.lastActivity = time.Now()
+	cs.mu.Unlock()
+
+	if conn != nil {
+		conn.Close()
 	}
 }
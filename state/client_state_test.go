@@ -0,0 +1,157 @@
+package state
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestJoinedRooms(t *testing.T) {
+	clientState := NewClientState("testuser")
+
+	clientState.AddJoinedRoom("group-1")
+	clientState.AddJoinedRoom("guild-1")
+	clientState.AddJoinedRoom("group-1") // Duplicate is ignored
+	clientState.AddJoinedRoom("global")  // Global chat is not a room membership
+	clientState.SetCurrentRoom("guild-1")
+
+	expected := []string{"group-1", "guild-1"}
+	if rooms := clientState.GetJoinedRooms(); !reflect.DeepEqual(rooms, expected) {
+		t.Errorf("GetJoinedRooms() = %v; expected %v", rooms, expected)
+	}
+
+	// Disconnecting must not forget memberships, they are needed to rejoin
+	clientState.SetConnected(true)
+	clientState.SetConnected(false)
+	if rooms := clientState.GetJoinedRooms(); len(rooms) != 2 {
+		t.Errorf("Expected rooms to survive a disconnect, got %v", rooms)
+	}
+
+	clientState.RemoveJoinedRoom("guild-1")
+	if room := clientState.GetCurrentRoom(); room != "" {
+		t.Errorf("Expected current room to be cleared after leaving it, got %q", room)
+	}
+	if rooms := clientState.GetJoinedRooms(); !reflect.DeepEqual(rooms, []string{"group-1"}) {
+		t.Errorf("GetJoinedRooms() = %v after leave; expected [group-1]", rooms)
+	}
+}
+
+func TestRequestReconnectDoesNotBlock(t *testing.T) {
+	clientState := NewClientState("testuser")
+
+	clientState.RequestReconnect("first")
+	clientState.RequestReconnect("second") // Dropped, one request is already pending
+
+	if reason := <-clientState.ReconnectRequests(); reason != "first" {
+		t.Errorf("Expected pending reconnect reason %q, got %q", "first", reason)
+	}
+	select {
+	case reason := <-clientState.ReconnectRequests():
+		t.Errorf("Expected no further reconnect requests, got %q", reason)
+	default:
+	}
+}
+
+func TestClientStateConcurrentAccess(t *testing.T) {
+	clientState := NewClientState("testuser")
+	const workers = 16
+	const iterations = 200
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			room := fmt.Sprintf("room-%d", w)
+			for i := 0; i < iterations; i++ {
+				clientState.TrackMessageSent()
+				clientState.TrackMessageReceived()
+				clientState.TrackHeartbeatSent()
+				clientState.TrackHeartbeatReceived()
+				clientState.SetConnected(i%2 == 0)
+				clientState.SetUsername(fmt.Sprintf("user-%d", w))
+				clientState.SetClientID(room)
+				clientState.AddJoinedRoom(room)
+				clientState.SetCurrentRoom(room)
+				clientState.AddConnectionError("hammer")
+				clientState.SetLastReconnectAttempt(time.Now())
+				clientState.RequestReconnect("hammer")
+				clientState.Send("global_message", "hello")
+
+				_ = clientState.IsConnected()
+				_ = clientState.Client()
+				_ = clientState.GetUsername()
+				_ = clientState.GetCurrentRoom()
+				_ = clientState.GetJoinedRooms()
+				_ = clientState.GetConnectionErrors()
+				_ = clientState.GetLastServerActivity()
+				_ = clientState.GetStats()
+				if i%50 == 0 {
+					clientState.RemoveJoinedRoom(room)
+					clientState.Outbox().Clear()
+				}
+			}
+		}(w)
+	}
+
+	// Drain reconnect requests like the supervisor would
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-clientState.ReconnectRequests():
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	wg.Wait()
+	close(done)
+
+	stats := clientState.Snapshot()
+	expected := workers * iterations
+	if stats.MessagesReceived != expected {
+		t.Errorf("Expected %d messages received, got %d", expected, stats.MessagesReceived)
+	}
+	if stats.HeartbeatsSent != expected || stats.HeartbeatsReceived != expected {
+		t.Errorf("Expected %d heartbeats each way, got %d sent and %d received",
+			expected, stats.HeartbeatsSent, stats.HeartbeatsReceived)
+	}
+	if stats.ReconnectAttempts != expected {
+		t.Errorf("Expected %d reconnect attempts, got %d", expected, stats.ReconnectAttempts)
+	}
+	// Sends never reach a client in this test, so only TrackMessageSent counts
+	if stats.MessagesSent != expected {
+		t.Errorf("Expected %d messages sent, got %d", expected, stats.MessagesSent)
+	}
+	if len(clientState.GetConnectionErrors()) != 10 {
+		t.Errorf("Expected connection error history to stay capped at 10")
+	}
+}
+
+func TestSnapshotIsConsistent(t *testing.T) {
+	clientState := NewClientState("testuser")
+	clientState.SetConnected(true)
+	clientState.TrackMessageSent()
+	clientState.TrackMessageSent()
+	clientState.AddJoinedRoom("group-1")
+	clientState.Send("global_message", "queued") // No client, so it is queued
+
+	stats := clientState.Snapshot()
+	if !stats.Connected || stats.MessagesSent != 2 || stats.QueuedMessages != 1 {
+		t.Errorf("Unexpected snapshot: %+v", stats)
+	}
+
+	// The snapshot is a copy and must not change with the state
+	clientState.AddJoinedRoom("group-2")
+	if len(stats.JoinedRooms) != 1 {
+		t.Errorf("Expected snapshot rooms to be unaffected, got %v", stats.JoinedRooms)
+	}
+	if !strings.Contains(stats.String(), "Queued Messages: 1") {
+		t.Errorf("Expected stats string to mention queued messages, got %q", stats.String())
+	}
+}
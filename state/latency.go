@@ -0,0 +1,241 @@
+package state
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jonipwi/go-chat-client/utils"
+)
+
+// Latency defaults used by NewClientState
+const (
+	DefaultLatencyWindow = 100             // Round trips kept for the statistics
+	DefaultProbeTimeout  = 5 * time.Second // How long a probe waits for its reply before it counts as lost
+)
+
+// Probe kinds
+const (
+	ProbePing      = "ping"
+	ProbeHeartbeat = "heartbeat"
+)
+
+// Probe is a timestamped ping or heartbeat waiting for the server's reply
+type Probe struct {
+	ID     string
+	Kind   string
+	SentAt time.Time
+
+	done chan struct{}
+	rtt  time.Duration
+	lost bool
+}
+
+// Payload returns the extra argument sent along with the probe so the
+// server can echo it back in its reply
+func (p *Probe) Payload() map[string]interface{} {
+	return map[string]interface{}{
+		"probe_id": p.ID,
+		"sent_at":  p.SentAt.UnixMilli(),
+	}
+}
+
+// Done is closed once the reply arrives or the probe times out
+func (p *Probe) Done() <-chan struct{} {
+	return p.done
+}
+
+// Wait blocks until the probe is answered or lost. It returns the round-trip
+// time and whether a reply arrived.
+func (p *Probe) Wait() (time.Duration, bool) {
+	<-p.done
+	return p.rtt, !p.lost
+}
+
+// LatencyStats summarises the round trips in the sliding window
+type LatencyStats struct {
+	Samples int
+	Lost    int // Probes that timed out since the client started
+	Last    time.Duration
+	Min     time.Duration
+	Avg     time.Duration
+	Max     time.Duration
+	P95     time.Duration
+	Jitter  time.Duration // Mean difference between consecutive round trips
+}
+
+// String formats the statistics like ping's summary line
+func (s LatencyStats) String() string {
+	ms := func(d time.Duration) string {
+		return fmt.Sprintf("%.1f", float64(d)/float64(time.Millisecond))
+	}
+	return fmt.Sprintf("rtt min/avg/max/p95/jitter = %s/%s/%s/%s/%s ms (%d sample(s), %d lost)",
+		ms(s.Min), ms(s.Avg), ms(s.Max), ms(s.P95), ms(s.Jitter), s.Samples, s.Lost)
+}
+
+// Latency measures round trips to the server over a sliding window of
+// samples. It is safe for concurrent use.
+type Latency struct {
+	mu      sync.Mutex
+	window  []time.Duration
+	size    int
+	timeout time.Duration
+	pending []*Probe
+	lost    int
+	hooks   []func(kind string, rtt time.Duration)
+}
+
+// NewLatency creates a tracker keeping the last size round trips, which
+// counts probes unanswered after timeout as lost
+func NewLatency(size int, timeout time.Duration) *Latency {
+	return &Latency{size: size, timeout: timeout}
+}
+
+// Start registers a probe of the given kind sent now
+func (l *Latency) Start(kind string) *Probe {
+	probe := &Probe{
+		ID:     utils.GenerateRandomID(),
+		Kind:   kind,
+		SentAt: time.Now(),
+		done:   make(chan struct{}),
+	}
+
+	l.mu.Lock()
+	l.pending = append(l.pending, probe)
+	l.mu.Unlock()
+
+	time.AfterFunc(l.timeout, func() { l.expire(probe) })
+	return probe
+}
+
+// OnSample registers fn to be called with every round trip measured
+func (l *Latency) OnSample(fn func(kind string, rtt time.Duration)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.hooks = append(l.hooks, fn)
+}
+
+// Complete records the reply to a probe received at t. The probe is looked
+// up by ID. A reply without one, from a server that does not echo probes,
+// is only matched while exactly one probe of its kind is pending. It
+// returns the round-trip time and whether a probe matched.
+func (l *Latency) Complete(kind, id string, t time.Time) (time.Duration, bool) {
+	probe := l.match(kind, id, t)
+	if probe == nil {
+		return 0, false
+	}
+
+	l.mu.Lock()
+	hooks := append([]func(string, time.Duration){}, l.hooks...)
+	l.mu.Unlock()
+	for _, fn := range hooks {
+		fn(probe.Kind, probe.rtt)
+	}
+	return probe.rtt, true
+}
+
+// match completes and returns the pending probe a reply received at t answers
+func (l *Latency) match(kind, id string, t time.Time) *Probe {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	match := -1
+	for i, probe := range l.pending {
+		switch {
+		case id != "" && probe.ID == id:
+			match = i
+		case id == "" && probe.Kind == kind:
+			if match >= 0 {
+				// Several probes are waiting, there is no telling which one this answers
+				return nil
+			}
+			match = i
+		}
+	}
+	if match < 0 {
+		return nil
+	}
+
+	probe := l.pending[match]
+	l.pending = append(l.pending[:match], l.pending[match+1:]...)
+	probe.rtt = t.Sub(probe.SentAt)
+	l.window = append(l.window, probe.rtt)
+	if len(l.window) > l.size {
+		l.window = l.window[len(l.window)-l.size:]
+	}
+	close(probe.done)
+	return probe
+}
+
+// Cancel forgets a probe that could not be sent, without counting it as lost
+func (l *Latency) Cancel(probe *Probe) {
+	l.drop(probe, false)
+}
+
+// expire marks a probe lost if it is still waiting for a reply
+func (l *Latency) expire(probe *Probe) {
+	l.drop(probe, true)
+}
+
+// drop removes a pending probe that got no reply
+func (l *Latency) drop(probe *Probe, lost bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i, p := range l.pending {
+		if p == probe {
+			l.pending = append(l.pending[:i], l.pending[i+1:]...)
+			if lost {
+				l.lost++
+			}
+			probe.lost = true
+			close(probe.done)
+			return
+		}
+	}
+}
+
+// Stats returns the statistics of the round trips in the window
+func (l *Latency) Stats() LatencyStats {
+	l.mu.Lock()
+	window := append([]time.Duration{}, l.window...)
+	lost := l.lost
+	l.mu.Unlock()
+	return SummarizeLatency(window, lost)
+}
+
+// SummarizeLatency computes the statistics of a series of round trips, in
+// the order they were measured
+func SummarizeLatency(rtts []time.Duration, lost int) LatencyStats {
+	stats := LatencyStats{Samples: len(rtts), Lost: lost}
+	if len(rtts) == 0 {
+		return stats
+	}
+	stats.Last = rtts[len(rtts)-1]
+
+	var total, jitter time.Duration
+	for i, rtt := range rtts {
+		total += rtt
+		if i > 0 {
+			diff := rtt - rtts[i-1]
+			if diff < 0 {
+				diff = -diff
+			}
+			jitter += diff
+		}
+	}
+	stats.Avg = total / time.Duration(len(rtts))
+	if len(rtts) > 1 {
+		stats.Jitter = jitter / time.Duration(len(rtts)-1)
+	}
+
+	sorted := append([]time.Duration{}, rtts...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	stats.Min = sorted[0]
+	stats.Max = sorted[len(sorted)-1]
+	// Nearest-rank percentile
+	rank := (95*len(sorted) + 99) / 100
+	stats.P95 = sorted[rank-1]
+	return stats
+}
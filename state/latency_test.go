@@ -0,0 +1,100 @@
+package state
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLatencyMatchesProbes(t *testing.T) {
+	latency := NewLatency(10, time.Minute)
+
+	ping := latency.Start(ProbePing)
+	heartbeat := latency.Start(ProbeHeartbeat)
+
+	if _, ok := latency.Complete(ProbeHeartbeat, heartbeat.ID, heartbeat.SentAt.Add(30*time.Millisecond)); !ok {
+		t.Fatal("Expected the heartbeat reply to match by ID")
+	}
+	if rtt, ok := heartbeat.Wait(); !ok || rtt != 30*time.Millisecond {
+		t.Errorf("Heartbeat Wait() = %v, %v; expected 30ms, true", rtt, ok)
+	}
+	if _, ok := latency.Complete(ProbeHeartbeat, "", time.Now()); ok {
+		t.Error("Expected a heartbeat without a probe ID not to match with no heartbeat pending")
+	}
+
+	if _, ok := latency.Complete(ProbePing, "unknown-id", time.Now()); ok {
+		t.Error("Expected a reply with an unknown probe ID not to match")
+	}
+	// A pong without an ID only matches while a single ping is waiting
+	second := latency.Start(ProbePing)
+	if _, ok := latency.Complete(ProbePing, "", time.Now()); ok {
+		t.Error("Expected a pong without a probe ID not to match one of two pings")
+	}
+	latency.Cancel(second)
+	if _, ok := latency.Complete(ProbePing, "", ping.SentAt.Add(10*time.Millisecond)); !ok {
+		t.Fatal("Expected a pong without a probe ID to match the only ping")
+	}
+
+	// Heartbeats from a server that does not echo the probe ID are matched the same way
+	echoless := latency.Start(ProbeHeartbeat)
+	if _, ok := latency.Complete(ProbeHeartbeat, "", echoless.SentAt.Add(20*time.Millisecond)); !ok {
+		t.Fatal("Expected a heartbeat without a probe ID to match the only heartbeat")
+	}
+
+	stats := latency.Stats()
+	if stats.Samples != 3 || stats.Min != 10*time.Millisecond || stats.Max != 30*time.Millisecond || stats.Last != 20*time.Millisecond {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestLatencyLostProbes(t *testing.T) {
+	latency := NewLatency(10, 10*time.Millisecond)
+
+	lost := latency.Start(ProbePing)
+	cancelled := latency.Start(ProbePing)
+	latency.Cancel(cancelled)
+
+	if _, ok := lost.Wait(); ok {
+		t.Error("Expected the unanswered probe to be lost")
+	}
+	if _, ok := cancelled.Wait(); ok {
+		t.Error("Expected the cancelled probe to report no reply")
+	}
+	if stats := latency.Stats(); stats.Lost != 1 || stats.Samples != 0 {
+		t.Errorf("Expected one lost probe and no samples, got %+v", stats)
+	}
+}
+
+func TestSummarizeLatency(t *testing.T) {
+	var rtts []time.Duration
+	for i := 1; i <= 20; i++ {
+		rtts = append(rtts, time.Duration(i)*time.Millisecond)
+	}
+	stats := SummarizeLatency(rtts, 2)
+	if stats.Min != time.Millisecond || stats.Max != 20*time.Millisecond {
+		t.Errorf("Unexpected min/max %v/%v", stats.Min, stats.Max)
+	}
+	if stats.Avg != 10500*time.Microsecond {
+		t.Errorf("Avg = %v; expected 10.5ms", stats.Avg)
+	}
+	if stats.P95 != 19*time.Millisecond {
+		t.Errorf("P95 = %v; expected 19ms", stats.P95)
+	}
+	if stats.Jitter != time.Millisecond {
+		t.Errorf("Jitter = %v; expected 1ms", stats.Jitter)
+	}
+	if !strings.Contains(stats.String(), "= 1.0/10.5/20.0/19.0/1.0 ms (20 sample(s), 2 lost)") {
+		t.Errorf("Unexpected summary %q", stats.String())
+	}
+}
+
+func TestLatencyWindowIsBounded(t *testing.T) {
+	latency := NewLatency(3, time.Minute)
+	for i := 1; i <= 5; i++ {
+		probe := latency.Start(ProbePing)
+		latency.Complete(ProbePing, probe.ID, probe.SentAt.Add(time.Duration(i)*time.Millisecond))
+	}
+	if stats := latency.Stats(); stats.Samples != 3 || stats.Min != 3*time.Millisecond {
+		t.Errorf("Expected only the last 3 samples to be kept, got %+v", stats)
+	}
+}
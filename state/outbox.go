@@ -0,0 +1,223 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Outbox defaults used by NewClientState
+const (
+	DefaultOutboxCapacity    = 100
+	DefaultOutboxMaxAge      = 5 * time.Minute
+	DefaultOutboxMaxAttempts = 3
+)
+
+// ErrOutboxFull is returned when a message is queued while the outbox is at capacity
+var ErrOutboxFull = errors.New("outbox is full")
+
+// OutboxStatus is the delivery status of a queued message
+type OutboxStatus string
+
+const (
+	StatusQueued  OutboxStatus = "queued"
+	StatusSent    OutboxStatus = "sent"
+	StatusFailed  OutboxStatus = "failed"
+	StatusExpired OutboxStatus = "expired"
+)
+
+// OutboxItem is a single outbound event and its delivery status
+type OutboxItem struct {
+	ID        int
+	Event     string
+	Args      []interface{}
+	Status    OutboxStatus
+	QueuedAt  time.Time
+	UpdatedAt time.Time
+	Attempts  int
+	LastError string
+}
+
+// String returns a one-line description of the item
+func (item OutboxItem) String() string {
+	desc := fmt.Sprintf("#%d [%s] %s %v (queued %s ago",
+		item.ID, item.Status, item.Event, item.Args,
+		time.Since(item.QueuedAt).Round(time.Second))
+	if item.Attempts > 0 {
+		desc += fmt.Sprintf(", %d attempt(s)", item.Attempts)
+	}
+	if item.LastError != "" {
+		desc += ", last error: " + item.LastError
+	}
+	return desc + ")"
+}
+
+// Outbox is a bounded, ordered buffer of events that could not be sent yet.
+// Items that reach a final status are kept in a short history for inspection.
+type Outbox struct {
+	mu          sync.Mutex
+	pending     []*OutboxItem
+	finished    []*OutboxItem
+	capacity    int
+	maxAge      time.Duration
+	maxAttempts int
+	nextID      int
+}
+
+// NewOutbox creates an outbox holding at most capacity pending items, each for at most maxAge
+func NewOutbox(capacity int, maxAge time.Duration) *Outbox {
+	return &Outbox{
+		capacity:    capacity,
+		maxAge:      maxAge,
+		maxAttempts: DefaultOutboxMaxAttempts,
+		nextID:      1,
+	}
+}
+
+// Enqueue appends an event to the outbox
+func (o *Outbox) Enqueue(event string, args ...interface{}) (OutboxItem, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.expireLocked(time.Now())
+	if len(o.pending) >= o.capacity {
+		return OutboxItem{}, ErrOutboxFull
+	}
+
+	now := time.Now()
+	item := &OutboxItem{
+		ID:        o.nextID,
+		Event:     event,
+		Args:      args,
+		Status:    StatusQueued,
+		QueuedAt:  now,
+		UpdatedAt: now,
+	}
+	o.nextID++
+	o.pending = append(o.pending, item)
+	return *item, nil
+}
+
+// Len returns the number of items waiting to be sent
+func (o *Outbox) Len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.pending)
+}
+
+// Status returns the status of the item with the given ID
+func (o *Outbox) Status(id int) (OutboxStatus, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for _, list := range [][]*OutboxItem{o.pending, o.finished} {
+		for _, item := range list {
+			if item.ID == id {
+				return item.Status, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Items returns the pending items in send order followed by recently finished ones
+func (o *Outbox) Items() []OutboxItem {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.expireLocked(time.Now())
+	items := make([]OutboxItem, 0, len(o.pending)+len(o.finished))
+	for _, item := range o.pending {
+		items = append(items, *item)
+	}
+	for _, item := range o.finished {
+		items = append(items, *item)
+	}
+	return items
+}
+
+// Drop removes a pending item so it is never sent
+func (o *Outbox) Drop(id int) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for i, item := range o.pending {
+		if item.ID == id {
+			o.pending = append(o.pending[:i], o.pending[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Clear drops every pending item and returns how many were removed
+func (o *Outbox) Clear() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	n := len(o.pending)
+	o.pending = nil
+	return n
+}
+
+// Flush sends pending items in order using emit. It stops at the first item
+// that fails but may still be retried, so ordering is preserved; items that
+// exhaust their attempts are marked failed and skipped.
+func (o *Outbox) Flush(emit func(event string, args ...interface{}) error) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	now := time.Now()
+	o.expireLocked(now)
+
+	sent := 0
+	for len(o.pending) > 0 {
+		item := o.pending[0]
+		item.Attempts++
+		item.UpdatedAt = now
+
+		if err := emit(item.Event, item.Args...); err != nil {
+			item.LastError = err.Error()
+			if item.Attempts < o.maxAttempts {
+				return sent, err
+			}
+			o.finishLocked(StatusFailed)
+			continue
+		}
+
+		o.finishLocked(StatusSent)
+		sent++
+	}
+	return sent, nil
+}
+
+// finishLocked moves the head of the queue into the finished history
+func (o *Outbox) finishLocked(status OutboxStatus) {
+	item := o.pending[0]
+	item.Status = status
+	o.pending = o.pending[1:]
+
+	o.finished = append(o.finished, item)
+	if len(o.finished) > o.capacity {
+		o.finished = o.finished[len(o.finished)-o.capacity:]
+	}
+}
+
+// expireLocked marks pending items older than maxAge as expired
+func (o *Outbox) expireLocked(now time.Time) {
+	kept := o.pending[:0]
+	for _, item := range o.pending {
+		if o.maxAge > 0 && now.Sub(item.QueuedAt) > o.maxAge {
+			item.Status = StatusExpired
+			item.UpdatedAt = now
+			o.finished = append(o.finished, item)
+			continue
+		}
+		kept = append(kept, item)
+	}
+	o.pending = kept
+	if len(o.finished) > o.capacity {
+		o.finished = o.finished[len(o.finished)-o.capacity:]
+	}
+}
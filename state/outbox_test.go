@@ -0,0 +1,106 @@
+package state
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestOutboxFlushInOrder(t *testing.T) {
+	outbox := NewOutbox(10, time.Minute)
+	outbox.Enqueue("global_message", "first")
+	outbox.Enqueue("group_message", "room-1", "second")
+
+	var sent []string
+	sentCount, err := outbox.Flush(func(event string, args ...interface{}) error {
+		sent = append(sent, args[len(args)-1].(string))
+		return nil
+	})
+	if err != nil || sentCount != 2 {
+		t.Fatalf("Flush() = %d, %v; expected 2, nil", sentCount, err)
+	}
+	if sent[0] != "first" || sent[1] != "second" {
+		t.Errorf("Expected messages to be sent in order, got %v", sent)
+	}
+	if outbox.Len() != 0 {
+		t.Errorf("Expected outbox to be empty after flush, got %d", outbox.Len())
+	}
+	for _, item := range outbox.Items() {
+		if item.Status != StatusSent {
+			t.Errorf("Expected item #%d to be sent, got %s", item.ID, item.Status)
+		}
+	}
+}
+
+func TestOutboxCapacity(t *testing.T) {
+	outbox := NewOutbox(2, time.Minute)
+	outbox.Enqueue("global_message", "1")
+	outbox.Enqueue("global_message", "2")
+
+	if _, err := outbox.Enqueue("global_message", "3"); !errors.Is(err, ErrOutboxFull) {
+		t.Errorf("Expected ErrOutboxFull, got %v", err)
+	}
+}
+
+func TestOutboxRetryAndFail(t *testing.T) {
+	outbox := NewOutbox(10, time.Minute)
+	first, _ := outbox.Enqueue("global_message", "first")
+	outbox.Enqueue("global_message", "second")
+
+	failing := func(event string, args ...interface{}) error {
+		if args[0] == "first" {
+			return errors.New("write failed")
+		}
+		return nil
+	}
+
+	// The head keeps blocking the queue until it runs out of attempts
+	for i := 1; i < DefaultOutboxMaxAttempts; i++ {
+		if sent, err := outbox.Flush(failing); err == nil || sent != 0 {
+			t.Fatalf("Flush() attempt %d = %d, %v; expected 0 and an error", i, sent, err)
+		}
+	}
+	sent, err := outbox.Flush(failing)
+	if err != nil || sent != 1 {
+		t.Fatalf("Flush() = %d, %v; expected the second message to go out", sent, err)
+	}
+	if status, _ := outbox.Status(first.ID); status != StatusFailed {
+		t.Errorf("Expected first message to be failed, got %s", status)
+	}
+}
+
+func TestOutboxExpireAndDrop(t *testing.T) {
+	outbox := NewOutbox(10, 10*time.Millisecond)
+	old, _ := outbox.Enqueue("global_message", "old")
+	time.Sleep(20 * time.Millisecond)
+	fresh, _ := outbox.Enqueue("global_message", "fresh")
+	dropped, _ := outbox.Enqueue("global_message", "dropped")
+
+	if status, _ := outbox.Status(old.ID); status != StatusExpired {
+		t.Errorf("Expected old message to be expired, got %s", status)
+	}
+	if !outbox.Drop(dropped.ID) {
+		t.Errorf("Expected Drop(%d) to succeed", dropped.ID)
+	}
+	if outbox.Drop(old.ID) {
+		t.Errorf("Expected Drop of an expired message to fail")
+	}
+	if outbox.Len() != 1 {
+		t.Errorf("Expected only #%d to be pending, got %d pending", fresh.ID, outbox.Len())
+	}
+}
+
+func TestSendQueuesWhileOffline(t *testing.T) {
+	clientState := NewClientState("testuser")
+
+	queued, err := clientState.Send("global_message", "hello")
+	if err != nil || !queued {
+		t.Fatalf("Send() = %v, %v; expected message to be queued", queued, err)
+	}
+	if clientState.Outbox().Len() != 1 {
+		t.Errorf("Expected 1 queued message, got %d", clientState.Outbox().Len())
+	}
+	if _, err := clientState.FlushOutbox(); err == nil {
+		t.Errorf("Expected FlushOutbox to fail while disconnected")
+	}
+}
@@ -0,0 +1,172 @@
+package state
+
+import (
+	"sort"
+	"sync"
+)
+
+// User is a chat user as reported by the server
+type User struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Avatar   string `json:"avatar"`
+}
+
+// Name returns the username, or the ID for users known only by ID
+func (u User) Name() string {
+	if u.Username != "" {
+		return u.Username
+	}
+	return u.ID
+}
+
+// matches reports whether u and other refer to the same user. Servers
+// identify users by ID in some events and by username in others.
+func (u User) matches(other User) bool {
+	return (u.ID != "" && u.ID == other.ID) || (u.Username != "" && u.Username == other.Username)
+}
+
+// Presence is the roster of users known to be online, globally and in each
+// room, kept current from the server's user events. It is safe for
+// concurrent use.
+type Presence struct {
+	mu    sync.RWMutex
+	rooms map[string][]User // By room ID, "" for the global roster
+}
+
+// NewPresence creates an empty roster
+func NewPresence() *Presence {
+	return &Presence{rooms: make(map[string][]User)}
+}
+
+// rosterKey maps the names used for global chat to the global roster
+func rosterKey(room string) string {
+	if room == "global" {
+		return ""
+	}
+	return room
+}
+
+// SetOnline replaces the roster of room with users. An empty room sets the
+// global roster.
+func (p *Presence) SetOnline(room string, users []User) {
+	room = rosterKey(room)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	roster := make([]User, 0, len(users))
+	for _, user := range users {
+		if room != "" {
+			// Whoever is in a room is online, and the global roster may know more about them
+			p.rooms[""], user = addUser(p.rooms[""], user)
+		}
+		roster, _ = addUser(roster, user)
+	}
+	p.rooms[room] = roster
+}
+
+// Join records that user came online, in room if it is not empty
+func (p *Presence) Join(room string, user User) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rooms[""], user = addUser(p.rooms[""], user)
+	if room := rosterKey(room); room != "" {
+		p.rooms[room], _ = addUser(p.rooms[room], user)
+	}
+}
+
+// Leave records that user left room, or went offline if room is empty
+func (p *Presence) Leave(room string, user User) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if room := rosterKey(room); room != "" {
+		p.rooms[room] = removeUser(p.rooms[room], user)
+		return
+	}
+	for room, roster := range p.rooms {
+		p.rooms[room] = removeUser(roster, user)
+	}
+}
+
+// Online returns the users online in room, or globally if room is empty,
+// sorted by name
+func (p *Presence) Online(room string) []User {
+	p.mu.RLock()
+	users := append([]User{}, p.rooms[rosterKey(room)]...)
+	p.mu.RUnlock()
+
+	sort.Slice(users, func(i, j int) bool { return users[i].Name() < users[j].Name() })
+	return users
+}
+
+// IsOnline reports whether the user with the given ID or username is online
+func (p *Presence) IsOnline(user string) bool {
+	if user == "" {
+		return false
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, known := range p.rooms[""] {
+		if known.ID == user || known.Username == user {
+			return true
+		}
+	}
+	return false
+}
+
+// Lookup returns the user with the given ID or username from any roster
+func (p *Presence) Lookup(user string) (User, bool) {
+	if user == "" {
+		return User{}, false
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, roster := range p.rooms {
+		for _, known := range roster {
+			if known.ID == user || known.Username == user {
+				return known, true
+			}
+		}
+	}
+	return User{}, false
+}
+
+// Clear forgets every roster, as nothing is known about presence while disconnected
+func (p *Presence) Clear() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rooms = make(map[string][]User)
+}
+
+// addUser returns roster with user in it, merging what is known if it was
+// already there, and the user as now recorded
+func addUser(roster []User, user User) ([]User, User) {
+	for i, known := range roster {
+		if !known.matches(user) {
+			continue
+		}
+		if user.ID != "" {
+			known.ID = user.ID
+		}
+		if user.Username != "" {
+			known.Username = user.Username
+		}
+		if user.Avatar != "" {
+			known.Avatar = user.Avatar
+		}
+		roster[i] = known
+		return roster, known
+	}
+	return append(roster, user), user
+}
+
+// removeUser returns roster without user
+func removeUser(roster []User, user User) []User {
+	kept := roster[:0]
+	for _, known := range roster {
+		if !known.matches(user) {
+			kept = append(kept, known)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,52 @@
+package state
+
+import "testing"
+
+func TestPresence(t *testing.T) {
+	p := NewPresence()
+	p.SetOnline("", []User{{ID: "u-1", Username: "alice"}, {ID: "u-2", Username: "bob"}})
+	p.SetOnline("room-1", []User{{Username: "bob"}, {Username: "carol"}})
+	p.Join("room-2", User{ID: "u-1"})
+
+	if !p.IsOnline("alice") || !p.IsOnline("u-2") || !p.IsOnline("carol") {
+		t.Error("Expected users in the global roster and in rooms to be online")
+	}
+	if p.IsOnline("dave") || p.IsOnline("") {
+		t.Error("Expected unknown users not to be online")
+	}
+	if user, ok := p.Lookup("u-2"); !ok || user.Username != "bob" {
+		t.Errorf("Lookup(u-2) = %+v, %v; expected bob", user, ok)
+	}
+	if user, ok := p.Lookup("carol"); !ok || user.Username != "carol" {
+		t.Errorf("Lookup(carol) = %+v, %v; expected carol", user, ok)
+	}
+	if _, ok := p.Lookup("dave"); ok {
+		t.Error("Expected Lookup of an unknown user to fail")
+	}
+
+	room := p.Online("room-1")
+	if len(room) != 2 || room[0] != (User{ID: "u-2", Username: "bob"}) || room[1].Username != "carol" {
+		t.Errorf("Online(room-1) = %+v; expected bob, known globally by ID, and carol", room)
+	}
+	if room := p.Online("room-2"); len(room) != 1 || room[0].Username != "alice" {
+		t.Errorf("Online(room-2) = %+v; expected alice", room)
+	}
+	if len(p.Online("global")) != 3 {
+		t.Errorf("Online(global) = %+v; expected the global roster", p.Online("global"))
+	}
+
+	// Leaving a room keeps the user online, leaving without a room does not
+	p.Leave("room-1", User{Username: "carol"})
+	if len(p.Online("room-1")) != 1 || !p.IsOnline("carol") {
+		t.Errorf("After carol left room-1: room %+v, online %v", p.Online("room-1"), p.IsOnline("carol"))
+	}
+	p.Leave("", User{ID: "u-2"})
+	if p.IsOnline("bob") || len(p.Online("room-1")) != 0 {
+		t.Errorf("Expected bob to be offline everywhere, room-1 has %+v", p.Online("room-1"))
+	}
+
+	p.Clear()
+	if p.IsOnline("alice") || len(p.Online("room-2")) != 0 {
+		t.Error("Expected Clear to empty every roster")
+	}
+}
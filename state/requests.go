@@ -0,0 +1,206 @@
+package state
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jonipwi/go-chat-client/utils"
+)
+
+// DefaultRequestTimeout is how long a request waits for the server to answer
+const DefaultRequestTimeout = 10 * time.Second
+
+// RequestStatus is the outcome of a request sent to the server
+type RequestStatus string
+
+const (
+	RequestPending  RequestStatus = "pending"
+	RequestAcked    RequestStatus = "acked"
+	RequestRejected RequestStatus = "rejected"
+	RequestTimedOut RequestStatus = "timed out"
+)
+
+// RequestResult is the server's answer to a request
+type RequestResult struct {
+	Status RequestStatus
+	Error  string          // Reason given by the server when the request was rejected
+	Data   json.RawMessage // Payload of the acknowledgement, if any
+}
+
+// Request is an emitted event waiting for the server's acknowledgement
+type Request struct {
+	ID     string
+	Event  string
+	SentAt time.Time
+
+	done      chan struct{}
+	result    RequestResult
+	onResolve func(RequestResult) // Runs before Done is closed, may be nil
+}
+
+// Done is closed once the request is acknowledged, rejected or timed out
+func (r *Request) Done() <-chan struct{} {
+	return r.done
+}
+
+// Wait blocks until the request is resolved and returns the result
+func (r *Request) Wait() RequestResult {
+	<-r.done
+	return r.result
+}
+
+// Requests correlates emitted events with the acknowledgements the server
+// sends back, by request ID. It is safe for concurrent use.
+type Requests struct {
+	mu      sync.Mutex
+	pending map[string]*Request
+	timeout time.Duration
+}
+
+// NewRequests creates a tracker that times requests out after timeout
+func NewRequests(timeout time.Duration) *Requests {
+	return &Requests{
+		pending: make(map[string]*Request),
+		timeout: timeout,
+	}
+}
+
+// Track registers a new request for event under a fresh ID and starts its timeout
+func (rs *Requests) Track(event string) *Request {
+	return rs.track(event, nil)
+}
+
+// track is Track with a function applying the result before anyone waiting
+// on the request sees it
+func (rs *Requests) track(event string, onResolve func(RequestResult)) *Request {
+	req := &Request{
+		ID:        utils.GenerateRandomID(),
+		Event:     event,
+		SentAt:    time.Now(),
+		done:      make(chan struct{}),
+		onResolve: onResolve,
+	}
+
+	rs.mu.Lock()
+	rs.pending[req.ID] = req
+	rs.mu.Unlock()
+
+	time.AfterFunc(rs.timeout, func() {
+		rs.Resolve(req.ID, RequestResult{Status: RequestTimedOut})
+	})
+	return req
+}
+
+// Resolve completes the pending request with the given ID. It reports false
+// if no such request is waiting, e.g. because it already timed out.
+func (rs *Requests) Resolve(id string, result RequestResult) bool {
+	rs.mu.Lock()
+	req, ok := rs.pending[id]
+	delete(rs.pending, id)
+	rs.mu.Unlock()
+
+	if !ok {
+		return false
+	}
+	req.result = result
+	if req.onResolve != nil {
+		req.onResolve(result)
+	}
+	close(req.done)
+	return true
+}
+
+// Pending returns the number of requests waiting for an answer
+func (rs *Requests) Pending() int {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return len(rs.pending)
+}
+
+// ackPayload is the object form of an acknowledgement
+type ackPayload struct {
+	RequestID string `json:"request_id"`
+	OK        *bool  `json:"ok"`
+	Status    string `json:"status"`
+	Error     string `json:"error"`
+	Message   string `json:"message"`
+}
+
+// reason returns why the server rejected the request
+func (ack ackPayload) reason() string {
+	if ack.Error != "" {
+		return ack.Error
+	}
+	if ack.Message != "" {
+		return ack.Message
+	}
+	return "rejected by server"
+}
+
+// ParseAck interprets the arguments of an acknowledgement. It accepts
+// Node-style (err, data) pairs, objects such as {"request_id": ..., "ok":
+// false, "error": "name taken"}, booleans, and any other value as a plain
+// success. It returns the request ID if the payload carries one.
+func ParseAck(args []json.RawMessage) (string, RequestResult) {
+	result := RequestResult{Status: RequestAcked}
+	if len(args) == 0 {
+		return "", result
+	}
+	if len(args) >= 2 {
+		// (err, data): a null error means success
+		if err := strings.TrimSpace(string(args[0])); err != "" && err != "null" {
+			return "", RequestResult{Status: RequestRejected, Error: ackError(args[0])}
+		}
+		result.Data = args[1]
+		return "", result
+	}
+
+	raw := args[0]
+	result.Data = raw
+	if strings.TrimSpace(string(raw)) == "false" {
+		return "", RequestResult{Status: RequestRejected, Error: "rejected by server"}
+	}
+	var ack ackPayload
+	if json.Unmarshal(raw, &ack) != nil {
+		return "", result
+	}
+	if ack.Error != "" || (ack.OK != nil && !*ack.OK) ||
+		strings.EqualFold(ack.Status, "error") || strings.EqualFold(ack.Status, "rejected") {
+		result = RequestResult{Status: RequestRejected, Error: ack.reason(), Data: raw}
+	}
+	return ack.RequestID, result
+}
+
+// ParseRequestError interprets an error event payload such as
+// {"request_id": ..., "message": "name taken"}. It returns an empty ID if
+// the error does not refer to a request.
+func ParseRequestError(raw json.RawMessage) (string, RequestResult) {
+	var ack ackPayload
+	if json.Unmarshal(raw, &ack) != nil || ack.RequestID == "" {
+		return "", RequestResult{}
+	}
+	return ack.RequestID, RequestResult{Status: RequestRejected, Error: ack.reason(), Data: raw}
+}
+
+// ackError returns the message of an error sent as a string or as {"message": ...}
+func ackError(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var obj struct {
+		Message string `json:"message"`
+		Error   string `json:"error"`
+	}
+	if json.Unmarshal(raw, &obj) == nil {
+		if obj.Message != "" {
+			return obj.Message
+		}
+		if obj.Error != "" {
+			return obj.Error
+		}
+	}
+	return string(raw)
+}
@@ -0,0 +1,82 @@
+package state
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestRequestsResolveAndTimeout(t *testing.T) {
+	requests := NewRequests(20 * time.Millisecond)
+
+	acked := requests.Track("create_room")
+	timedOut := requests.Track("join_room")
+	if acked.ID == timedOut.ID || len(acked.ID) != 36 {
+		t.Fatalf("Expected distinct UUID request IDs, got %q and %q", acked.ID, timedOut.ID)
+	}
+
+	if !requests.Resolve(acked.ID, RequestResult{Status: RequestAcked}) {
+		t.Fatal("Expected the pending request to be resolved")
+	}
+	if result := acked.Wait(); result.Status != RequestAcked {
+		t.Errorf("Expected acked, got %s", result.Status)
+	}
+	if requests.Resolve(acked.ID, RequestResult{Status: RequestRejected}) {
+		t.Error("Expected a request to be resolved only once")
+	}
+
+	select {
+	case <-timedOut.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Request did not time out")
+	}
+	if result := timedOut.Wait(); result.Status != RequestTimedOut {
+		t.Errorf("Expected timed out, got %s", result.Status)
+	}
+	if requests.Pending() != 0 {
+		t.Errorf("Expected no pending requests, got %d", requests.Pending())
+	}
+}
+
+func TestParseAck(t *testing.T) {
+	raw := func(values ...string) []json.RawMessage {
+		args := make([]json.RawMessage, len(values))
+		for i, v := range values {
+			args[i] = json.RawMessage(v)
+		}
+		return args
+	}
+
+	tests := []struct {
+		args   []json.RawMessage
+		id     string
+		status RequestStatus
+		reason string
+	}{
+		{nil, "", RequestAcked, ""},
+		{raw(`"created"`), "", RequestAcked, ""},
+		{raw(`null`), "", RequestAcked, ""},
+		{raw(`false`), "", RequestRejected, "rejected by server"},
+		{raw(`null`, `{"id":"room-1"}`), "", RequestAcked, ""},
+		{raw(`"name taken"`, `null`), "", RequestRejected, "name taken"},
+		{raw(`{"message":"no such room"}`, `null`), "", RequestRejected, "no such room"},
+		{raw(`{"request_id":"r1","ok":true}`), "r1", RequestAcked, ""},
+		{raw(`{"request_id":"r2","ok":false,"error":"name taken"}`), "r2", RequestRejected, "name taken"},
+		{raw(`{"request_id":"r3","status":"error"}`), "r3", RequestRejected, "rejected by server"},
+	}
+	for _, tt := range tests {
+		id, result := ParseAck(tt.args)
+		if id != tt.id || result.Status != tt.status || result.Error != tt.reason {
+			t.Errorf("ParseAck(%s) = %q, %s %q; expected %q, %s %q",
+				tt.args, id, result.Status, result.Error, tt.id, tt.status, tt.reason)
+		}
+	}
+
+	id, result := ParseRequestError(json.RawMessage(`{"request_id":"r4","message":"not allowed"}`))
+	if id != "r4" || result.Status != RequestRejected || result.Error != "not allowed" {
+		t.Errorf("ParseRequestError() = %q, %+v", id, result)
+	}
+	if id, _ := ParseRequestError(json.RawMessage(`{"message":"boom"}`)); id != "" {
+		t.Errorf("Expected an error without a request ID to be ignored, got %q", id)
+	}
+}
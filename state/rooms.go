@@ -0,0 +1,111 @@
+package state
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Room types
+const (
+	RoomGroup = "group"
+	RoomGuild = "guild"
+)
+
+// Room describes a group or guild as reported by the server
+type Room struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Members   []string  `json:"members"`
+}
+
+// RoomRegistry remembers what the server has told the client about each
+// room, so messages can be sent with the event matching the room's type.
+// It is safe for concurrent use.
+type RoomRegistry struct {
+	mu    sync.RWMutex
+	rooms map[string]Room
+}
+
+// NewRoomRegistry creates an empty registry
+func NewRoomRegistry() *RoomRegistry {
+	return &RoomRegistry{rooms: make(map[string]Room)}
+}
+
+// Update records room. Fields the update leaves empty keep what was known
+// before, so a bare room ID never erases a type learnt earlier.
+func (r *RoomRegistry) Update(room Room) {
+	if room.ID == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	known, ok := r.rooms[room.ID]
+	if !ok {
+		r.rooms[room.ID] = room
+		return
+	}
+	if room.Name != "" {
+		known.Name = room.Name
+	}
+	if room.Type != "" {
+		known.Type = room.Type
+	}
+	if !room.CreatedAt.IsZero() {
+		known.CreatedAt = room.CreatedAt
+	}
+	if room.Members != nil {
+		known.Members = room.Members
+	}
+	r.rooms[room.ID] = known
+}
+
+// Get returns what is known about the room with the given ID
+func (r *RoomRegistry) Get(id string) (Room, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	room, ok := r.rooms[id]
+	return room, ok
+}
+
+// Type returns the type of the room with the given ID, or "" if it is not known
+func (r *RoomRegistry) Type(id string) string {
+	room, _ := r.Get(id)
+	return room.Type
+}
+
+// List returns the known rooms sorted by type, then ID
+func (r *RoomRegistry) List() []Room {
+	r.mu.RLock()
+	rooms := make([]Room, 0, len(r.rooms))
+	for _, room := range r.rooms {
+		rooms = append(rooms, room)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(rooms, func(i, j int) bool {
+		if rooms[i].Type != rooms[j].Type {
+			return rooms[i].Type < rooms[j].Type
+		}
+		return rooms[i].ID < rooms[j].ID
+	})
+	return rooms
+}
+
+// roomFromAck returns the room described by the data of an acknowledgement,
+// if the server sent one
+func roomFromAck(data json.RawMessage) (Room, bool) {
+	var wire struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+		Type string `json:"type"`
+	}
+	if json.Unmarshal(data, &wire) != nil || wire.ID == "" {
+		return Room{}, false
+	}
+	return Room{ID: wire.ID, Name: wire.Name, Type: wire.Type}, true
+}
@@ -0,0 +1,65 @@
+package state
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRoomRegistryMergesUpdates(t *testing.T) {
+	rooms := NewRoomRegistry()
+	rooms.Update(Room{ID: "g1", Name: "Builders", Type: RoomGuild})
+	rooms.Update(Room{ID: "g1"}) // A bare ID keeps what was known
+	rooms.Update(Room{ID: "r1", Type: RoomGroup})
+	rooms.Update(Room{ID: "r1", Name: "Release"})
+	rooms.Update(Room{}) // Ignored
+
+	if room, ok := rooms.Get("g1"); !ok || room.Name != "Builders" || room.Type != RoomGuild {
+		t.Errorf("Get(g1) = %+v, %v; expected the guild to keep its name and type", room, ok)
+	}
+	if room, _ := rooms.Get("r1"); room.Name != "Release" || room.Type != RoomGroup {
+		t.Errorf("Get(r1) = %+v; expected the updates to be merged", room)
+	}
+	if rooms.Type("unknown") != "" {
+		t.Error("Expected an unknown room to have no type")
+	}
+
+	list := rooms.List()
+	if len(list) != 2 || list[0].ID != "r1" || list[1].ID != "g1" {
+		t.Errorf("List() = %+v; expected groups before guilds", list)
+	}
+}
+
+func TestSendToRoomUsesRoomType(t *testing.T) {
+	cs := NewClientState("testuser")
+	cs.Rooms().Update(Room{ID: "builders", Type: RoomGuild})
+	cs.Rooms().Update(Room{ID: "demo-guild-1", Type: RoomGroup})
+
+	for _, room := range []string{"builders", "demo-guild-1", "unknown", ""} {
+		if _, err := cs.SendToRoom(room, "hi"); err != nil {
+			t.Fatalf("SendToRoom(%q) error: %v", room, err)
+		}
+	}
+
+	expected := []string{"guild_message", "group_message", "group_message", "global_message"}
+	items := cs.Outbox().Items()
+	if len(items) != len(expected) {
+		t.Fatalf("Expected %d queued messages, got %v", len(expected), items)
+	}
+	for i, event := range expected {
+		if items[i].Event != event {
+			t.Errorf("Message %d was queued as %s; expected %s", i, items[i].Event, event)
+		}
+	}
+}
+
+func TestRoomFromAck(t *testing.T) {
+	room, ok := roomFromAck(json.RawMessage(`{"id":"r-42","name":"Builders","type":"guild","created_at":1700000000000}`))
+	if !ok || room.ID != "r-42" || room.Type != RoomGuild {
+		t.Errorf("roomFromAck = %+v, %v; expected the guild", room, ok)
+	}
+	for _, data := range []string{`null`, `"created"`, `{"ok":true}`} {
+		if _, ok := roomFromAck(json.RawMessage(data)); ok {
+			t.Errorf("roomFromAck(%s) should not find a room", data)
+		}
+	}
+}
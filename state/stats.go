@@ -0,0 +1,137 @@
+package state
+
+import (
+	"fmt"
+	"time"
+)
+
+// Stats is a consistent point-in-time copy of the client statistics
+type Stats struct {
+	Connected             bool
+	Duration              time.Duration
+	ClientID              string
+	Username              string
+	CurrentRoom           string
+	JoinedRooms           []string
+	MessagesSent          int
+	MessagesReceived      int
+	HeartbeatsSent        int
+	HeartbeatsReceived    int
+	LastHeartbeatSent     time.Time
+	LastHeartbeatReceived time.Time
+	LastActivity          time.Time
+	LastServerActivity    time.Time
+	LastReconnectAttempt  time.Time
+	ReconnectAttempts     int
+	Reconnects            int
+	ConnectionErrors      int // Errors in the history, at most 10
+	ConnectionErrorsTotal int
+	EmitFailures          map[string]int // Failed emits by event name
+	AuthErrors            int
+	QueuedMessages        int
+	Latency               LatencyStats
+	TakenAt               time.Time
+}
+
+// Snapshot returns the current statistics. Those of the state are read
+// under a single lock; the outbox and latency have locks of their own and
+// are read first, as taking them while holding the state's lock could
+// deadlock with an outbox flush.
+func (cs *ClientState) Snapshot() Stats {
+	queued := cs.outbox.Len()
+	latency := cs.latency.Stats()
+
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	now := time.Now()
+	stats := Stats{
+		Connected:             cs.connected,
+		ClientID:              cs.clientID,
+		Username:              cs.username,
+		CurrentRoom:           cs.currentRoom,
+		JoinedRooms:           append([]string{}, cs.joinedRooms...),
+		MessagesSent:          cs.messagesSent,
+		MessagesReceived:      cs.messagesReceived,
+		HeartbeatsSent:        cs.heartbeatsSent,
+		HeartbeatsReceived:    cs.heartbeatsReceived,
+		LastHeartbeatSent:     cs.lastHeartbeatSent,
+		LastHeartbeatReceived: cs.lastHeartbeatReceived,
+		LastActivity:          cs.lastActivity,
+		LastServerActivity:    cs.lastServerActivity,
+		LastReconnectAttempt:  cs.lastReconnectAttempt,
+		ReconnectAttempts:     cs.reconnectAttempts,
+		Reconnects:            cs.reconnects,
+		ConnectionErrors:      len(cs.connectionErrors),
+		ConnectionErrorsTotal: cs.connectionErrorsTotal,
+		EmitFailures:          make(map[string]int, len(cs.emitFailures)),
+		AuthErrors:            cs.authErrors,
+		QueuedMessages:        queued,
+		Latency:               latency,
+		TakenAt:               now,
+	}
+
+	for event, n := range cs.emitFailures {
+		stats.EmitFailures[event] = n
+	}
+
+	if cs.connected {
+		stats.Duration = now.Sub(cs.connectionStarted)
+	} else if !cs.connectionStarted.IsZero() {
+		stats.Duration = cs.lastActivity.Sub(cs.connectionStarted)
+	}
+	return stats
+}
+
+// GetStats returns a formatted string of connection statistics
+func (cs *ClientState) GetStats() string {
+	return cs.Snapshot().String()
+}
+
+// String formats the statistics on a single line
+func (s Stats) String() string {
+	connStatus := "Disconnected"
+	if s.Connected {
+		connStatus = "Connected"
+	}
+
+	timeSinceLastHeartbeatSent := s.since(s.LastHeartbeatSent)
+	timeSinceLastHeartbeatReceived := s.since(s.LastHeartbeatReceived)
+
+	// Add reconnection info
+	var reconnInfo string
+	if !s.LastReconnectAttempt.IsZero() {
+		reconnInfo = fmt.Sprintf(", Reconnect Attempts: %d, Reconnects: %d, Last reconnect attempt: %s ago",
+			s.ReconnectAttempts, s.Reconnects, s.since(s.LastReconnectAttempt))
+	}
+
+	var authInfo string
+	if s.AuthErrors > 0 {
+		authInfo = fmt.Sprintf(", Auth Errors: %d", s.AuthErrors)
+	}
+
+	var queueInfo string
+	if s.QueuedMessages > 0 {
+		queueInfo = fmt.Sprintf(", Queued Messages: %d", s.QueuedMessages)
+	}
+
+	var latencyInfo string
+	if s.Latency.Samples > 0 || s.Latency.Lost > 0 {
+		latencyInfo = ", Latency: " + s.Latency.String()
+	}
+
+	return fmt.Sprintf("Status: %s, Duration: %v, Client ID: %s, Username: %s, "+
+		"Messages Sent: %d, Messages Received: %d, Heartbeats Sent: %d, Heartbeats Received: %d, "+
+		"Time Since Last Heartbeat Sent: %s, Time Since Last Heartbeat Received: %s%s%s%s%s",
+		connStatus, s.Duration.Round(time.Second), s.ClientID, s.Username,
+		s.MessagesSent, s.MessagesReceived, s.HeartbeatsSent, s.HeartbeatsReceived,
+		timeSinceLastHeartbeatSent, timeSinceLastHeartbeatReceived, reconnInfo, authInfo, queueInfo, latencyInfo)
+}
+
+// since formats the time elapsed between t and the snapshot, or "Never" for a zero time
+func (s Stats) since(t time.Time) string {
+	if t.IsZero() {
+		return "Never"
+	}
+	return s.TakenAt.Sub(t).Round(time.Second).String()
+}
@@ -0,0 +1,249 @@
+package state
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Typing defaults used by NewClientState
+const (
+	DefaultTypingIdle   = 3 * time.Second // How long after the last keystroke "stop typing" is sent
+	DefaultTypingExpiry = 6 * time.Second // How long another user shows as typing without hearing from them again
+)
+
+// Typing events
+const (
+	EventTyping     = "typing"
+	EventStopTyping = "stop typing"
+)
+
+// Typing keeps track of typing indicators in both directions: the ones sent
+// while the user composes a message and the ones received from other users.
+// Rooms are identified by ID, "" for global chat. It is safe for concurrent use.
+type Typing struct {
+	mu     sync.Mutex
+	idle   time.Duration
+	expiry time.Duration
+	emit   func(event, room string)
+
+	// Sent
+	room   string // Room the user is typing in
+	typing bool
+	sentAt time.Time
+	stop   *time.Timer
+	idleID int // Identifies the latest idle timer
+
+	// Received, by room, then user name
+	typists   map[string]map[string]*typist
+	listeners []func(room string)
+}
+
+// NewTyping creates a tracker that sends "stop typing" after idle without
+// keystrokes and forgets other users' typing after expiry. emit sends a
+// typing event; it is called without the tracker's lock held.
+func NewTyping(idle, expiry time.Duration, emit func(event, room string)) *Typing {
+	return &Typing{
+		idle:    idle,
+		expiry:  expiry,
+		emit:    emit,
+		typists: make(map[string]map[string]*typist),
+	}
+}
+
+// typist is another user shown as typing until expire fires
+type typist struct {
+	expire *time.Timer
+}
+
+// Keystroke records that the user is composing a message in room. The first
+// keystroke sends "typing"; later ones only repeat it every half expiry, so
+// other clients keep showing the indicator without being flooded.
+func (t *Typing) Keystroke(room string) {
+	room = rosterKey(room)
+	type send struct{ event, room string }
+	var sends []send
+
+	t.mu.Lock()
+	if t.typing && t.room != room {
+		// Moved to another room: the old one is done with
+		sends = append(sends, send{EventStopTyping, t.room})
+		t.typing = false
+	}
+	now := time.Now()
+	if !t.typing || now.Sub(t.sentAt) >= t.expiry/2 {
+		sends = append(sends, send{EventTyping, room})
+		t.sentAt = now
+	}
+	t.typing, t.room = true, room
+	if t.stop != nil {
+		t.stop.Stop()
+	}
+	t.idleID++
+	idleID := t.idleID
+	t.stop = time.AfterFunc(t.idle, func() { t.finish(idleID) })
+	t.mu.Unlock()
+
+	for _, s := range sends {
+		t.emit(s.event, s.room)
+	}
+}
+
+// Stop sends "stop typing" if the user was typing, as when a message is sent
+// or the input is cleared
+func (t *Typing) Stop() {
+	t.finish(0)
+}
+
+// finish sends "stop typing" if the user was typing. Idle timers pass their
+// ID, so they do nothing once a later keystroke replaced them.
+func (t *Typing) finish(idleID int) {
+	t.mu.Lock()
+	if !t.typing || (idleID != 0 && idleID != t.idleID) {
+		t.mu.Unlock()
+		return
+	}
+	room := t.room
+	t.reset()
+	t.mu.Unlock()
+
+	t.emit(EventStopTyping, room)
+}
+
+// IsTyping reports whether the user is typing, and in which room
+func (t *Typing) IsTyping() (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.room, t.typing
+}
+
+// reset forgets that the user was typing. The caller holds the lock.
+func (t *Typing) reset() {
+	t.typing, t.room = false, ""
+	if t.stop != nil {
+		t.stop.Stop()
+		t.stop = nil
+	}
+}
+
+// SetTyping records whether user is typing in room. A user shown as typing
+// is forgotten after the expiry unless they are heard from again.
+func (t *Typing) SetTyping(room, user string, typing bool) {
+	if user == "" {
+		return
+	}
+	room = rosterKey(room)
+
+	t.mu.Lock()
+	changed := t.remove(room, user)
+	if typing {
+		if t.typists[room] == nil {
+			t.typists[room] = make(map[string]*typist)
+		}
+		entry := &typist{}
+		entry.expire = time.AfterFunc(t.expiry, func() { t.expire(room, user, entry) })
+		t.typists[room][user] = entry
+		changed = true
+	}
+	listeners := t.listeners
+	t.mu.Unlock()
+
+	if changed {
+		notify(listeners, room)
+	}
+}
+
+// expire forgets that user is typing in room, unless they were heard from
+// again since entry was recorded
+func (t *Typing) expire(room, user string, entry *typist) {
+	t.mu.Lock()
+	if t.typists[room][user] != entry {
+		t.mu.Unlock()
+		return
+	}
+	t.remove(room, user)
+	listeners := t.listeners
+	t.mu.Unlock()
+
+	notify(listeners, room)
+}
+
+// remove forgets user typing in room and reports whether they were. The
+// caller holds the lock.
+func (t *Typing) remove(room, user string) bool {
+	entry, ok := t.typists[room][user]
+	if !ok {
+		return false
+	}
+	entry.expire.Stop()
+	delete(t.typists[room], user)
+	if len(t.typists[room]) == 0 {
+		delete(t.typists, room)
+	}
+	return true
+}
+
+// Typists returns the names of the users typing in room, sorted
+func (t *Typing) Typists(room string) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	names := make([]string, 0, len(t.typists[rosterKey(room)]))
+	for name := range t.typists[rosterKey(room)] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Forget stops showing user as typing anywhere, as when they leave or go offline
+func (t *Typing) Forget(user string) {
+	t.mu.Lock()
+	var rooms []string
+	for room := range t.typists {
+		if t.remove(room, user) {
+			rooms = append(rooms, room)
+		}
+	}
+	listeners := t.listeners
+	t.mu.Unlock()
+
+	for _, room := range rooms {
+		notify(listeners, room)
+	}
+}
+
+// Clear forgets all typing state without sending anything, as nothing can be
+// sent or received while disconnected
+func (t *Typing) Clear() {
+	t.mu.Lock()
+	t.reset()
+	var rooms []string
+	for room, typists := range t.typists {
+		for _, entry := range typists {
+			entry.expire.Stop()
+		}
+		rooms = append(rooms, room)
+	}
+	t.typists = make(map[string]map[string]*typist)
+	listeners := t.listeners
+	t.mu.Unlock()
+
+	for _, room := range rooms {
+		notify(listeners, room)
+	}
+}
+
+// OnChange registers fn to be called with the room whenever the users
+// typing in it change, including when an indicator expires
+func (t *Typing) OnChange(fn func(room string)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.listeners = append(t.listeners, fn)
+}
+
+// notify calls every listener with room
+func notify(listeners []func(room string), room string) {
+	for _, fn := range listeners {
+		fn(room)
+	}
+}
@@ -0,0 +1,104 @@
+package state
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sentTyping records the typing events a tracker sends
+type sentTyping struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (s *sentTyping) emit(event, room string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event+" "+room)
+}
+
+func (s *sentTyping) get() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.events...)
+}
+
+func TestTypingKeystrokes(t *testing.T) {
+	sent := &sentTyping{}
+	typing := NewTyping(50*time.Millisecond, time.Minute, sent.emit)
+
+	// Keystrokes are debounced, and switching rooms ends typing in the old one
+	for i := 0; i < 5; i++ {
+		typing.Keystroke("room-1")
+	}
+	typing.Keystroke("room-2")
+	typing.Stop()
+	typing.Stop()
+	expected := []string{"typing room-1", "stop typing room-1", "typing room-2", "stop typing room-2"}
+	if !reflect.DeepEqual(sent.get(), expected) {
+		t.Errorf("Sent %q; expected %q", sent.get(), expected)
+	}
+
+	// Going idle sends stop typing once
+	typing.Keystroke("")
+	time.Sleep(150 * time.Millisecond)
+	expected = append(expected, "typing ", "stop typing ")
+	if !reflect.DeepEqual(sent.get(), expected) {
+		t.Errorf("Sent %q; expected %q", sent.get(), expected)
+	}
+	if _, ok := typing.IsTyping(); ok {
+		t.Error("Expected typing to end after the idle timeout")
+	}
+}
+
+func TestTypingRepeatsWhileComposing(t *testing.T) {
+	sent := &sentTyping{}
+	typing := NewTyping(time.Minute, 40*time.Millisecond, sent.emit)
+	typing.Keystroke("room-1")
+	time.Sleep(30 * time.Millisecond)
+	typing.Keystroke("room-1")
+	if got := sent.get(); len(got) != 2 || got[1] != "typing room-1" {
+		t.Errorf("Sent %q; expected typing to be repeated before other clients forget it", got)
+	}
+	typing.Clear()
+	if got := sent.get(); len(got) != 2 {
+		t.Errorf("Clear sent %q; expected nothing", got[2:])
+	}
+}
+
+func TestTypists(t *testing.T) {
+	typing := NewTyping(time.Minute, 50*time.Millisecond, func(string, string) {})
+	changes := make(chan string, 10)
+	typing.OnChange(func(room string) { changes <- room })
+
+	typing.SetTyping("room-1", "bob", true)
+	typing.SetTyping("room-1", "alice", true)
+	typing.SetTyping("global", "carol", true)
+	typing.SetTyping("room-1", "dave", false) // Not typing, no change
+	if got := typing.Typists("room-1"); !reflect.DeepEqual(got, []string{"alice", "bob"}) {
+		t.Errorf("Typists(room-1) = %q", got)
+	}
+	if got := typing.Typists(""); !reflect.DeepEqual(got, []string{"carol"}) {
+		t.Errorf("Typists() = %q; expected global chat to be the empty room", got)
+	}
+	if len(changes) != 3 {
+		t.Errorf("Expected 3 changes, got %d", len(changes))
+	}
+
+	typing.SetTyping("room-1", "bob", false)
+	typing.Forget("carol")
+	if got := typing.Typists("room-1"); !reflect.DeepEqual(got, []string{"alice"}) {
+		t.Errorf("Typists(room-1) = %q after bob stopped", got)
+	}
+
+	// Indicators expire without a stop typing
+	time.Sleep(150 * time.Millisecond)
+	if got := typing.Typists("room-1"); len(got) != 0 {
+		t.Errorf("Typists(room-1) = %q; expected alice to have expired", got)
+	}
+	if len(changes) != 6 {
+		t.Errorf("Expected stopping, forgetting and expiring to be changes too, got %d changes", len(changes))
+	}
+}
@@ -0,0 +1,107 @@
+package state
+
+import (
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// PrivatePrefix marks the unread count of a private conversation, e.g. "@alice"
+const PrivatePrefix = "@"
+
+// UnreadCount is how many messages arrived in a room since it was last in
+// focus, and how many of them mention the user
+type UnreadCount struct {
+	Messages int
+	Mentions int
+}
+
+// Unread counts the messages received outside the focused room. Rooms are
+// identified by ID, "" for global chat and PrivatePrefix followed by the
+// user for private conversations. It is safe for concurrent use.
+type Unread struct {
+	mu     sync.Mutex
+	counts map[string]UnreadCount
+}
+
+// NewUnread creates a tracker with nothing unread
+func NewUnread() *Unread {
+	return &Unread{counts: make(map[string]UnreadCount)}
+}
+
+// Add counts a message received in room
+func (u *Unread) Add(room string, mention bool) {
+	room = rosterKey(room)
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	count := u.counts[room]
+	count.Messages++
+	if mention {
+		count.Mentions++
+	}
+	u.counts[room] = count
+}
+
+// Get returns the unread count of room
+func (u *Unread) Get(room string) UnreadCount {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.counts[rosterKey(room)]
+}
+
+// MarkRead clears the count of room and returns what it was
+func (u *Unread) MarkRead(room string) UnreadCount {
+	room = rosterKey(room)
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	count := u.counts[room]
+	delete(u.counts, room)
+	return count
+}
+
+// Counts returns the count of every room with unread messages
+func (u *Unread) Counts() map[string]UnreadCount {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	counts := make(map[string]UnreadCount, len(u.counts))
+	for room, count := range u.counts {
+		counts[room] = count
+	}
+	return counts
+}
+
+// Total returns the sum of the counts of every room
+func (u *Unread) Total() UnreadCount {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	var total UnreadCount
+	for _, count := range u.counts {
+		total.Messages += count.Messages
+		total.Mentions += count.Mentions
+	}
+	return total
+}
+
+// Mentions reports whether text mentions username as a whole word, with or
+// without a leading "@", ignoring case
+func Mentions(text, username string) bool {
+	if username == "" {
+		return false
+	}
+	text, username = strings.ToLower(text), strings.ToLower(username)
+	isWord := func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-' }
+	for start := 0; ; {
+		i := strings.Index(text[start:], username)
+		if i < 0 {
+			return false
+		}
+		i += start
+		before, _ := utf8.DecodeLastRuneInString(text[:i])
+		after, _ := utf8.DecodeRuneInString(text[i+len(username):])
+		if !isWord(before) && !isWord(after) {
+			return true
+		}
+		start = i + 1
+	}
+}
@@ -0,0 +1,77 @@
+package state
+
+import "testing"
+
+func TestTrackUnread(t *testing.T) {
+	cs := NewClientState("alice")
+	cs.AddJoinedRoom("room-1")
+	cs.AddJoinedRoom("room-2")
+	cs.SetCurrentRoom("room-1")
+
+	cs.TrackUnread("room-1", "bob", "in focus")
+	cs.TrackUnread("room-2", "bob", "hello")
+	cs.TrackUnread("room-2", "carol", "@Alice, look")
+	cs.TrackUnread("room-2", "alice", "my own")
+	cs.TrackUnread("", "bob", "global")
+	cs.TrackUnread(PrivatePrefix+"bob", "bob", "psst alice")
+
+	if got := cs.Unread().Get("room-1"); got.Messages != 0 {
+		t.Errorf("room-1 in focus has %+v unread", got)
+	}
+	if got := cs.Unread().Get("room-2"); got != (UnreadCount{Messages: 2, Mentions: 1}) {
+		t.Errorf("room-2 has %+v unread; expected 2 messages and 1 mention", got)
+	}
+	if got := cs.Unread().Get("global"); got.Messages != 1 {
+		t.Errorf("global chat has %+v unread", got)
+	}
+	if got := cs.Unread().Total(); got != (UnreadCount{Messages: 4, Mentions: 2}) {
+		t.Errorf("Total() = %+v", got)
+	}
+	if counts := cs.Unread().Counts(); len(counts) != 3 || counts[""].Messages != 1 || counts[PrivatePrefix+"bob"].Mentions != 1 {
+		t.Errorf("Counts() = %+v; expected room-2, global chat and bob", counts)
+	}
+
+	if unread, err := cs.SwitchRoom("room-2"); err != nil || unread.Messages != 2 {
+		t.Errorf("SwitchRoom(room-2) = %+v, %v", unread, err)
+	}
+	if cs.GetCurrentRoom() != "room-2" || cs.Unread().Get("room-2").Messages != 0 {
+		t.Error("Expected switching to bring room-2 into focus and clear its count")
+	}
+	// Private conversations are never in focus as far as the state knows
+	cs.TrackUnread(PrivatePrefix+"bob", "bob", "again")
+	if cs.Unread().Get(PrivatePrefix+"bob").Messages != 2 {
+		t.Error("Expected private messages to stay unread until marked read")
+	}
+
+	if _, err := cs.SwitchRoom("room-3"); err == nil {
+		t.Error("Expected switching to a room not joined to fail")
+	}
+	if _, err := cs.SwitchRoom("global"); err != nil || cs.GetCurrentRoom() != "" {
+		t.Errorf("SwitchRoom(global) error %v, current room %q", err, cs.GetCurrentRoom())
+	}
+	cs.TrackUnread("room-1", "bob", "later")
+	cs.RemoveJoinedRoom("room-1")
+	if cs.Unread().Get("room-1").Messages != 0 {
+		t.Error("Expected leaving a room to forget its count")
+	}
+}
+
+func TestMentions(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected bool
+	}{
+		{"hey alice", true},
+		{"@ALICE: ping", true},
+		{"alice's idea", true},
+		{"malice aforethought", false},
+		{"alice_b is here", false},
+		{"alicealice", false},
+		{"", false},
+	}
+	for _, test := range tests {
+		if got := Mentions(test.text, "alice"); got != test.expected {
+			t.Errorf("Mentions(%q) = %v; expected %v", test.text, got, test.expected)
+		}
+	}
+}
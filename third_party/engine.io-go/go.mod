@@ -0,0 +1,5 @@
+module github.com/zhouhui8915/engine.io-go
+
+go 1.21
+
+require github.com/gorilla/websocket v1.5.3
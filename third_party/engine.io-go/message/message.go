@@ -0,0 +1,8 @@
+package message
+
+type MessageType int
+
+const (
+	MessageText MessageType = iota
+	MessageBinary
+)
@@ -0,0 +1,3 @@
+package parser
+
+const Protocol = 3
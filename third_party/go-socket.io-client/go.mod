@@ -0,0 +1,10 @@
+module github.com/zhouhui8915/go-socket.io-client
+
+go 1.21
+
+require (
+	github.com/gorilla/websocket v1.5.3
+	github.com/zhouhui8915/engine.io-go v0.0.0-20150910083302-02ea08f0971f
+)
+
+replace github.com/zhouhui8915/engine.io-go => ../engine.io-go
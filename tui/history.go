@@ -0,0 +1,50 @@
+// history.go
+package tui
+
+// maxHistory is the number of input lines kept for recall
+const maxHistory = 100
+
+// inputHistory lets the user recall earlier input lines with the arrow keys,
+// like a shell. Browsing starts below the newest entry; the line being typed
+// is kept and restored when the user moves back down past the newest entry.
+type inputHistory struct {
+	lines []string
+	pos   int    // Index into lines, len(lines) when not browsing
+	draft string // Line being typed when browsing started
+}
+
+// Add records a submitted line and stops browsing
+func (h *inputHistory) Add(line string) {
+	if line != "" && (len(h.lines) == 0 || h.lines[len(h.lines)-1] != line) {
+		h.lines = append(h.lines, line)
+		if len(h.lines) > maxHistory {
+			h.lines = h.lines[len(h.lines)-maxHistory:]
+		}
+	}
+	h.pos = len(h.lines)
+	h.draft = ""
+}
+
+// Prev returns the line before the one shown; current is the text in the input line
+func (h *inputHistory) Prev(current string) string {
+	if h.pos == 0 {
+		return current
+	}
+	if h.pos == len(h.lines) {
+		h.draft = current
+	}
+	h.pos--
+	return h.lines[h.pos]
+}
+
+// Next returns the line after the one shown, or the draft after the newest line
+func (h *inputHistory) Next(current string) string {
+	if h.pos >= len(h.lines) {
+		return current
+	}
+	h.pos++
+	if h.pos == len(h.lines) {
+		return h.draft
+	}
+	return h.lines[h.pos]
+}
@@ -0,0 +1,624 @@
+// tui.go
+package tui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/jonipwi/go-chat-client/chatclient"
+	"github.com/jonipwi/go-chat-client/commands"
+	"github.com/jonipwi/go-chat-client/events"
+	"github.com/jonipwi/go-chat-client/render"
+	"github.com/jonipwi/go-chat-client/state"
+	"github.com/rivo/tview"
+	"golang.org/x/term"
+)
+
+// globalRoom is the pane for global chat, which is always present
+const globalRoom = "global"
+
+// dmPrefix marks panes holding a private conversation, e.g. "@alice"
+const dmPrefix = "@"
+
+// maxPaneLines is how many lines each message pane keeps for scrollback
+const maxPaneLines = 2000
+
+// statusInterval is how often the status bar is refreshed
+const statusInterval = time.Second
+
+// Available reports whether stdin and stdout are terminals the UI can take over
+func Available() bool {
+	return term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// App is the full-screen chat UI: a sidebar of rooms and private
+// conversations, one message pane per room, a status bar and an input line.
+// The panes belong to the server in focus; messages from other servers are
+// shown in the global pane, labelled with the server.
+//
+// Widgets may only be changed on the UI goroutine. Events and command output
+// arrive on other goroutines and are applied through update.
+type App struct {
+	app      *tview.Application
+	servers  *chatclient.Servers
+	focus    *chatclient.Client // Server the panes belong to
+	state    *state.ClientState // State of the server in focus
+	registry *commands.Registry
+	ctx      *commands.Context
+
+	sidebar *tview.List
+	pages   *tview.Pages
+	status  *tview.TextView
+	input   *tview.InputField
+
+	panes    map[string]*tview.TextView
+	order    []string // Sidebar order: global, rooms, then private conversations
+	active   string
+	seenRoom string // Current room in the client state when last synced
+	history  inputHistory
+	inputs   chan submission
+	stopped  atomic.Bool
+}
+
+// submission is an input line and the pane that was active when it was entered
+type submission struct {
+	text string
+	room string
+}
+
+// New creates the UI for servers. Input lines are run through registry.
+func New(servers *chatclient.Servers, registry *commands.Registry) *App {
+	focus := servers.Focused()
+	a := &App{
+		app:      tview.NewApplication(),
+		servers:  servers,
+		focus:    focus,
+		state:    focus.State(),
+		registry: registry,
+		panes:    make(map[string]*tview.TextView),
+		inputs:   make(chan submission, 16),
+	}
+	a.ctx = &commands.Context{State: a.state, Out: paneWriter{a}, Registry: registry}
+	if servers.Multiple() {
+		a.ctx.Servers, a.ctx.Server = servers, focus.Name()
+	}
+
+	a.sidebar = tview.NewList().ShowSecondaryText(false).SetHighlightFullLine(true)
+	a.sidebar.SetBorder(true)
+	a.sidebar.SetSelectedFunc(func(index int, _, _ string, _ rune) {
+		if index < len(a.order) {
+			a.activate(a.order[index])
+			a.app.SetFocus(a.input)
+		}
+	})
+
+	a.pages = tview.NewPages()
+	a.pages.SetBorder(true)
+	a.status = tview.NewTextView().SetDynamicColors(true)
+	a.input = tview.NewInputField().SetLabel("> ").SetFieldBackgroundColor(tcell.ColorDefault)
+	a.input.SetDoneFunc(a.onEnter)
+	a.input.SetChangedFunc(a.onInputChanged)
+	a.input.SetInputCapture(a.onInputKey)
+
+	body := tview.NewFlex().
+		AddItem(a.sidebar, 24, 0, false).
+		AddItem(a.pages, 0, 1, false)
+	root := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(body, 0, 1, false).
+		AddItem(a.status, 1, 0, false).
+		AddItem(a.input, 1, 0, true)
+	a.app.SetRoot(root, true).SetFocus(a.input).EnableMouse(true)
+	a.app.SetInputCapture(a.onGlobalKey)
+
+	a.addPane(globalRoom)
+	a.activate(globalRoom)
+	a.syncRooms()
+	a.updateStatus()
+	a.updateTitle()
+
+	servers.OnEvent(func(c *chatclient.Client, e events.Event) {
+		a.update(func() { a.onServerEvent(c, e) })
+	})
+	servers.OnFocus(func(c *chatclient.Client) {
+		a.update(func() { a.switchServer(c) })
+	})
+	for _, c := range servers.Clients() {
+		c.State().Typing().OnChange(func(string) {
+			a.update(a.updateStatus)
+		})
+	}
+	return a
+}
+
+// Run shows the UI and blocks until the user quits, the terminal fails or ctx is done
+func (a *App) Run(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return nil
+	}
+	stop := context.AfterFunc(ctx, a.app.Stop)
+	defer stop()
+	a.ctx.Ctx = ctx
+
+	a.printTo(globalRoom, "[::b]Welcome to Go Chat Client[::-]\n")
+	a.printTo(globalRoom, "Type /help for commands.\n")
+	a.printTo(globalRoom, "Tab: room list/input, Ctrl-N/Ctrl-P: next/previous room, PgUp/PgDn/End: scroll, Up/Down: input history\n")
+
+	done := make(chan struct{})
+	defer close(done)
+
+	// Commands may block on the network and write their output through
+	// update, so they run one at a time off the UI goroutine
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case s := <-a.inputs:
+				a.submit(s.text, s.room)
+			}
+		}
+	}()
+
+	go func() {
+		ticker := time.NewTicker(statusInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				a.update(func() {
+					a.syncRooms()
+					a.updateStatus()
+				})
+			}
+		}
+	}()
+
+	err := a.app.Run()
+	a.stopped.Store(true)
+	return err
+}
+
+// update runs f on the UI goroutine and redraws. It must not be called from the UI goroutine.
+func (a *App) update(f func()) {
+	if a.stopped.Load() {
+		return
+	}
+	a.app.QueueUpdateDraw(f)
+}
+
+// onServerEvent shows an event received from any server. Of the servers out
+// of focus only messages and disconnects are shown, in the global pane.
+func (a *App) onServerEvent(c *chatclient.Client, e events.Event) {
+	if c == a.focus {
+		a.onEvent(e)
+		return
+	}
+	switch {
+	case e.Message != nil:
+		a.printTo(globalRoom, formatMessage(e.Message, c.Name()))
+		a.updateStatus()
+	case e.Name == "disconnect":
+		a.printTo(globalRoom, fmt.Sprintf("[red]Disconnected from server %s, reconnecting...[-]\n", tview.Escape(c.Name())))
+	}
+}
+
+// onEvent shows an event received from the server in focus in the pane it belongs to
+func (a *App) onEvent(e events.Event) {
+	switch {
+	case e.Message != nil:
+		msg := e.Message
+		room := a.active
+		switch msg.Type {
+		case events.TypeGlobal:
+			room = globalRoom
+		case events.TypePrivate:
+			if msg.Sender != "" {
+				room = dmPrefix + msg.Sender
+			}
+		case events.TypeGroup, events.TypeGuild:
+			if msg.Room != "" {
+				room = msg.Room
+			}
+		}
+		a.addPane(room)
+		a.printTo(room, formatMessage(msg, a.label()))
+		if room == a.active {
+			// Counted as unread if the pane shows a private conversation or global chat
+			a.state.Unread().MarkRead(room)
+		}
+		a.renderSidebar()
+
+	case e.Name == "room joined" && e.Room != nil:
+		a.addPane(e.Room.ID)
+		a.activate(e.Room.ID)
+		a.printTo(e.Room.ID, fmt.Sprintf("[yellow]Joined %s[-]\n", tview.Escape(e.Room.ID)))
+
+	case e.Name == "room left" && e.Room != nil:
+		a.removePane(e.Room.ID)
+
+	case e.Name == "user joined" || e.Name == "user left":
+		room := globalRoom
+		if e.Room != nil {
+			room = e.Room.ID
+		}
+		if _, ok := a.panes[room]; ok {
+			verb := strings.TrimPrefix(e.Name, "user ")
+			a.printTo(room, fmt.Sprintf("[gray]%s %s[-]\n", tview.Escape(e.User.Name()), verb))
+		}
+
+	case e.Name == "user list":
+		names := make([]string, len(e.Users))
+		for i, u := range e.Users {
+			names[i] = u.Name()
+		}
+		room := a.active
+		if e.Room != nil {
+			if _, ok := a.panes[e.Room.ID]; ok {
+				room = e.Room.ID
+			}
+		}
+		a.printTo(room, fmt.Sprintf("[gray]Online (%d): %s[-]\n", len(names), tview.Escape(strings.Join(names, ", "))))
+
+	case e.Name == "room list":
+		ids := make([]string, len(e.Rooms))
+		for i, r := range e.Rooms {
+			ids[i] = r.ID
+		}
+		a.printTo(a.active, fmt.Sprintf("[gray]Rooms (%d): %s[-]\n", len(ids), tview.Escape(strings.Join(ids, ", "))))
+
+	case e.Name == "disconnect":
+		a.printTo(a.active, "[red]Disconnected from server, reconnecting...[-]\n")
+	}
+}
+
+// formatMessage renders a chat message as a pane line, colored like the
+// line-based client and labelled with server unless it is empty
+func formatMessage(msg *events.Message, server string) string {
+	line := render.NewLine(*msg).FromServer(server)
+	label := fmt.Sprintf("[%s]%s[-]", line.Color.Name, tview.Escape("["+line.Label+"]"))
+	if line.Sender == "" {
+		return fmt.Sprintf("[gray]%s[-] %s %s\n", line.Time, label, tview.Escape(line.Content))
+	}
+	return fmt.Sprintf("[gray]%s[-] %s [::b]%s[::-]: %s\n", line.Time, label, tview.Escape(line.Sender), tview.Escape(line.Content))
+}
+
+// onEnter submits the input line
+func (a *App) onEnter(key tcell.Key) {
+	if key != tcell.KeyEnter {
+		return
+	}
+	text := strings.TrimSpace(a.input.GetText())
+	a.input.SetText("")
+	if text == "" {
+		return
+	}
+	a.history.Add(text)
+
+	select {
+	case a.inputs <- submission{text: text, room: a.active}:
+	default:
+		a.printTo(a.active, "[red]Still busy with earlier input, try again[-]\n")
+	}
+}
+
+// onInputChanged sends typing indicators while a chat message is composed
+// in a room or global chat. Commands and private conversations send none.
+func (a *App) onInputChanged(text string) {
+	if text == "" || strings.HasPrefix(text, "/") || strings.HasPrefix(a.active, dmPrefix) {
+		a.state.Typing().Stop()
+		return
+	}
+	a.state.Typing().Keystroke(a.active)
+}
+
+// submit runs a command or sends a chat message to the room shown when it was entered
+func (a *App) submit(text, room string) {
+	if strings.HasPrefix(text, "/") {
+		if err := a.registry.Dispatch(a.ctx, text); err != nil {
+			if errors.Is(err, commands.ErrUnknownCommand) {
+				fmt.Fprintf(a.ctx.Out, "%v. Type /help for available commands.\n", err)
+			} else {
+				fmt.Fprintln(a.ctx.Out, err)
+			}
+		}
+		if a.ctx.Quitting() {
+			a.app.Stop()
+		}
+		return
+	}
+
+	if user, ok := strings.CutPrefix(room, dmPrefix); ok {
+		a.registry.Dispatch(a.ctx, "/private "+user+" "+text)
+		a.update(func() {
+			a.printTo(room, formatMessage(&events.Message{Sender: a.state.GetUsername(), Content: text, Timestamp: time.Now()}, ""))
+		})
+		return
+	}
+	queued, err := a.servers.Focused().SendChat(text)
+	commands.PrintSendResult(a.ctx, queued, err)
+}
+
+// onInputKey handles history recall and scrolling while the input line has focus
+func (a *App) onInputKey(event *tcell.EventKey) *tcell.EventKey {
+	pane := a.panes[a.active]
+	switch event.Key() {
+	case tcell.KeyUp:
+		a.input.SetText(a.history.Prev(a.input.GetText()))
+	case tcell.KeyDown:
+		a.input.SetText(a.history.Next(a.input.GetText()))
+	case tcell.KeyPgUp:
+		row, _ := pane.GetScrollOffset()
+		_, _, _, height := pane.GetInnerRect()
+		pane.ScrollTo(max(row-height+1, 0), 0)
+	case tcell.KeyPgDn:
+		row, _ := pane.GetScrollOffset()
+		_, _, _, height := pane.GetInnerRect()
+		pane.ScrollTo(row+height-1, 0)
+	case tcell.KeyEnd:
+		if a.input.GetText() != "" {
+			return event
+		}
+		pane.ScrollToEnd()
+	default:
+		return event
+	}
+	return nil
+}
+
+// onGlobalKey handles the keys that work regardless of focus
+func (a *App) onGlobalKey(event *tcell.EventKey) *tcell.EventKey {
+	switch event.Key() {
+	case tcell.KeyTab:
+		if a.input.HasFocus() {
+			a.app.SetFocus(a.sidebar)
+		} else {
+			a.app.SetFocus(a.input)
+		}
+	case tcell.KeyCtrlN:
+		a.cycle(1)
+	case tcell.KeyCtrlP:
+		a.cycle(-1)
+	default:
+		return event
+	}
+	return nil
+}
+
+// cycle activates the room dir places after the active one in the sidebar
+func (a *App) cycle(dir int) {
+	for i, key := range a.order {
+		if key == a.active {
+			a.activate(a.order[(i+dir+len(a.order))%len(a.order)])
+			return
+		}
+	}
+}
+
+// addPane creates the pane for a room or conversation if it does not exist yet
+func (a *App) addPane(key string) {
+	if _, ok := a.panes[key]; ok {
+		return
+	}
+	pane := tview.NewTextView().SetDynamicColors(true).SetScrollable(true).SetWrap(true).SetMaxLines(maxPaneLines)
+	pane.ScrollToEnd()
+	a.panes[key] = pane
+	a.pages.AddPage(key, pane, true, false)
+	a.order = append(a.order, key)
+	sortPanes(a.order)
+	a.renderSidebar()
+}
+
+// removePane drops the pane of a room that was left
+func (a *App) removePane(key string) {
+	if key == globalRoom {
+		return
+	}
+	if _, ok := a.panes[key]; !ok {
+		return
+	}
+	delete(a.panes, key)
+	a.state.Unread().MarkRead(key)
+	a.pages.RemovePage(key)
+	for i, k := range a.order {
+		if k == key {
+			a.order = append(a.order[:i], a.order[i+1:]...)
+			break
+		}
+	}
+	if a.active == key {
+		a.activate(globalRoom)
+	}
+	a.renderSidebar()
+}
+
+// activate shows a pane and makes its room the target of plain input
+func (a *App) activate(key string) {
+	a.active = key
+	a.state.Unread().MarkRead(key)
+	a.pages.SwitchToPage(key)
+	a.pages.SetTitle(" " + tview.Escape(paneTitle(key)) + " ")
+	switch {
+	case key == globalRoom:
+		// No current room means global chat
+		a.state.SetCurrentRoom("")
+		a.seenRoom = ""
+	case !strings.HasPrefix(key, dmPrefix):
+		a.state.SetCurrentRoom(key)
+		a.seenRoom = key
+	}
+	a.renderSidebar()
+}
+
+// switchServer shows the rooms of the server that came into focus, with
+// its current room active. Only the global pane is kept.
+func (a *App) switchServer(c *chatclient.Client) {
+	if c == a.focus {
+		return
+	}
+	a.focus, a.state = c, c.State()
+	for key := range a.panes {
+		if key != globalRoom {
+			delete(a.panes, key)
+			a.pages.RemovePage(key)
+		}
+	}
+	a.order = []string{globalRoom}
+	for _, room := range a.state.GetJoinedRooms() {
+		a.addPane(room)
+	}
+	current := a.state.GetCurrentRoom()
+	if current == "" {
+		current = globalRoom
+	}
+	a.addPane(current)
+	a.activate(current)
+	a.updateTitle()
+	a.updateStatus()
+}
+
+// label returns the name messages from the server in focus are labelled
+// with, none when there is only one server
+func (a *App) label() string {
+	if !a.servers.Multiple() {
+		return ""
+	}
+	return a.focus.Name()
+}
+
+// updateTitle names the server in focus above the room list
+func (a *App) updateTitle() {
+	if server := a.label(); server != "" {
+		a.sidebar.SetTitle(" Rooms on " + tview.Escape(server) + " ")
+		return
+	}
+	a.sidebar.SetTitle(" Rooms ")
+}
+
+// syncRooms follows room changes made by commands, such as /join
+func (a *App) syncRooms() {
+	for _, room := range a.state.GetJoinedRooms() {
+		a.addPane(room)
+	}
+	if current := a.state.GetCurrentRoom(); current != a.seenRoom {
+		if current == "" || current == globalRoom {
+			a.activate(globalRoom)
+			return
+		}
+		a.addPane(current)
+		a.activate(current)
+	}
+}
+
+// renderSidebar redraws the room list with unread and mention counts
+func (a *App) renderSidebar() {
+	a.sidebar.Clear()
+	for i, key := range a.order {
+		label := tview.Escape(paneTitle(key))
+		if unread := a.state.Unread().Get(key); unread.Mentions > 0 {
+			label = fmt.Sprintf("%s [yellow](%d)[-] [red]@%d[-]", label, unread.Messages, unread.Mentions)
+		} else if unread.Messages > 0 {
+			label = fmt.Sprintf("%s [yellow](%d)[-]", label, unread.Messages)
+		}
+		a.sidebar.AddItem(label, "", 0, nil)
+		if key == a.active {
+			a.sidebar.SetCurrentItem(i)
+		}
+	}
+}
+
+// updateStatus refreshes the status bar from the client statistics
+func (a *App) updateStatus() {
+	stats := a.state.Snapshot()
+	conn := "[red]● disconnected[-]"
+	if stats.Connected {
+		conn = "[green]● connected[-]"
+	}
+
+	unread := a.state.Unread().Total()
+
+	who := tview.Escape(stats.Username)
+	if server := a.label(); server != "" {
+		who += " on " + tview.Escape(server)
+	}
+	parts := []string{
+		fmt.Sprintf("%s as %s", conn, who),
+		tview.Escape(paneTitle(a.active)),
+		fmt.Sprintf("sent %d / recv %d", stats.MessagesSent, stats.MessagesReceived),
+	}
+	if !stats.LastServerActivity.IsZero() {
+		parts = append(parts, fmt.Sprintf("server seen %s ago", stats.TakenAt.Sub(stats.LastServerActivity).Round(time.Second)))
+	}
+	if !strings.HasPrefix(a.active, dmPrefix) {
+		if typing := render.TypingIndicator(a.state.Typing().Typists(a.active)); typing != "" {
+			parts = append(parts, "[gray]"+tview.Escape(typing)+"[-]")
+		}
+	}
+	if unread.Messages > 0 {
+		parts = append(parts, fmt.Sprintf("[yellow]unread %d[-]", unread.Messages))
+	}
+	if unread.Mentions > 0 {
+		parts = append(parts, fmt.Sprintf("[red]mentions %d[-]", unread.Mentions))
+	}
+	if stats.QueuedMessages > 0 {
+		parts = append(parts, fmt.Sprintf("[yellow]queued %d[-]", stats.QueuedMessages))
+	}
+	if stats.ConnectionErrors > 0 {
+		parts = append(parts, fmt.Sprintf("[red]errors %d[-]", stats.ConnectionErrors))
+	}
+	a.status.SetText(" " + strings.Join(parts, " │ "))
+}
+
+// printTo appends text, which may contain color tags, to a pane
+func (a *App) printTo(key string, text string) {
+	if pane, ok := a.panes[key]; ok {
+		fmt.Fprint(pane, text)
+	}
+}
+
+// paneTitle is the sidebar label of a pane
+func paneTitle(key string) string {
+	if strings.HasPrefix(key, dmPrefix) {
+		return key
+	}
+	return "# " + key
+}
+
+// sortPanes orders panes as global first, then rooms, then private conversations
+func sortPanes(keys []string) {
+	rank := func(key string) int {
+		switch {
+		case key == globalRoom:
+			return 0
+		case strings.HasPrefix(key, dmPrefix):
+			return 2
+		}
+		return 1
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		if rank(keys[i]) != rank(keys[j]) {
+			return rank(keys[i]) < rank(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+}
+
+// paneWriter shows command output in the active pane
+type paneWriter struct {
+	a *App
+}
+
+// Write implements io.Writer. It is called from command goroutines.
+func (w paneWriter) Write(p []byte) (int, error) {
+	text := tview.Escape(string(p))
+	w.a.update(func() { w.a.printTo(w.a.active, text) })
+	return len(p), nil
+}
@@ -0,0 +1,143 @@
+package tui
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonipwi/go-chat-client/chatclient"
+	"github.com/jonipwi/go-chat-client/commands"
+	"github.com/jonipwi/go-chat-client/config"
+	"github.com/jonipwi/go-chat-client/events"
+)
+
+func TestInputHistory(t *testing.T) {
+	var h inputHistory
+	if got := h.Prev("typing"); got != "typing" {
+		t.Errorf("Prev on empty history = %q; expected the current text", got)
+	}
+
+	h.Add("/join room-1")
+	h.Add("hello")
+	h.Add("hello") // Repeats are stored once
+
+	steps := []struct {
+		prev     bool
+		expected string
+	}{
+		{true, "hello"},
+		{true, "/join room-1"},
+		{true, "/join room-1"}, // Stays at the oldest line
+		{false, "hello"},
+		{false, "draft"}, // Back to what was being typed
+		{false, "draft"},
+	}
+	current := "draft"
+	for i, step := range steps {
+		if step.prev {
+			current = h.Prev(current)
+		} else {
+			current = h.Next(current)
+		}
+		if current != step.expected {
+			t.Fatalf("Step %d: got %q; expected %q", i, current, step.expected)
+		}
+	}
+}
+
+func TestSortPanes(t *testing.T) {
+	keys := []string{"@zoe", "room-b", "global", "@al", "room-a"}
+	sortPanes(keys)
+	expected := []string{"global", "room-a", "room-b", "@al", "@zoe"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("sortPanes = %v; expected %v", keys, expected)
+	}
+}
+
+func newTestApp() *App {
+	cfg := config.Default()
+	cfg.Username = "testuser"
+	servers, err := chatclient.NewServers(cfg)
+	if err != nil {
+		panic(err)
+	}
+	return New(servers, commands.DefaultRegistry())
+}
+
+func TestEventsAreRoutedToPanes(t *testing.T) {
+	a := newTestApp()
+	now := time.Now()
+
+	// The router counts unread messages before publishing them
+	a.state.TrackUnread("@bob", "bob", "psst")
+	a.onEvent(events.Event{Name: "private message", Message: &events.Message{Type: events.TypePrivate, Sender: "bob", Content: "psst [red]not a tag", Timestamp: now}})
+	a.state.TrackUnread("room-1", "carol", "hi all")
+	a.onEvent(events.Event{Name: "group message", Message: &events.Message{Type: events.TypeGroup, Room: "room-1", Sender: "carol", Content: "hi all", Timestamp: now}})
+	a.state.TrackUnread("", "dave", "hey")
+	a.onEvent(events.Event{Name: "chat message", Message: &events.Message{Type: events.TypeGlobal, Sender: "dave", Content: "hey", Timestamp: now}})
+
+	if !reflect.DeepEqual(a.order, []string{"global", "room-1", "@bob"}) {
+		t.Errorf("Unexpected panes: %v", a.order)
+	}
+	unread := a.state.Unread()
+	if unread.Get("@bob").Messages != 1 || unread.Get("room-1").Messages != 1 || unread.Get("global").Messages != 0 {
+		t.Errorf("Unexpected unread counts: %+v", unread.Total())
+	}
+	if text := a.panes["@bob"].GetText(true); !strings.Contains(text, "[private] bob: psst [red]not a tag") {
+		t.Errorf("Expected the message text to be shown literally, got %q", text)
+	}
+
+	a.activate("room-1")
+	if unread.Get("room-1").Messages != 0 || a.state.GetCurrentRoom() != "room-1" {
+		t.Errorf("Expected activating a room to clear unread and set the current room, got %d, %q",
+			unread.Get("room-1").Messages, a.state.GetCurrentRoom())
+	}
+
+	a.onEvent(events.Event{Name: "room left", Room: &events.Room{ID: "room-1"}})
+	if _, ok := a.panes["room-1"]; ok || a.active != globalRoom {
+		t.Errorf("Expected leaving the active room to fall back to global, active is %q", a.active)
+	}
+}
+
+func TestSyncRoomsFollowsCommands(t *testing.T) {
+	a := newTestApp()
+
+	// What /join does to the state
+	a.state.AddJoinedRoom("guild-1")
+	a.state.SetCurrentRoom("guild-1")
+	a.syncRooms()
+
+	if a.active != "guild-1" {
+		t.Errorf("Expected the UI to switch to the joined room, active is %q", a.active)
+	}
+}
+
+func TestServerFocus(t *testing.T) {
+	cfg := config.Default()
+	cfg.Username = "testuser"
+	cfg.Servers = []config.ServerProfile{{Name: "prod"}, {Name: "staging"}}
+	servers, err := chatclient.NewServers(cfg)
+	if err != nil {
+		t.Fatalf("NewServers() error: %v", err)
+	}
+	a := New(servers, commands.DefaultRegistry())
+	prod, _ := servers.Get("prod")
+	staging, _ := servers.Get("staging")
+	staging.State().AddJoinedRoom("room-2")
+	staging.State().SetCurrentRoom("room-2")
+
+	a.onServerEvent(staging, events.Event{Name: "group message", Message: &events.Message{Type: events.TypeGroup, Room: "room-2", Sender: "bob", Content: "elsewhere", Timestamp: time.Now()}})
+	if _, ok := a.panes["room-2"]; ok {
+		t.Error("Rooms of a server out of focus should not get a pane")
+	}
+	if text := a.panes[globalRoom].GetText(true); !strings.Contains(text, "[staging/group:room-2] bob: elsewhere") {
+		t.Errorf("Expected the message in the global pane, labelled with its server, got %q", text)
+	}
+
+	a.onServerEvent(prod, events.Event{Name: "group message", Message: &events.Message{Type: events.TypeGroup, Room: "room-1", Sender: "carol", Content: "here", Timestamp: time.Now()}})
+	a.switchServer(staging)
+	if a.state != staging.State() || a.active != "room-2" || !reflect.DeepEqual(a.order, []string{"global", "room-2"}) {
+		t.Errorf("Expected the panes of staging with room-2 active, got %v with %q active", a.order, a.active)
+	}
+}
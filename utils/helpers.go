@@ -1,8 +1,11 @@
 package utils
 
 import (
+	"context"
+	"crypto/rand"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -64,14 +67,48 @@ func EscapeSpecialChars(input string) string {
 	return input
 }
 
-// GenerateRandomID creates a simple unique identifier
+// GenerateRandomID creates a random (version 4) UUID, used to correlate
+// requests with the server's replies
 func GenerateRandomID() string {
-	// This is a naive implementation. In a real-world scenario,
-	// you'd use a more robust method like UUID
-	return fmt.Sprintf("%d", time.Now().UnixNano())
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		// crypto/rand only fails if the OS has no randomness source
+		panic(fmt.Sprintf("generating random ID: %v", err))
+	}
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
 }
 
 // FormatTimestamp converts a timestamp to a human-readable format
 func FormatTimestamp(t time.Time) string {
 	return t.Format("2006-01-02 15:04:05")
 }
+
+// Sleep pauses for d or until ctx is done. It reports whether the full
+// duration passed.
+func Sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Wait waits for wg or until ctx is done, in which case it returns the context's error
+func Wait(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSleepAndWait(t *testing.T) {
+	if !Sleep(context.Background(), time.Millisecond) {
+		t.Error("Sleep() = false; expected the full duration to pass")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if Sleep(ctx, time.Hour) {
+		t.Error("Sleep() = true; expected it to stop when the context is done")
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	if err := Wait(ctx, &wg); err != context.Canceled {
+		t.Errorf("Wait() = %v; expected context.Canceled", err)
+	}
+	wg.Done()
+	if err := Wait(context.Background(), &wg); err != nil {
+		t.Errorf("Wait() = %v; expected nil", err)
+	}
+}
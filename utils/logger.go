@@ -1,24 +1,228 @@
 package utils
 
 import (
+	"context"
+	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 )
 
-// Logger is a custom logger with timestamp and file information
-var Logger *log.Logger
+// Log components, added to every line as the "component" field
+const (
+	ComponentClient     = "client"
+	ComponentConnection = "connection"
+	ComponentHeartbeat  = "heartbeat"
+	ComponentEvents     = "events"
+	ComponentCommands   = "commands"
+	ComponentAuth       = "auth"
+	ComponentHistory    = "history"
+	ComponentMetrics    = "metrics"
+	ComponentUI         = "ui"
+	ComponentBot        = "bot"
+)
+
+// Log formats
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
 
-func init() {
-	// Create a file for logging
-	file, err := os.OpenFile("chat_client.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+// LogOptions configures the logging subsystem
+type LogOptions struct {
+	Level    string // debug, info, warn or error
+	Format   string // text or json
+	File     string // Empty logs to the console only
+	Rotation RotationOptions
+}
+
+var (
+	logMu      sync.Mutex
+	logFile    *RotatingFile
+	logConsole io.Writer = os.Stderr
+	logLevel   slog.LevelVar
+	logFormat  = LogFormatText
+
+	// logBase is the handler every component logger writes through
+	logBase atomic.Pointer[slog.Handler]
+)
+
+// Log returns the logger of a component. Loggers follow later calls to
+// ConfigureLogging, so they can be created before logging is configured.
+// Until then lines go to stderr as text at info level.
+func Log(component string) *slog.Logger {
+	return slog.New(newSwitchHandler(component))
+}
+
+// ConfigureLogging sets the level, format and destination of the logs, and
+// routes the standard log package through the same handler. Any previously
+// opened log file is closed.
+func ConfigureLogging(opts LogOptions) error {
+	level, err := ParseLogLevel(opts.Level)
 	if err != nil {
-		log.Fatal("Failed to open log file:", err)
+		return err
+	}
+	format := strings.ToLower(opts.Format)
+	switch format {
+	case "":
+		format = LogFormatText
+	case LogFormatText, LogFormatJSON:
+	default:
+		return fmt.Errorf("unknown log format %q (use text or json)", opts.Format)
+	}
+
+	var file *RotatingFile
+	if opts.File != "" {
+		file, err = OpenRotatingFile(opts.File, opts.Rotation)
+		if err != nil {
+			return err
+		}
+	}
+
+	logMu.Lock()
+	if logFile != nil {
+		logFile.Close()
+	}
+	logFile = file
+	logFormat = format
+	logLevel.Set(level)
+	logMu.Unlock()
+	rebuildHandler()
+
+	// Lines from the standard log package are logged at info level
+	slog.SetDefault(slog.New(newSwitchHandler(ComponentClient)))
+	return nil
+}
+
+// ParseLogLevel parses debug, info, warn or error; empty means info
+func ParseLogLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return slog.LevelInfo, fmt.Errorf("unknown log level %q (use debug, info, warn or error)", level)
+}
+
+// SetLogConsole sets where log lines are echoed besides the log file,
+// os.Stderr by default. nil stops echoing, e.g. while a full-screen UI owns the terminal.
+func SetLogConsole(w io.Writer) {
+	logMu.Lock()
+	logConsole = w
+	logMu.Unlock()
+}
+
+// CloseLog closes the log file, if any. Later lines go to the console only.
+func CloseLog() error {
+	logMu.Lock()
+	defer logMu.Unlock()
+	if logFile == nil {
+		return nil
+	}
+	err := logFile.Close()
+	logFile = nil
+	return err
+}
+
+// StdLogger returns a standard library logger writing through the handler of
+// component at the given level, for APIs that need a *log.Logger
+func StdLogger(component string, level slog.Level) *log.Logger {
+	return slog.NewLogLogger(newSwitchHandler(component), level)
+}
+
+// rebuildHandler creates the base handler for the current format
+func rebuildHandler() {
+	logMu.Lock()
+	format := logFormat
+	logMu.Unlock()
+
+	opts := &slog.HandlerOptions{Level: &logLevel}
+	var h slog.Handler
+	if format == LogFormatJSON {
+		h = slog.NewJSONHandler(logOutput{}, opts)
+	} else {
+		h = slog.NewTextHandler(logOutput{}, opts)
+	}
+	logBase.Store(&h)
+}
+
+// baseHandler returns the current base handler, creating the default one on first use
+func baseHandler() slog.Handler {
+	if h := logBase.Load(); h != nil {
+		return *h
+	}
+	rebuildHandler()
+	return *logBase.Load()
+}
+
+// logOutput writes each line to the console and the log file
+type logOutput struct{}
+
+// Write implements io.Writer
+func (logOutput) Write(p []byte) (int, error) {
+	logMu.Lock()
+	console, file := logConsole, logFile
+	logMu.Unlock()
+
+	if console != nil {
+		console.Write(p)
+	}
+	if file != nil {
+		if _, err := file.Write(p); err != nil {
+			return 0, err
+		}
 	}
+	return len(p), nil
+}
+
+// switchHandler forwards records to the current base handler, replaying its
+// attributes and groups on it, so loggers survive reconfiguration
+type switchHandler struct {
+	ops []func(slog.Handler) slog.Handler
+}
+
+// newSwitchHandler creates a handler adding the component field
+func newSwitchHandler(component string) *switchHandler {
+	h := &switchHandler{}
+	return h.with(func(base slog.Handler) slog.Handler {
+		return base.WithAttrs([]slog.Attr{slog.String("component", component)})
+	})
+}
+
+// with returns a copy of h with op appended
+func (h *switchHandler) with(op func(slog.Handler) slog.Handler) *switchHandler {
+	return &switchHandler{ops: append(append([]func(slog.Handler) slog.Handler{}, h.ops...), op)}
+}
 
-	// Create a multi-writer that writes to both file and stdout
-	multiWriter := io.MultiWriter(os.Stdout, file)
+// Enabled implements slog.Handler
+func (h *switchHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= logLevel.Level()
+}
+
+// Handle implements slog.Handler
+func (h *switchHandler) Handle(ctx context.Context, r slog.Record) error {
+	base := baseHandler()
+	for _, op := range h.ops {
+		base = op(base)
+	}
+	return base.Handle(ctx, r)
+}
+
+// WithAttrs implements slog.Handler
+func (h *switchHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(base slog.Handler) slog.Handler { return base.WithAttrs(attrs) })
+}
 
-	// Initialize the logger with the multi-writer
-	Logger = log.New(multiWriter, "[CHAT-CLIENT] ", log.LstdFlags|log.Lshortfile)
+// WithGroup implements slog.Handler
+func (h *switchHandler) WithGroup(name string) slog.Handler {
+	return h.with(func(base slog.Handler) slog.Handler { return base.WithGroup(name) })
 }
@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// captureLogs configures logging with opts, echoing to a buffer, and restores
+// the defaults when the test ends
+func captureLogs(t *testing.T, opts LogOptions) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := ConfigureLogging(opts); err != nil {
+		t.Fatalf("ConfigureLogging() error: %v", err)
+	}
+	SetLogConsole(&buf)
+	t.Cleanup(func() {
+		CloseLog()
+		SetLogConsole(os.Stderr)
+		ConfigureLogging(LogOptions{})
+	})
+	return &buf
+}
+
+func TestLogJSONFields(t *testing.T) {
+	// Created before logging is configured, the logger must follow the new settings
+	logger := Log(ComponentEvents)
+	buf := captureLogs(t, LogOptions{Level: "debug", Format: LogFormatJSON})
+
+	logger.Debug("Joined room", "room", "room-1")
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("Expected a JSON line, got %q: %v", buf.String(), err)
+	}
+	for key, want := range map[string]string{
+		"level":     "DEBUG",
+		"msg":       "Joined room",
+		"component": ComponentEvents,
+		"room":      "room-1",
+	} {
+		if line[key] != want {
+			t.Errorf("%s = %v; expected %q", key, line[key], want)
+		}
+	}
+}
+
+func TestLogLevelFiltering(t *testing.T) {
+	buf := captureLogs(t, LogOptions{Level: "warn"})
+	logger := Log(ComponentConnection).With("attempt", 2)
+
+	logger.Info("Connecting")
+	logger.Warn("Connection attempt failed")
+
+	out := buf.String()
+	if strings.Contains(out, "Connecting") {
+		t.Errorf("Expected info lines to be dropped at warn level, got %q", out)
+	}
+	if !strings.Contains(out, "component=connection") || !strings.Contains(out, "attempt=2") {
+		t.Errorf("Expected the warning with its fields, got %q", out)
+	}
+}
+
+func TestLogFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "client.log")
+	captureLogs(t, LogOptions{File: path})
+
+	Log(ComponentClient).Info("Written to the file")
+	CloseLog()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Reading the log file: %v", err)
+	}
+	if !strings.Contains(string(data), "Written to the file") {
+		t.Errorf("Log file = %q; expected the line", data)
+	}
+}
+
+func TestConfigureLoggingRejectsUnknownSettings(t *testing.T) {
+	if err := ConfigureLogging(LogOptions{Level: "verbose"}); err == nil {
+		t.Error("Expected an unknown level to be rejected")
+	}
+	if err := ConfigureLogging(LogOptions{Format: "xml"}); err == nil {
+		t.Error("Expected an unknown format to be rejected")
+	}
+}
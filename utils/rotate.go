@@ -0,0 +1,233 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat is appended to the log file name when it is rotated
+const backupTimeFormat = "20060102-150405"
+
+// RotationOptions controls when a log file is rotated and how many old
+// files are kept. Zero values disable the corresponding limit.
+type RotationOptions struct {
+	MaxSize    int64         // Rotate once the file would grow beyond this many bytes
+	Interval   time.Duration // Rotate when the file has been written to for this long
+	MaxBackups int           // Rotated files to keep
+	MaxAge     time.Duration // Delete rotated files older than this
+}
+
+// RotatingFile is a log file that is renamed to "<name>.<time><ext>" and
+// reopened when it grows too large or too old. It is safe for concurrent use.
+type RotatingFile struct {
+	mu       sync.Mutex
+	path     string
+	opts     RotationOptions
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	now      func() time.Time
+}
+
+// OpenRotatingFile opens or creates the log file at path for appending
+func OpenRotatingFile(path string, opts RotationOptions) (*RotatingFile, error) {
+	f := &RotatingFile{path: path, opts: opts, now: time.Now}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Write implements io.Writer, rotating the file first if the write would
+// exceed the size limit or the interval has passed
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if f.dueLocked(int64(len(p))) {
+		if err := f.rotateLocked(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Rotate renames the current file and starts a new one
+func (f *RotatingFile) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rotateLocked()
+}
+
+// Close closes the file
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// dueLocked reports whether the file must be rotated before writing n bytes
+func (f *RotatingFile) dueLocked(n int64) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.opts.MaxSize > 0 && f.size+n > f.opts.MaxSize {
+		return true
+	}
+	return f.opts.Interval > 0 && f.now().Sub(f.openedAt) >= f.opts.Interval
+}
+
+// open opens the log file and records its current size
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("opening log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("opening log file: %w", err)
+	}
+	f.file = file
+	f.size = info.Size()
+	f.openedAt = f.now()
+	return nil
+}
+
+// rotateLocked moves the current file aside, reopens the path and prunes old backups
+func (f *RotatingFile) rotateLocked() error {
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+	if err := os.Rename(f.path, f.backupName()); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("rotating log file: %w", err)
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	return f.pruneLocked()
+}
+
+// backupName returns an unused name for the rotated file
+func (f *RotatingFile) backupName() string {
+	ext := filepath.Ext(f.path)
+	base := strings.TrimSuffix(f.path, ext)
+	stamp := f.now().Format(backupTimeFormat)
+
+	name := fmt.Sprintf("%s.%s%s", base, stamp, ext)
+	for i := 1; ; i++ {
+		if _, err := os.Stat(name); os.IsNotExist(err) {
+			return name
+		}
+		name = fmt.Sprintf("%s.%s-%d%s", base, stamp, i, ext)
+	}
+}
+
+// Backups returns the rotated files, oldest first
+func (f *RotatingFile) Backups() ([]string, error) {
+	ext := filepath.Ext(f.path)
+	pattern := strings.TrimSuffix(f.path, ext) + ".*" + ext
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	type backup struct {
+		name  string
+		stamp time.Time
+		index int
+	}
+	var found []backup
+	for _, m := range matches {
+		if stamp, index, ok := f.parseBackupName(m); ok {
+			found = append(found, backup{m, stamp, index})
+		}
+	}
+	// Backups rotated within the same second are told apart by their index
+	sort.Slice(found, func(i, j int) bool {
+		if !found[i].stamp.Equal(found[j].stamp) {
+			return found[i].stamp.Before(found[j].stamp)
+		}
+		return found[i].index < found[j].index
+	})
+
+	backups := make([]string, len(found))
+	for i, b := range found {
+		backups[i] = b.name
+	}
+	return backups, nil
+}
+
+// parseBackupName returns the time and index backupName put in name. It
+// reports false for files that are not backups of the log file.
+func (f *RotatingFile) parseBackupName(name string) (time.Time, int, bool) {
+	ext := filepath.Ext(f.path)
+	rest, ok := strings.CutPrefix(name, strings.TrimSuffix(f.path, ext)+".")
+	if !ok {
+		return time.Time{}, 0, false
+	}
+	rest, ok = strings.CutSuffix(rest, ext)
+	if !ok || len(rest) < len(backupTimeFormat) {
+		return time.Time{}, 0, false
+	}
+	stamp, err := time.Parse(backupTimeFormat, rest[:len(backupTimeFormat)])
+	if err != nil {
+		return time.Time{}, 0, false
+	}
+	index := 0
+	if suffix := rest[len(backupTimeFormat):]; suffix != "" {
+		digits, ok := strings.CutPrefix(suffix, "-")
+		if index, err = strconv.Atoi(digits); !ok || err != nil || index < 1 {
+			return time.Time{}, 0, false
+		}
+	}
+	return stamp, index, true
+}
+
+// pruneLocked deletes backups beyond MaxBackups or older than MaxAge
+func (f *RotatingFile) pruneLocked() error {
+	if f.opts.MaxBackups <= 0 && f.opts.MaxAge <= 0 {
+		return nil
+	}
+	backups, err := f.Backups()
+	if err != nil {
+		return err
+	}
+
+	var remove []string
+	if f.opts.MaxBackups > 0 && len(backups) > f.opts.MaxBackups {
+		remove = append(remove, backups[:len(backups)-f.opts.MaxBackups]...)
+		backups = backups[len(backups)-f.opts.MaxBackups:]
+	}
+	if f.opts.MaxAge > 0 {
+		cutoff := f.now().Add(-f.opts.MaxAge)
+		for _, b := range backups {
+			if info, err := os.Stat(b); err == nil && info.ModTime().Before(cutoff) {
+				remove = append(remove, b)
+			}
+		}
+	}
+	for _, b := range remove {
+		if err := os.Remove(b); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("removing old log file: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingFileRotatesBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "client.log")
+	f, err := OpenRotatingFile(path, RotationOptions{MaxSize: 10, MaxBackups: 2})
+	if err != nil {
+		t.Fatalf("OpenRotatingFile() error: %v", err)
+	}
+	defer f.Close()
+
+	// Give every rotation its own timestamp so the backups sort in order
+	now := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	f.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatalf("Write(%q) error: %v", line, err)
+		}
+	}
+
+	backups, err := f.Backups()
+	if err != nil {
+		t.Fatalf("Backups() error: %v", err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("Backups() = %v; expected the 2 newest", backups)
+	}
+	for i, want := range []string{"second\n", "third\n"} {
+		if data, _ := os.ReadFile(backups[i]); string(data) != want {
+			t.Errorf("Backup %s = %q; expected %q", backups[i], data, want)
+		}
+		if !strings.HasSuffix(backups[i], ".log") {
+			t.Errorf("Backup %s should keep the .log extension", backups[i])
+		}
+	}
+	if data, _ := os.ReadFile(path); string(data) != "fourth\n" {
+		t.Errorf("Current file = %q; expected %q", data, "fourth\n")
+	}
+}
+
+func TestRotatingFileRotatesByInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "client.log")
+	f, err := OpenRotatingFile(path, RotationOptions{Interval: time.Hour})
+	if err != nil {
+		t.Fatalf("OpenRotatingFile() error: %v", err)
+	}
+	defer f.Close()
+
+	now := time.Now()
+	f.now = func() time.Time { return now }
+
+	f.Write([]byte("today\n"))
+	f.Write([]byte("still today\n"))
+	if backups, _ := f.Backups(); len(backups) != 0 {
+		t.Fatalf("Expected no rotation within the interval, got %v", backups)
+	}
+
+	now = now.Add(time.Hour)
+	f.Write([]byte("tomorrow\n"))
+	if backups, _ := f.Backups(); len(backups) != 1 {
+		t.Errorf("Expected one rotation after the interval, got %v", backups)
+	}
+}
+
+func TestRotatingFilePrunesOldBackups(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "client.log")
+	old := filepath.Join(dir, "client.20200101-000000.log")
+	if err := os.WriteFile(old, []byte("old\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	stale := time.Now().Add(-48 * time.Hour)
+	os.Chtimes(old, stale, stale)
+
+	f, err := OpenRotatingFile(path, RotationOptions{MaxAge: 24 * time.Hour})
+	if err != nil {
+		t.Fatalf("OpenRotatingFile() error: %v", err)
+	}
+	defer f.Close()
+
+	f.Write([]byte("current\n"))
+	if err := f.Rotate(); err != nil {
+		t.Fatalf("Rotate() error: %v", err)
+	}
+
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Error("Expected the backup older than MaxAge to be deleted")
+	}
+	if backups, _ := f.Backups(); len(backups) != 1 {
+		t.Errorf("Expected the new backup to be kept, got %v", backups)
+	}
+}
+
+func TestRotatingFileBackupsWithinOneSecond(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "client.log")
+	f, err := OpenRotatingFile(path, RotationOptions{MaxBackups: 2})
+	if err != nil {
+		t.Fatalf("OpenRotatingFile() error: %v", err)
+	}
+	defer f.Close()
+
+	now := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	f.now = func() time.Time { return now }
+	// Files that only look like backups are neither listed nor pruned
+	other := filepath.Join(dir, "client.old.log")
+	if err := os.WriteFile(other, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{"first\n", "second\n", "third\n"} {
+		f.Write([]byte(line))
+		if err := f.Rotate(); err != nil {
+			t.Fatalf("Rotate() error: %v", err)
+		}
+	}
+
+	backups, err := f.Backups()
+	if err != nil {
+		t.Fatalf("Backups() error: %v", err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("Backups() = %v; expected the 2 newest", backups)
+	}
+	for i, want := range []string{"second\n", "third\n"} {
+		if data, _ := os.ReadFile(backups[i]); string(data) != want {
+			t.Errorf("Backup %s = %q; expected %q", backups[i], data, want)
+		}
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("Expected %s to be left alone, got %v", other, err)
+	}
+}
@@ -101,9 +101,9 @@ func TestEscapeSpecialChars(t *testing.T) {
 }
 
 func TestLoggerOutput(t *testing.T) {
-	// Test that Logger outputs messages to stdout without error
+	// Test that a component logger outputs messages before logging is configured
 	t.Run("Logger outputs without error", func(t *testing.T) {
-		Logger.Println("Test log message")
+		Log(ComponentClient).Info("Test log message")
 
 		// Manually check output (this is usually done with log capture tools, but simple verification can be done)
 		// We can capture the output here or verify if the log works.